@@ -0,0 +1,134 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/Dieterbe/janitor/pkg/janitor/synth"
+)
+
+// benchConfigs are the trees that the benchmarks work on. The large one has few, small files, but about 2300 directories,
+// which shows how comparing all pairs scales with the number of directories: GetPairSims takes tens of seconds on it.
+var benchConfigs = []struct {
+	name string
+	opts synth.Opts
+}{
+	{"default", synth.DefaultOpts},
+	{"large", synth.Opts{
+		Seed:         1,
+		Depth:        2,
+		FanOut:       50,
+		Files:        2,
+		MinSize:      64,
+		MaxSize:      1024,
+		DupRatio:     0.2,
+		NearDupRatio: 0.1,
+		ZipRatio:     0.05,
+	}},
+}
+
+// benchTree is a generated tree, along with the result of walking it
+type benchTree struct {
+	fsys fstest.MapFS
+	root janitor.DirPrint
+	all  map[string]janitor.DirPrint
+}
+
+var benchTrees = struct {
+	sync.Mutex
+	trees map[string]*benchTree
+}{trees: make(map[string]*benchTree)}
+
+// loadBenchTree generates and walks the tree of the config, the first time it is needed
+func loadBenchTree(b *testing.B, name string, opts synth.Opts) *benchTree {
+	benchTrees.Lock()
+	defer benchTrees.Unlock()
+	if t, ok := benchTrees.trees[name]; ok {
+		return t
+	}
+	t := &benchTree{fsys: synth.Generate(opts)}
+	var err error
+	t.root, t.all, err = WalkFSContext(context.Background(), t.fsys, "/bench", janitor.Sha256FingerPrint, ioutil.Discard, Opts{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchTrees.trees[name] = t
+	return t
+}
+
+// runTrees runs the benchmark f as a sub-benchmark for the tree of every config
+func runTrees(b *testing.B, f func(b *testing.B, t *benchTree)) {
+	for _, cfg := range benchConfigs {
+		b.Run(cfg.name, func(b *testing.B) {
+			f(b, loadBenchTree(b, cfg.name, cfg.opts))
+		})
+	}
+}
+
+// benchmark runs f b.N times, reporting allocations and the time per directory that f processes
+func benchmark(b *testing.B, dirs int, f func()) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		f()
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*dirs), "ns/dir")
+}
+
+func BenchmarkWalk(b *testing.B) {
+	runTrees(b, func(b *testing.B, t *benchTree) {
+		for _, workers := range []int{1, 4} {
+			b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+				benchmark(b, len(t.all), func() {
+					_, _, err := WalkFSContext(context.Background(), t.fsys, "/bench", janitor.Sha256FingerPrint, ioutil.Discard, Opts{Workers: workers})
+					if err != nil {
+						b.Fatal(err)
+					}
+				})
+			})
+		}
+	})
+}
+
+// BenchmarkDirPrintIterator iterates the root, which covers the files of all directories
+func BenchmarkDirPrintIterator(b *testing.B) {
+	runTrees(b, func(b *testing.B, t *benchTree) {
+		benchmark(b, len(t.all), func() {
+			it := t.root.Iterator()
+			for it.Next() {
+				it.Value()
+			}
+		})
+	})
+}
+
+func BenchmarkNewSimilarity(b *testing.B) {
+	runTrees(b, func(b *testing.B, t *benchTree) {
+		// the subdirectories of the root are the largest directories to compare, other than the root itself
+		dirs := t.root.Dirs
+		if len(dirs) < 2 {
+			b.Fatalf("expected at least 2 subdirectories of the root, got %d", len(dirs))
+		}
+		n := len(janitor.Flatten(dirs[0])) + len(janitor.Flatten(dirs[1]))
+		benchmark(b, n, func() {
+			janitor.NewSimilarity(dirs[0].Iterator(), dirs[1].Iterator())
+		})
+	})
+}
+
+// BenchmarkGetPairSims compares all pairs of directories, so its time per directory grows with the size of the tree
+func BenchmarkGetPairSims(b *testing.B) {
+	runTrees(b, func(b *testing.B, t *benchTree) {
+		benchmark(b, len(t.all), func() {
+			janitor.GetPairSims(t.all, ioutil.Discard)
+		})
+	})
+}
@@ -0,0 +1,329 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// tabs of the main screen, in the order that tab cycles through them
+const (
+	tabClusters = iota // groups of copies
+	tabPairs           // similar pairs of directories
+	tabLint            // lint findings
+)
+
+// clusterView lists the clusters of copies of a scan, and which copy of each to keep.
+type clusterView struct {
+	clusters []janitor.Cluster // the Keeper of each is the suggested one, until the user chooses another
+	chosen   map[int]bool      // clusters (by index) for which the user chose the keeper
+	policy   int               // 0 for the configured keeper, otherwise index+1 within keeperRuleNames() of the rule that goes first
+	cursor   int
+	offset   int // index within clusters of the first one shown
+
+	confirming bool              // whether we show the plan, asking to confirm trashing the copies that are not kept
+	done       map[int]bool      // clusters (by index) of which the copies were trashed
+	outcomes   map[string]string // what happened to the copies that were to be trashed, by path
+	status     string            // outcome of the last action
+}
+
+func newClusterView(clusters []janitor.Cluster) *clusterView {
+	return &clusterView{
+		clusters: clusters,
+		chosen:   make(map[int]bool),
+		done:     make(map[int]bool),
+		outcomes: make(map[string]string),
+	}
+}
+
+// keeper returns the keeper of the current policy: the configured one, possibly with another rule going first.
+func (cv *clusterView) keeper(configured janitor.Keeper) janitor.Keeper {
+	if cv.policy == 0 {
+		return configured
+	}
+	k := configured
+	k.Rules = append([]string{keeperRuleNames()[cv.policy-1]}, configured.Rules...)
+	return k
+}
+
+// policyName describes the current policy
+func (cv *clusterView) policyName(configured janitor.Keeper) string {
+	if cv.policy == 0 {
+		return "configured (" + strings.Join(configured.Rules, ", ") + ")"
+	}
+	return keeperRuleNames()[cv.policy-1] + " first"
+}
+
+// nextPolicy switches to the next policy, and suggests new keepers for the clusters for which the user didn't choose one
+func (cv *clusterView) nextPolicy(configured janitor.Keeper, root string) {
+	cv.policy = (cv.policy + 1) % (len(janitor.KeeperRules) + 1)
+	cv.suggest(configured, root)
+}
+
+// suggest suggests keepers as per the current policy for the clusters for which the user didn't choose one, consistent with those that were chosen
+func (cv *clusterView) suggest(configured janitor.Keeper, root string) {
+	fixed := make(map[int]bool)
+	for i := range cv.clusters {
+		fixed[i] = cv.chosen[i] || cv.done[i]
+	}
+	cv.keeper(configured).Choose(cv.clusters, root, fixed)
+}
+
+// clusterOpts returns the options to cluster the results of scanning dir with: the modification times of the members are looked up within dir
+func (s scanSettings) clusterOpts(dir string) janitor.ClusterOpts {
+	opts := s.clusters
+	opts.Root = dir
+	opts.ModTime = func(path string) time.Time {
+		// directories within zip files can't be stat'ed, so they have no known time
+		fi, err := os.Stat(filepath.Join(dir, path))
+		if err != nil {
+			return time.Time{}
+		}
+		return fi.ModTime()
+	}
+	return opts
+}
+
+// updateClusters handles a key press in the clusters tab
+func (m *model) updateClusters(msg tea.KeyMsg) {
+	cv := m.clusters
+	if cv.confirming {
+		cv.confirming = false
+		if msg.String() == "y" {
+			m.trashCopies()
+		}
+		return
+	}
+	switch key := msg.String(); key {
+	case "up", "k":
+		if cv.cursor > 0 {
+			cv.cursor--
+		}
+	case "down", "j":
+		if cv.cursor < len(cv.clusters)-1 {
+			cv.cursor++
+		}
+	case "enter":
+		// show the details of the keeper and the first other member
+		if len(cv.clusters) == 0 {
+			break
+		}
+		c := cv.clusters[cv.cursor]
+		other := 0
+		if c.Keeper == 0 {
+			other = 1
+		}
+		p1, p2 := c.Members[c.Keeper].Path, c.Members[other].Path
+		a, b := m.allDirPrints[p1], m.allDirPrints[p2]
+		ps := janitor.PairSim{Path1: p1, Path2: p2, Sim: janitor.CompareOpts(a, b, m.settings.pairs).Similarity()}
+		m.detail = newDetailView(ps, a, b, m.settings.pairs)
+	case "o":
+		cv.nextPolicy(m.settings.clusters.Keeper, m.scanRoot)
+		cv.status = "keeper policy: " + cv.policyName(m.settings.clusters.Keeper)
+	case "x":
+		if len(cv.clusters) > len(cv.done) {
+			cv.confirming = true
+		}
+	default:
+		// a number chooses the member to keep
+		n, err := strconv.Atoi(key)
+		if err != nil || len(cv.clusters) == 0 || cv.done[cv.cursor] || n < 1 || n > len(cv.clusters[cv.cursor].Members) {
+			break
+		}
+		cv.clusters[cv.cursor].Keeper = n - 1
+		cv.chosen[cv.cursor] = true
+		cv.suggest(m.settings.clusters.Keeper, m.scanRoot)
+	}
+
+	if cv.cursor < cv.offset {
+		cv.offset = cv.cursor
+	}
+	if page := m.clusterPageSize(); cv.cursor >= cv.offset+page {
+		cv.offset = cv.cursor - page + 1
+	}
+}
+
+// keepByPolicy decides which path to keep for the listed pairs that are copies of each other, as per the configured keeper,
+// leaving the pairs that were decided already alone.
+func (m *model) keepByPolicy() {
+	opts := m.settings.clusterOpts(m.scanRoot)
+	var n int
+	for _, i := range m.order {
+		if _, ok := m.keep[i]; ok {
+			continue
+		}
+		ps := m.pairSims[i]
+		d, ok := janitor.DecidePair(m.allDirPrints, ps, opts)
+		if !ok {
+			continue
+		}
+		m.selected[i] = struct{}{}
+		m.keep[i] = 1
+		if d.Keep.Path == ps.Path2 {
+			m.keep[i] = 2
+		}
+		n++
+	}
+	m.status = fmt.Sprintf("decided which path to keep for %d pairs of copies, as per the keeper policy (%s)", n, strings.Join(opts.Keeper.Rules, ", "))
+}
+
+// trashCopies moves the copies that are to be removed as per the plan into the trash, for all clusters of which that wasn't done yet.
+// Copies that are left to review, and copies within zip files, are left alone, as we can't remove the latter by themselves.
+func (m *model) trashCopies() {
+	cv := m.clusters
+	dir, err := trashDir()
+	if err != nil {
+		cv.status = "could not find the trash: " + err.Error()
+		return
+	}
+	var trashed, failed, review int
+	var reclaimed int64
+	for i, d := range janitor.Plan(cv.clusters) {
+		if cv.done[i] {
+			continue
+		}
+		review += len(d.Review)
+		for _, mem := range d.Remove {
+			if m.inArchive(filepath.Dir(mem.Path)) {
+				cv.outcomes[mem.Path] = "can't trash entries within a zip file"
+				failed++
+				continue
+			}
+			abs := filepath.Join(m.scanRoot, mem.Path)
+			err := trash(dir, abs)
+			if err != nil {
+				fmt.Fprintln(m.log, "ERR could not trash copy:", abs, err)
+				cv.outcomes[mem.Path] = "failed: " + err.Error()
+				failed++
+				continue
+			}
+			fmt.Fprintln(m.log, "INF trashed copy:", abs)
+			m.relocated(mem.Path, "")
+			cv.outcomes[mem.Path] = "trashed"
+			trashed++
+			reclaimed += mem.Size
+		}
+		cv.done[i] = true
+	}
+	cv.status = fmt.Sprintf("trashed %d copies, reclaiming %s", trashed, humanBytes(reclaimed))
+	if failed > 0 {
+		cv.status += fmt.Sprintf(". %d copies could not be trashed", failed)
+	}
+	if review > 0 {
+		cv.status += fmt.Sprintf(". %d copies are left to review", review)
+	}
+}
+
+// viewPlan shows which copies will be kept, which will be trashed and which are left to review, asking for confirmation
+func (m *model) viewPlan() string {
+	cv := m.clusters
+	var lines []string
+	var keep, remove, review int
+	var total int64
+	for i, d := range janitor.Plan(cv.clusters) {
+		if cv.done[i] {
+			continue
+		}
+		keep++
+		lines = append(lines, rightOnlyStyle("keep   "+d.Keep.Path))
+		for _, mem := range d.Remove {
+			remove++
+			total += mem.Size
+			lines = append(lines, leftOnlyStyle(fmt.Sprintf("trash  %s  (%s)", mem.Path, humanBytes(mem.Size))))
+		}
+		for _, mem := range d.Review {
+			review++
+			lines = append(lines, fmt.Sprintf("review %s  (%s)", mem.Path, humanBytes(mem.Size)))
+		}
+	}
+	s := fmt.Sprintf("Keep %d copies, and move %d copies (%s) into the trash:\n\n", keep, remove, humanBytes(total))
+	if review > 0 {
+		s = fmt.Sprintf("Keep %d copies, move %d copies (%s) into the trash, and leave %d similar or nested copies to review:\n\n", keep, remove, humanBytes(total), review)
+	}
+	if max := m.mainHeight() - 6; max > 0 && len(lines) > max {
+		lines = append(lines[:max-1], fmt.Sprintf("... and %d more", len(lines)-max+1))
+	}
+	s += strings.Join(lines, "\n") + "\n"
+	return s + helpStyle("\n y: move them into the trash - any other key: back\n")
+}
+
+// clusterPageSize returns how many clusters fit on the screen, assuming they have 3 members.
+func (m *model) clusterPageSize() int {
+	if m.mainHeight() <= 0 {
+		return len(m.clusters.clusters) + 1
+	}
+	// each cluster takes a line, a line per member and an empty line. we need about 10 lines for the header and help text.
+	n := (m.mainHeight() - 10) / 5
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+func (m *model) viewClusters() string {
+	cv := m.clusters
+	if cv.confirming {
+		return m.viewPlan()
+	}
+	s := m.viewTabs() + "\n\n"
+	// the reclaimable bytes depend on the keepers of all clusters, which the user may have changed
+	plan := janitor.Plan(cv.clusters)
+	if len(cv.clusters) == 0 {
+		s += "no groups of copies found. (tab: similar pairs)\n"
+	} else {
+		var total int64
+		for _, d := range plan {
+			total += d.Reclaimable()
+		}
+		s += fmt.Sprintf("%d groups of copies, %s reclaimable by keeping one copy of each\n", len(cv.clusters), humanBytes(total))
+		s += helpStyle("keeper policy: "+cv.policyName(m.settings.clusters.Keeper)) + "\n\n"
+	}
+
+	end := cv.offset + m.clusterPageSize()
+	if end > len(cv.clusters) {
+		end = len(cv.clusters)
+	}
+	for i := cv.offset; i < end; i++ {
+		c := cv.clusters[i]
+		cursor := " "
+		if i == cv.cursor {
+			cursor = ">"
+		}
+		kind := "identical"
+		if !c.Identical {
+			kind = "similar"
+		}
+		s += fmt.Sprintf("%s %d %s copies of %s - %s reclaimable\n", cursor, len(c.Members), kind, humanBytes(c.Size), humanBytes(plan[i].Reclaimable()))
+		for j, mem := range c.Members {
+			line := fmt.Sprintf("    %d. %s", j+1, mem.Path)
+			if !mem.ModTime.IsZero() {
+				line += helpStyle("  " + mem.ModTime.Format("2006-01-02 15:04"))
+			}
+			if j == c.Keeper {
+				reason := "chosen"
+				if !cv.chosen[i] {
+					reason = "suggested"
+					if c.KeeperReason != "" {
+						reason += ": " + c.KeeperReason
+					}
+				}
+				line = rightOnlyStyle(line + "  [keep, " + reason + "]")
+			} else if outcome, ok := cv.outcomes[mem.Path]; ok {
+				line = leftOnlyStyle(line + "  [" + outcome + "]")
+			}
+			s += line + "\n"
+		}
+		s += "\n"
+	}
+
+	if cv.status != "" {
+		s += cv.status + "\n"
+	}
+	return s + helpStyle("\n up/down/j/k: navigate - 1-9: keep that copy - o: next keeper policy - x: trash the copies that are not kept - enter: details - tab: similar pairs - s: scan - q: quit\n")
+}
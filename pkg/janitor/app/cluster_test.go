@@ -0,0 +1,317 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestClusterTab tests choosing the copy to keep in the clusters tab, and switching tabs
+func TestClusterTab(t *testing.T) {
+	m := newModel(nil, nil, nil, nil, "", scanSettings{}, nil, nil)
+	m.allDirPrints = janitor.Flatten(janitor.DataMainPrint)
+	m.clusters = newClusterView([]janitor.Cluster{
+		{
+			Members:      []janitor.ClusterMember{{Path: "a", Size: 10}, {Path: "b", Size: 10}, {Path: "c", Size: 10}},
+			Size:         10,
+			Reclaimable:  20,
+			Identical:    true,
+			Keeper:       0,
+			KeeperReason: "shortest",
+		},
+		{
+			Members:     []janitor.ClusterMember{{Path: "d", Size: 4}, {Path: "e", Size: 4}},
+			Size:        4,
+			Reclaimable: 4,
+			Identical:   true,
+		},
+	})
+	m.lint = newLintView(nil)
+	m.tab = tabClusters
+
+	press := func(key string) {
+		t.Helper()
+		msg, ok := parseKey(key)
+		if !ok {
+			t.Fatalf("invalid key %q", key)
+		}
+		res, _ := m.Update(msg)
+		m = res.(model)
+	}
+
+	view := m.View()
+	for _, exp := range []string{"2 groups of copies, 24 B reclaimable", "3 identical copies of 10 B - 20 B reclaimable", "1. a  [keep, suggested: shortest]"} {
+		if !strings.Contains(view, exp) {
+			t.Errorf("view does not contain %q:\n%s", exp, view)
+		}
+	}
+
+	press("down")
+	press("2")
+	press("9") // there is no 9th copy
+	if c := m.clusters.clusters[1]; c.Keeper != 1 || !m.clusters.chosen[1] {
+		t.Errorf("expected the 2nd copy to be chosen to keep, got keeper %d", c.Keeper)
+	}
+	if !strings.Contains(m.View(), "2. e  [keep, chosen]") {
+		t.Errorf("view does not show the chosen copy:\n%s", m.View())
+	}
+	if m.clusters.clusters[0].Keeper != 0 || m.clusters.chosen[0] {
+		t.Errorf("the keeper of the other cluster changed")
+	}
+
+	press("enter")
+	if m.detail == nil || m.detail.pair.Path1 != "e" || m.detail.pair.Path2 != "d" {
+		t.Fatalf("expected the details of the keeper e and the other copy d, got %+v", m.detail)
+	}
+	press("esc")
+
+	for _, exp := range []int{tabPairs, tabLint, tabClusters} {
+		press("tab")
+		if m.tab != exp {
+			t.Errorf("expected tab %d, got %d", exp, m.tab)
+		}
+	}
+}
+
+// TestClusterOptsModTime tests that the modification times of cluster members are looked up in the scanned directory
+func TestClusterOptsModTime(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("..", "testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := scanSettings{}.clusterOpts(dir)
+	if opts.Root != dir {
+		t.Errorf("expected root %q, got %q", dir, opts.Root)
+	}
+	if opts.ModTime("dir1").IsZero() {
+		t.Errorf("expected a modification time for dir1")
+	}
+	if !opts.ModTime("nonexistent").IsZero() {
+		t.Errorf("expected no modification time for a directory that can't be stat'ed")
+	}
+}
+
+// makeCopies creates identical copies of a directory with a file at the given paths within dir, modified on consecutive days
+func makeCopies(t *testing.T, dir string, paths ...string) {
+	t.Helper()
+	for i, p := range paths {
+		abs := filepath.Join(dir, p)
+		if err := os.MkdirAll(abs, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(abs, "a.jpg"), []byte("foo"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		day := time.Date(2020, 1, i+1, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(abs, day, day); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestPlan tests listing which copies to keep and remove
+func TestPlan(t *testing.T) {
+	dir := t.TempDir()
+	makeCopies(t, dir, "tmp/photos", "old-photos", "photos")
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1, clusters: janitor.ClusterOpts{Keeper: janitor.DefaultKeeper}}
+
+	var buf bytes.Buffer
+	err := doPlan(dir, settings, ioutil.Discard, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "keep\t3\t" + dir + "/old-photos\toldest\n" +
+		"remove\t3\t" + dir + "/photos\n" +
+		"remove\t3\t" + dir + "/tmp/photos\n" +
+		"\n1 groups of copies, 6 B reclaimable\n"
+	if diff := cmp.Diff(exp, buf.String()); diff != "" {
+		t.Errorf("doPlan() mismatch (-want +got):\n%s", diff)
+	}
+
+	settings.clusters.Keeper = janitor.Keeper{Rules: []string{"shallowest", "newest"}}
+	buf.Reset()
+	err = doPlan(dir, settings, ioutil.Discard, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "keep\t3\t"+dir+"/photos\tnewest\n") {
+		t.Errorf("doPlan() with the shallowest and newest rules doesn't keep photos:\n%s", buf.String())
+	}
+
+	// copies that are merely similar have content of their own, so they are left to review
+	makeCopies(t, dir, "more-photos")
+	if err := os.WriteFile(filepath.Join(dir, "more-photos", "b.jpg"), []byte("bar"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	settings.clusters.MinContent = 0.3
+	buf.Reset()
+	err = doPlan(dir, settings, ioutil.Discard, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "remove\t") || strings.Count(buf.String(), "review\t") != 3 || !strings.HasSuffix(buf.String(), "0 B reclaimable\n") {
+		t.Errorf("doPlan() of similar copies doesn't leave them to review:\n%s", buf.String())
+	}
+}
+
+// TestPlanExcluded tests that a copy with content that was left out of the scan is not removed, as that content may exist nowhere else
+func TestPlanExcluded(t *testing.T) {
+	dir := t.TempDir()
+	makeCopies(t, dir, "old-photos", "photos")
+	if err := os.WriteFile(filepath.Join(dir, "photos", "raw.cr2"), []byte("unique"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ig := janitor.NewIgnore()
+	ig.Add(".", "*.cr2")
+	settings := scanSettings{ignore: ig, fpr: janitor.Sha256FingerPrint, workers: 1, clusters: janitor.ClusterOpts{Keeper: janitor.DefaultKeeper}}
+
+	var buf bytes.Buffer
+	err := doPlan(dir, settings, ioutil.Discard, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "remove\t") || !strings.Contains(buf.String(), "review\t3\t"+dir+"/photos\n") {
+		t.Errorf("doPlan() doesn't leave the copy with excluded content to review:\n%s", buf.String())
+	}
+}
+
+// scanModel returns the model after scanning dir
+func scanModel(t *testing.T, dir string, settings scanSettings) model {
+	t.Helper()
+	m := newModel([]string{dir}, nil, nil, nil, "", settings, nil, ioutil.Discard)
+	m.cancelScan = func() {}
+	st := &stopper{}
+	ch := make(chan tea.Msg, 100)
+	scan(context.Background(), st, dir, nil, settings, ioutil.Discard, ch)
+	for msg := range ch {
+		if done, ok := msg.(scanDoneMsg); ok {
+			res, _ := m.Update(done)
+			return res.(model)
+		}
+	}
+	t.Fatal("the scan did not finish")
+	return m
+}
+
+// TestClusterTrash tests switching the keeper policy and trashing the copies that are not kept, after confirming the plan
+func TestClusterTrash(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	scanDir := filepath.Join(dir, "scan")
+	makeCopies(t, scanDir, "tmp/photos", "old-photos", "photos")
+
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1, clusters: janitor.ClusterOpts{Keeper: janitor.DefaultKeeper}}
+	m := scanModel(t, scanDir, settings)
+	if m.tab != tabClusters || len(m.clusters.clusters) != 1 {
+		t.Fatalf("expected a cluster of copies, got %+v", m.clusters.clusters)
+	}
+
+	press := func(key string) {
+		t.Helper()
+		msg, ok := parseKey(key)
+		if !ok {
+			t.Fatalf("invalid key %q", key)
+		}
+		res, _ := m.Update(msg)
+		m = res.(model)
+	}
+
+	// in the pairs tab, the configured policy decides which path of the pairs of copies to keep
+	press("tab")
+	press("a")
+	if !strings.Contains(m.status, "decided which path to keep for 3 pairs") {
+		t.Errorf("unexpected status %q", m.status)
+	}
+	for i, ps := range m.pairSims {
+		if keep, ok := m.keep[i]; ps.Path2 == "tmp/photos" && keep != 1 || ps.Path1 == "tmp/photos" && keep != 2 || !ok && ps.Sim.Identical() {
+			t.Errorf("expected to keep the copy that is not temporary of %s and %s, got path %d", ps.Path1, ps.Path2, keep)
+		}
+	}
+	press("tab")
+	press("tab")
+
+	// "archive" is the first policy, and makes no difference. "newest" is the second one
+	press("o")
+	press("o")
+	if !strings.Contains(m.View(), "keeper policy: newest first") || !strings.Contains(m.View(), "2. photos") {
+		t.Fatalf("expected the newest policy:\n%s", m.View())
+	}
+	if d := m.clusters.clusters[0].Decision(); d.Keep.Path != "photos" || d.Reason != "newest" {
+		t.Errorf("expected to keep photos as the newest copy, got %+v", d)
+	}
+
+	// anything but y backs out of the plan
+	press("x")
+	if !strings.Contains(m.View(), "Keep 1 copies, and move 2 copies (6 B) into the trash") {
+		t.Errorf("expected the plan:\n%s", m.View())
+	}
+	press("n")
+	press("x")
+	press("y")
+
+	for p, exp := range map[string]bool{"photos": true, "old-photos": false, "tmp/photos": false} {
+		_, err := os.Stat(filepath.Join(scanDir, p))
+		if exists := err == nil; exists != exp {
+			t.Errorf("expected %s to exist: %t, got error %v", p, exp, err)
+		}
+	}
+	if !strings.Contains(m.View(), "trashed 2 copies, reclaiming 6 B") || strings.Count(m.View(), "[trashed]") != 2 {
+		t.Errorf("view does not show the outcome:\n%s", m.View())
+	}
+
+	// the copies are gone, so there is nothing left to do
+	press("x")
+	if m.clusters.confirming {
+		t.Errorf("expected no plan after trashing all copies")
+	}
+}
+
+// TestClusterTrashNested tests that trashing the copies of clusters of which the members are nested keeps a copy of everything:
+// x and y are copies, and so are x/sub, y/sub and z/sub. On their own, the oldest of x and y is y, and the oldest of the subdirectories is x/sub.
+func TestClusterTrashNested(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	scanDir := filepath.Join(dir, "scan")
+	for p, body := range map[string]string{"x/readme": "x or y", "y/readme": "x or y", "z/other": "z", "x/sub/a.jpg": "foo", "y/sub/a.jpg": "foo", "z/sub/a.jpg": "foo"} {
+		abs := filepath.Join(scanDir, p)
+		if err := os.MkdirAll(filepath.Dir(abs), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(abs, []byte(body), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p, d := range map[string]int{"x": 2, "y": 1, "x/sub": 1, "y/sub": 2, "z/sub": 3} {
+		day := time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(filepath.Join(scanDir, p), day, day); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1, clusters: janitor.ClusterOpts{Keeper: janitor.Keeper{Rules: []string{"oldest"}}}}
+	m := scanModel(t, scanDir, settings)
+	if len(m.clusters.clusters) != 2 {
+		t.Fatalf("expected 2 clusters of copies, got %+v", m.clusters.clusters)
+	}
+	for _, key := range []string{"x", "y"} {
+		msg, _ := parseKey(key)
+		res, _ := m.Update(msg)
+		m = res.(model)
+	}
+
+	for p, exp := range map[string]bool{"y/sub/a.jpg": true, "y/readme": true, "x": false, "z/sub": false, "z/other": true} {
+		_, err := os.Stat(filepath.Join(scanDir, p))
+		if exists := err == nil; exists != exp {
+			t.Errorf("expected %s to exist: %t, got error %v", p, exp, err)
+		}
+	}
+}
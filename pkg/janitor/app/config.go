@@ -0,0 +1,399 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Config holds the default options, as loaded from the config file (in JSON format).
+// Options given on the command line take precedence.
+type Config struct {
+	ScanPaths     []string          `json:"scan_paths"`     // paths to scan if none are given on the command line
+	Ignore        IgnoreConfig      `json:"ignore"`         // (the global ignore file and .janitorignore files apply as well)
+	Fingerprint   string            `json:"fingerprint"`    // name of the fingerprint algorithm, see janitor.FingerPrinters
+	PathMetric    string            `json:"path_metric"`    // name of the metric to compare paths of matching files with, see janitor.PathMetrics
+	Workers       int               `json:"workers"`        // number of files to fingerprint concurrently
+	Sort          string            `json:"sort"`           // initial order of the pairs, see pairOrderNames
+	Weights       *janitor.Weights  `json:"weights"`        // weights of the "score" order, e.g. {"content": 1, "bytes": 0.5}. Unset weights are 0
+	Filter        janitor.Filter    `json:"filter"`         // initial filter of the listed pairs, e.g. {"min_content": 0.5, "min_bytes": 1024}
+	ImageDistance int               `json:"image_distance"` // maximum Hamming distance of the perceptual hashes of similar images (with the sha256-image fingerprint). -1 disables
+	Clusters      ClusterConfig     `json:"clusters"`
+	Log           LogConfig         `json:"log"`
+	Keys          map[string]string `json:"keys"` // key remaps: pressing a key acts like pressing the key it maps to. e.g. {"x": "d"}
+	Theme         Theme             `json:"theme"`
+}
+
+type IgnoreConfig struct {
+	Patterns       []string `json:"patterns"` // gitignore-style patterns, like -exclude
+	MinSize        int64    `json:"min_size"`
+	MaxSize        int64    `json:"max_size"`
+	SkipCommonDirs bool     `json:"skip_common_dirs"`
+}
+
+// ClusterConfig determines how copies are grouped, and which copy is suggested to keep
+type ClusterConfig struct {
+	MinContent     float64  `json:"min_content"`     // pairs at least this similar in content are grouped as well. 0 means only identical pairs
+	Keeper         []string `json:"keeper"`          // names of the rules to choose the copy to keep with, by priority. see janitor.KeeperRules
+	PreferredRoots []string `json:"preferred_roots"` // copies within these directories are kept over all others, e.g. "~/photos/"
+	TempPatterns   []string `json:"temp_patterns"`   // files and directories that the not-temp rule considers temporary. unset means janitor.DefaultTempPatterns
+}
+
+type LogConfig struct {
+	File  string `json:"file"`
+	Level string `json:"level"` // one of logLevels
+}
+
+// Theme holds the colors of the UI: ANSI color numbers (e.g. "241") or hex colors (e.g. "#ff8800")
+type Theme struct {
+	Text      string `json:"text"`
+	Help      string `json:"help"`
+	Renamed   string `json:"renamed"`
+	LeftOnly  string `json:"left_only"`
+	RightOnly string `json:"right_only"`
+	Changed   string `json:"changed"`
+	Similar   string `json:"similar"`
+}
+
+// logLevels are the supported log levels, from most to least verbose, along with the prefix of the log lines of that level
+var logLevels = []struct {
+	name   string
+	prefix string
+}{
+	{"info", "INF"},
+	{"warn", "WARN"},
+	{"error", "ERR"},
+}
+
+func defaultConfig() Config {
+	return Config{
+		Fingerprint:   "sha256",
+		PathMetric:    "hamming",
+		Workers:       1,
+		Sort:          "similarity",
+		ImageDistance: janitor.DefaultImageDistance,
+		Clusters: ClusterConfig{
+			Keeper: janitor.DefaultKeeper.Rules,
+		},
+		Log: LogConfig{
+			File:  "janitor.log",
+			Level: "info",
+		},
+		Theme: Theme{
+			Text:      "252",
+			Help:      "241",
+			Renamed:   "214",
+			LeftOnly:  "203",
+			RightOnly: "78",
+			Changed:   "170",
+			Similar:   "117",
+		},
+	}
+}
+
+// configFile returns the default location of the config file
+func configFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "janitor", "config"), nil
+}
+
+// loadConfig reads the config file, on top of the defaults. A file that doesn't exist simply means the defaults.
+func loadConfig(file string) (Config, error) {
+	fd, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaultConfig(), nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	defer fd.Close()
+	cfg, err := parseConfig(fd)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+// parseConfig reads the config on top of the defaults, and validates it. Unknown keys are errors.
+func parseConfig(r io.Reader) (Config, error) {
+	cfg := defaultConfig()
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&cfg)
+	if err != nil {
+		return Config{}, err
+	}
+	if dec.More() {
+		return Config{}, errors.New("unexpected data after the config object")
+	}
+	return cfg, cfg.Validate()
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Validate returns all problems with the config, if any
+func (c Config) Validate() error {
+	var errs []string
+	if _, ok := janitor.FingerPrinters[c.Fingerprint]; !ok {
+		errs = append(errs, fmt.Sprintf("fingerprint: unknown algorithm %q (available: %s)", c.Fingerprint, strings.Join(fingerprinterNames(), ", ")))
+	}
+	if _, ok := janitor.PathMetrics[c.PathMetric]; !ok {
+		errs = append(errs, fmt.Sprintf("path_metric: unknown metric %q (available: %s)", c.PathMetric, strings.Join(metricNames(), ", ")))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, fmt.Sprintf("workers: must be at least 1, not %d", c.Workers))
+	}
+	if _, ok := pairOrderNames[c.Sort]; !ok {
+		var names []string
+		for name := range pairOrderNames {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		errs = append(errs, fmt.Sprintf("sort: unknown order %q (available: %s)", c.Sort, strings.Join(names, ", ")))
+	}
+	if c.Filter.MinContent < 0 || c.Filter.MinContent > 1 || c.Filter.MinPath < 0 || c.Filter.MinPath > 1 {
+		errs = append(errs, "filter: min_content and min_path must be between 0 and 1")
+	}
+	if c.Filter.MinBytes < 0 || c.Filter.MinFiles < 0 {
+		errs = append(errs, "filter: min_bytes and min_files can't be negative")
+	}
+	if c.ImageDistance < -1 || c.ImageDistance > 64 {
+		errs = append(errs, fmt.Sprintf("image_distance: must be between 0 and 64 (or -1 to disable), not %d", c.ImageDistance))
+	}
+	if c.Clusters.MinContent < 0 || c.Clusters.MinContent > 1 {
+		errs = append(errs, "clusters: min_content must be between 0 and 1")
+	}
+	for _, name := range c.Clusters.Keeper {
+		if _, ok := janitor.KeeperRules[name]; !ok {
+			errs = append(errs, fmt.Sprintf("clusters: unknown keeper rule %q (available: %s)", name, strings.Join(keeperRuleNames(), ", ")))
+		}
+	}
+	if c.Ignore.MinSize < 0 || c.Ignore.MaxSize < 0 {
+		errs = append(errs, "ignore: sizes can't be negative")
+	}
+	if c.Ignore.MaxSize > 0 && c.Ignore.MaxSize < c.Ignore.MinSize {
+		errs = append(errs, fmt.Sprintf("ignore: max_size %d is smaller than min_size %d", c.Ignore.MaxSize, c.Ignore.MinSize))
+	}
+	if c.Log.File == "" {
+		errs = append(errs, "log: file can't be empty")
+	}
+	if _, ok := logLevel(c.Log.Level); !ok {
+		errs = append(errs, fmt.Sprintf("log: unknown level %q (available: info, warn, error)", c.Log.Level))
+	}
+	var keys []string
+	for k := range c.Keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, ok := parseKey(k); !ok {
+			errs = append(errs, fmt.Sprintf("keys: unknown key %q", k))
+		}
+		if _, ok := parseKey(c.Keys[k]); !ok {
+			errs = append(errs, fmt.Sprintf("keys: unknown key %q (that %q maps to)", c.Keys[k], k))
+		}
+	}
+	colors := []struct {
+		name  string
+		value string
+	}{
+		{"text", c.Theme.Text},
+		{"help", c.Theme.Help},
+		{"renamed", c.Theme.Renamed},
+		{"left_only", c.Theme.LeftOnly},
+		{"right_only", c.Theme.RightOnly},
+		{"changed", c.Theme.Changed},
+		{"similar", c.Theme.Similar},
+	}
+	for _, col := range colors {
+		n, err := strconv.Atoi(col.value)
+		if (err != nil || n < 0 || n > 255) && !hexColor.MatchString(col.value) {
+			errs = append(errs, fmt.Sprintf("theme: %s: invalid color %q (expected an ANSI color number or a hex color)", col.name, col.value))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New("invalid config: " + strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// weights returns the weights of the "score" order
+func (c Config) weights() janitor.Weights {
+	if c.Weights == nil {
+		return janitor.DefaultWeights
+	}
+	return *c.Weights
+}
+
+// fingerprinterNames returns the names of the available fingerprint algorithms, sorted
+func fingerprinterNames() []string {
+	var names []string
+	for name := range janitor.FingerPrinters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keeperRuleNames returns the names of the available keeper rules, sorted
+func keeperRuleNames() []string {
+	var names []string
+	for name := range janitor.KeeperRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// clusterOpts returns the options to cluster copies with
+func (c Config) clusterOpts() janitor.ClusterOpts {
+	return janitor.ClusterOpts{
+		MinContent: c.Clusters.MinContent,
+		Keeper: janitor.Keeper{
+			PreferredRoots: c.Clusters.PreferredRoots,
+			Rules:          c.Clusters.Keeper,
+			TempPatterns:   c.Clusters.TempPatterns,
+		},
+	}
+}
+
+// metricNames returns the names of the available path metrics, sorted
+func metricNames() []string {
+	var names []string
+	for name := range janitor.PathMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newIgnore assembles the ignore rules from the config, the global ignore file in the user config dir (if it exists)
+// and the command line excludes
+func (c Config) newIgnore(excludes []string) (*janitor.Ignore, error) {
+	ig := janitor.NewIgnore()
+	ig.MinSize = c.Ignore.MinSize
+	ig.MaxSize = c.Ignore.MaxSize
+	if c.Ignore.SkipCommonDirs {
+		ig.Add(".", janitor.CommonSkipDirs...)
+	}
+	ig.Add(".", c.Ignore.Patterns...)
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	fd, err := os.Open(filepath.Join(dir, "janitor", "ignore"))
+	if err == nil {
+		err = ig.AddFrom(fd, ".")
+		fd.Close()
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ig.Add(".", excludes...)
+	return ig, nil
+}
+
+// keyMap returns the key remaps of the config. It must be valid.
+func (c Config) keyMap() map[string]tea.KeyMsg {
+	m := make(map[string]tea.KeyMsg)
+	for k, v := range c.Keys {
+		m[k], _ = parseKey(v)
+	}
+	return m
+}
+
+// applyTheme sets the colors of all our styles
+func applyTheme(t Theme) {
+	fg := func(color string) func(string) string {
+		return lipgloss.NewStyle().Foreground(lipgloss.Color(color)).Render
+	}
+	textStyle = fg(t.Text)
+	helpStyle = fg(t.Help)
+	renamedStyle = fg(t.Renamed)
+	leftOnlyStyle = fg(t.LeftOnly)
+	rightOnlyStyle = fg(t.RightOnly)
+	changedStyle = fg(t.Changed)
+	similarStyle = fg(t.Similar)
+}
+
+// keyTypes maps the names of special keys (as per tea.KeyMsg.String()) to their type
+var keyTypes = func() map[string]tea.KeyType {
+	m := make(map[string]tea.KeyType)
+	// the special keys have negative types, and control characters types up to 127
+	for t := tea.KeyType(-100); t <= 127; t++ {
+		if name := t.String(); name != "" && t != tea.KeyRunes {
+			m[name] = t
+		}
+	}
+	return m
+}()
+
+// parseKey returns the key message that has the given string representation, as used in our key bindings.
+// e.g. "q", "alt+x", "ctrl+c", "enter" or " ".
+func parseKey(s string) (tea.KeyMsg, bool) {
+	if t, ok := keyTypes[s]; ok {
+		return tea.KeyMsg{Type: t}, true
+	}
+	var alt bool
+	if strings.HasPrefix(s, "alt+") && len(s) > len("alt+") {
+		alt = true
+		s = s[len("alt+"):]
+		if t, ok := keyTypes[s]; ok {
+			return tea.KeyMsg{Type: t, Alt: true}, true
+		}
+	}
+	runes := []rune(s)
+	if len(runes) != 1 {
+		return tea.KeyMsg{}, false
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: runes, Alt: alt}, true
+}
+
+// logLevel returns the index of the given level within logLevels
+func logLevel(level string) (int, bool) {
+	for i, l := range logLevels {
+		if l.name == level {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// levelWriter drops the log lines below the minimum level. Lines that don't start with a known level are always written.
+type levelWriter struct {
+	w   io.Writer
+	min int // index within logLevels
+}
+
+func newLevelWriter(w io.Writer, level string) io.Writer {
+	min, _ := logLevel(level)
+	if min == 0 {
+		return w
+	}
+	return levelWriter{w: w, min: min}
+}
+
+func (lw levelWriter) Write(b []byte) (int, error) {
+	for i := 0; i < lw.min; i++ {
+		if bytes.HasPrefix(b, []byte(logLevels[i].prefix+" ")) {
+			return len(b), nil
+		}
+	}
+	return lw.w.Write(b)
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseConfig(t *testing.T) {
+	in := `{
+	"scan_paths": ["/home/joe"],
+	"ignore": {"patterns": ["*.iso"], "max_size": 1000, "skip_common_dirs": true},
+	"workers": 4,
+	"sort": "reclaimable",
+	"weights": {"content": 1, "bytes": 2},
+	"log": {"file": "/tmp/janitor.log", "level": "warn"},
+	"keys": {"x": "d", "ctrl+j": "down"},
+	"theme": {"help": "#888888"}
+}`
+	got, err := parseConfig(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parseConfig() unexpected error %v", err)
+	}
+	exp := defaultConfig()
+	exp.ScanPaths = []string{"/home/joe"}
+	exp.Ignore = IgnoreConfig{Patterns: []string{"*.iso"}, MaxSize: 1000, SkipCommonDirs: true}
+	exp.Workers = 4
+	exp.Sort = "reclaimable"
+	exp.Weights = &janitor.Weights{Content: 1, Bytes: 2}
+	exp.Log = LogConfig{File: "/tmp/janitor.log", Level: "warn"}
+	exp.Keys = map[string]string{"x": "d", "ctrl+j": "down"}
+	exp.Theme.Help = "#888888"
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("parseConfig() mismatch (-want +got):\n%s", diff)
+	}
+
+	keys := got.keyMap()
+	if s := keys["x"].String(); s != "d" {
+		t.Errorf("keyMap() x maps to %q, expected d", s)
+	}
+	if s := keys["ctrl+j"].String(); s != "down" {
+		t.Errorf("keyMap() ctrl+j maps to %q, expected down", s)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	cases := []struct {
+		in  string
+		err string // substring of the expected error
+	}{
+		{`{"workers": 2, "colour": "red"}`, `unknown field "colour"`},
+		{`{"log": {"file": "x", "verbosity": 1}}`, `unknown field "verbosity"`},
+		{`{"workers": "many"}`, `cannot unmarshal string`},
+		{`{"sort": "random"}`, `sort: unknown order "random"`},
+		{`{"weights": {"content": 1, "size": 1}}`, `unknown field "size"`},
+		{`{"filter": {"min_content": 50}}`, `min_content and min_path must be between 0 and 1`},
+		{`{"image_distance": 65}`, `image_distance: must be between 0 and 64`},
+		{`{"clusters": {"keeper": ["biggest"]}}`, `clusters: unknown keeper rule "biggest" (available: archive, newest, not-archive, not-temp, oldest, shallowest, shortest)`},
+		{`{"workers": 0}`, `workers: must be at least 1`},
+		{`{"fingerprint": "md5"}`, `unknown algorithm "md5"`},
+		{`{"path_metric": "cosine"}`, `unknown metric "cosine" (available: components, hamming, jaro-winkler, levenshtein)`},
+		{`{"ignore": {"min_size": 100, "max_size": 10}}`, `max_size 10 is smaller than min_size 100`},
+		{`{"log": {"level": "debug"}}`, `unknown level "debug"`},
+		{`{"keys": {"x": "ctrl+whatever"}}`, `unknown key "ctrl+whatever"`},
+		{`{"theme": {"text": "red"}}`, `theme: text: invalid color "red"`},
+		{`{} {}`, `unexpected data`},
+	}
+	for _, c := range cases {
+		_, err := parseConfig(strings.NewReader(c.in))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("parseConfig(%s) got error %v, expected it to contain %q", c.in, err, c.err)
+		}
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	for _, s := range []string{"q", "Q", "1", " ", "enter", "esc", "up", "ctrl+c", "alt+x", "alt+enter", "backspace", "tab", "shift+tab", "pgdown"} {
+		k, ok := parseKey(s)
+		if !ok {
+			t.Errorf("parseKey(%q) failed", s)
+			continue
+		}
+		if k.String() != s {
+			t.Errorf("parseKey(%q) returned key %q", s, k.String())
+		}
+	}
+	for _, s := range []string{"", "xy", "ctrl+whatever", "alt+"} {
+		if k, ok := parseKey(s); ok {
+			t.Errorf("parseKey(%q) expected failure, got %q", s, k.String())
+		}
+	}
+}
+
+func TestRemapKeys(t *testing.T) {
+	m := newModel(nil, nil, nil, nil, "", scanSettings{}, map[string]tea.KeyMsg{"Q": {Type: tea.KeyRunes, Runes: []rune("q")}}, nil)
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("Q")})
+	if cmd == nil {
+		t.Fatalf("expected Q to act as q, and quit")
+	}
+	if cmd() != tea.Quit() {
+		t.Errorf("expected Q to act as q, and quit")
+	}
+}
+
+func TestLevelWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := newLevelWriter(&buf, "warn")
+	for _, line := range []string{"INF some info\n", "WARN a warning\n", "ERR an error\n", "ERROR another error\n", "something else\n"} {
+		w.Write([]byte(line))
+	}
+	exp := "WARN a warning\nERR an error\nERROR another error\nsomething else\n"
+	if buf.String() != exp {
+		t.Errorf("levelWriter wrote %q, expected %q", buf.String(), exp)
+	}
+}
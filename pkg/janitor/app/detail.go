@@ -0,0 +1,312 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	renamedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214")).Render
+	leftOnlyStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("203")).Render
+	rightOnlyStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("78")).Render
+	changedStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("170")).Render
+	similarStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("117")).Render
+)
+
+type diffKind int
+
+const (
+	diffSame    diffKind = iota // same content, same path
+	diffRenamed                 // same content, different path
+	diffLeft                    // only in the left dir
+	diffRight                   // only in the right dir
+	diffChanged                 // same path, different content
+	diffSimilar                 // different content, but images that look the same
+)
+
+// diffEntry describes how a file in the left dir relates to one in the right dir.
+// for diffLeft (diffRight), right (left) is not set.
+type diffEntry struct {
+	kind  diffKind
+	left  janitor.FilePrint
+	right janitor.FilePrint
+}
+
+// path returns the path used to position the entry in the tree
+func (e diffEntry) path() string {
+	if e.kind == diffRight {
+		return e.right.Path
+	}
+	return e.left.Path
+}
+
+// diffDirPrints lists how the files of both DirPrints relate, as diffEntries ordered by path.
+// It is derived from janitor.CompareOpts, just like the Similarity of the pair, so that they agree.
+func diffDirPrints(a, b janitor.DirPrint, opts janitor.PairOpts) []diffEntry {
+	c := janitor.CompareOpts(a, b, opts)
+	var entries []diffEntry
+	for _, m := range c.Matched {
+		kind := diffSame
+		if m.A.Path != m.B.Path {
+			kind = diffRenamed
+		}
+		entries = append(entries, diffEntry{kind: kind, left: m.A, right: m.B})
+	}
+	for _, ch := range c.Changed {
+		entries = append(entries, diffEntry{kind: diffChanged, left: ch.A, right: ch.B})
+	}
+	for _, si := range c.Similar {
+		entries = append(entries, diffEntry{kind: diffSimilar, left: si.A, right: si.B})
+	}
+	for _, f := range c.OnlyA {
+		entries = append(entries, diffEntry{kind: diffLeft, left: f})
+	}
+	for _, f := range c.OnlyB {
+		entries = append(entries, diffEntry{kind: diffRight, right: f})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].path() < entries[j].path()
+	})
+	return entries
+}
+
+// diffNode is a node in the tree of diffEntries. directories have children, files have an entry.
+type diffNode struct {
+	name     string
+	path     string
+	children []*diffNode
+	entry    *diffEntry
+	counts   [diffSimilar + 1]int // number of entries of each kind within the node
+}
+
+func newDiffTree(entries []diffEntry) *diffNode {
+	root := &diffNode{path: "."}
+	dirs := map[string]*diffNode{".": root}
+
+	// getDir returns the node for the given directory path, creating it (and its parents) if needed
+	var getDir func(p string) *diffNode
+	getDir = func(p string) *diffNode {
+		if n, ok := dirs[p]; ok {
+			return n
+		}
+		parent := getDir(filepath.Dir(p))
+		n := &diffNode{name: filepath.Base(p), path: p}
+		parent.children = append(parent.children, n)
+		dirs[p] = n
+		return n
+	}
+
+	for i := range entries {
+		p := entries[i].path()
+		parent := getDir(filepath.Dir(p))
+		parent.children = append(parent.children, &diffNode{name: filepath.Base(p), path: p, entry: &entries[i]})
+		for n := parent; ; n = dirs[filepath.Dir(n.path)] {
+			n.counts[entries[i].kind]++
+			if n == root {
+				break
+			}
+		}
+	}
+	return root
+}
+
+type diffRow struct {
+	node  *diffNode
+	depth int
+}
+
+// detailView shows, for a PairSim, how the files of both directories relate to each other, as a side-by-side tree.
+type detailView struct {
+	pair   janitor.PairSim
+	root   *diffNode
+	folded map[string]bool // paths of folded directories
+	rows   []diffRow       // the currently visible rows
+	cursor int             // index within rows
+	offset int             // index within rows of the first row shown
+}
+
+func newDetailView(pair janitor.PairSim, a, b janitor.DirPrint, opts janitor.PairOpts) *detailView {
+	dv := &detailView{
+		pair:   pair,
+		root:   newDiffTree(diffDirPrints(a, b, opts)),
+		folded: make(map[string]bool),
+	}
+	dv.refresh()
+	return dv
+}
+
+// refresh recomputes the visible rows, taking folding into account
+func (dv *detailView) refresh() {
+	dv.rows = dv.rows[:0]
+	var add func(n *diffNode, depth int)
+	add = func(n *diffNode, depth int) {
+		for _, c := range n.children {
+			dv.rows = append(dv.rows, diffRow{node: c, depth: depth})
+			if c.entry == nil && !dv.folded[c.path] {
+				add(c, depth+1)
+			}
+		}
+	}
+	add(dv.root, 0)
+	if dv.cursor >= len(dv.rows) {
+		dv.cursor = len(dv.rows) - 1
+	}
+	if dv.cursor < 0 {
+		dv.cursor = 0
+	}
+}
+
+// update handles a key press. it returns false if the view should be closed
+func (dv *detailView) update(msg tea.KeyMsg, height int) bool {
+	page := dv.pageSize(height)
+	switch msg.String() {
+	case "esc", "q", "backspace":
+		return false
+	case "up", "k":
+		dv.cursor--
+	case "down", "j":
+		dv.cursor++
+	case "pgup":
+		dv.cursor -= page
+	case "pgdown":
+		dv.cursor += page
+	case "home", "g":
+		dv.cursor = 0
+	case "end", "G":
+		dv.cursor = len(dv.rows) - 1
+	case "enter", " ":
+		if len(dv.rows) > 0 && dv.rows[dv.cursor].node.entry == nil {
+			p := dv.rows[dv.cursor].node.path
+			dv.folded[p] = !dv.folded[p]
+			dv.refresh()
+		}
+	}
+	if dv.cursor >= len(dv.rows) {
+		dv.cursor = len(dv.rows) - 1
+	}
+	if dv.cursor < 0 {
+		dv.cursor = 0
+	}
+	// scroll such that the cursor is visible
+	if dv.cursor < dv.offset {
+		dv.offset = dv.cursor
+	}
+	if dv.cursor >= dv.offset+page {
+		dv.offset = dv.cursor - page + 1
+	}
+	return true
+}
+
+// target returns the paths (relative to the scan root) of the left and right item under the cursor.
+// files that only exist on one side have an empty path for the other side.
+func (dv *detailView) target() (string, string, bool) {
+	if len(dv.rows) == 0 {
+		return "", "", false
+	}
+	n := dv.rows[dv.cursor].node
+	if n.entry == nil {
+		return filepath.Join(dv.pair.Path1, n.path), filepath.Join(dv.pair.Path2, n.path), true
+	}
+	var left, right string
+	if n.entry.kind != diffRight {
+		left = filepath.Join(dv.pair.Path1, n.entry.left.Path)
+	}
+	if n.entry.kind != diffLeft {
+		right = filepath.Join(dv.pair.Path2, n.entry.right.Path)
+	}
+	return left, right, true
+}
+
+// detailHeaderLines is the number of lines used by the view, other than the rows
+const detailHeaderLines = 6
+
+func (dv *detailView) pageSize(height int) int {
+	if height <= detailHeaderLines {
+		// window size unknown (or tiny)
+		return 20
+	}
+	return height - detailHeaderLines
+}
+
+func (dv *detailView) view(width, height int) string {
+	if width <= 0 {
+		width = 120
+	}
+	colWidth := (width - 6) / 2
+
+	s := fmt.Sprintf("%s\n", dv.pair.Sim)
+	s += fmt.Sprintf("  %s %s\n", fit("L: "+dv.pair.Path1, colWidth), fit("R: "+dv.pair.Path2, colWidth))
+	s += helpStyle("legend: = same  ") + renamedStyle("R renamed") + "  " + leftOnlyStyle("< left only") + "  " + rightOnlyStyle("> right only") + "  " + changedStyle("≠ changed") + "  " + similarStyle("≈ similar image") + "\n\n"
+
+	end := dv.offset + dv.pageSize(height)
+	if end > len(dv.rows) {
+		end = len(dv.rows)
+	}
+	for i := dv.offset; i < end; i++ {
+		cursor := " "
+		if i == dv.cursor {
+			cursor = ">"
+		}
+		s += cursor + " " + dv.viewRow(dv.rows[i], colWidth) + "\n"
+	}
+
+	s += helpStyle("\n up/down/j/k/pgup/pgdown : scroll - enter/space: fold/unfold dir - t: triage dir - p: toggle preview - esc/q: back\n")
+	return s
+}
+
+func (dv *detailView) viewRow(r diffRow, colWidth int) string {
+	indent := strings.Repeat("  ", r.depth)
+	n := r.node
+	if n.entry == nil {
+		arrow := "▾"
+		if dv.folded[n.path] {
+			arrow = "▸"
+		}
+		c := n.counts
+		summary := fmt.Sprintf(" (=%d R%d <%d >%d ≠%d)", c[diffSame], c[diffRenamed], c[diffLeft], c[diffRight], c[diffChanged])
+		if c[diffSimilar] > 0 {
+			summary = fmt.Sprintf(" (=%d R%d <%d >%d ≠%d ≈%d)", c[diffSame], c[diffRenamed], c[diffLeft], c[diffRight], c[diffChanged], c[diffSimilar])
+		}
+		name := indent + arrow + " " + n.name + "/"
+		return fit(name+summary, colWidth) + "   " + fit(name, colWidth)
+	}
+
+	e := n.entry
+	left := indent + "  " + fmt.Sprintf("%s (%s)", n.name, humanBytes(e.left.Size))
+	right := indent + "  " + fmt.Sprintf("%s (%s)", n.name, humanBytes(e.right.Size))
+	switch e.kind {
+	case diffSame:
+		return fit(left, colWidth) + " = " + fit(right, colWidth)
+	case diffRenamed:
+		right = indent + "  " + fmt.Sprintf("%s (%s)", e.right.Path, humanBytes(e.right.Size))
+		return renamedStyle(fit(left, colWidth) + " R " + fit(right, colWidth))
+	case diffLeft:
+		return leftOnlyStyle(fit(left, colWidth) + " < " + fit("", colWidth))
+	case diffRight:
+		return rightOnlyStyle(fit("", colWidth) + " > " + fit(right, colWidth))
+	case diffSimilar:
+		right = indent + "  " + fmt.Sprintf("%s (%s)", e.right.Path, humanBytes(e.right.Size))
+		return similarStyle(fit(left, colWidth) + " ≈ " + fit(right, colWidth))
+	default:
+		return changedStyle(fit(left, colWidth) + " ≠ " + fit(right, colWidth))
+	}
+}
+
+// fit pads or truncates s to exactly w characters
+func fit(s string, w int) string {
+	r := []rune(s)
+	if len(r) > w {
+		if w < 1 {
+			return ""
+		}
+		return string(r[:w-1]) + "…"
+	}
+	return s + strings.Repeat(" ", w-len(r))
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffDirPrints(t *testing.T) {
+	a := janitor.DirPrint{
+		Path: "a",
+		Files: []janitor.FilePrint{
+			mkFilePrint("same", "same content\n"),
+			mkFilePrint("renamed", "renamed content\n"),
+			mkFilePrint("changed", "old content\n"),
+			mkFilePrint("left", "left content\n"),
+		},
+	}
+	b := janitor.DirPrint{
+		Path: "b",
+		Files: []janitor.FilePrint{
+			mkFilePrint("same", "same content\n"),
+			mkFilePrint("changed", "new content\n"),
+		},
+		Dirs: []janitor.DirPrint{
+			{
+				Path: "sub",
+				Files: []janitor.FilePrint{
+					mkFilePrint("renamed2", "renamed content\n"),
+					mkFilePrint("right", "right content\n"),
+				},
+			},
+		},
+	}
+
+	exp := []diffEntry{
+		{kind: diffChanged, left: mkFilePrint("changed", "old content\n"), right: mkFilePrint("changed", "new content\n")},
+		{kind: diffLeft, left: mkFilePrint("left", "left content\n")},
+		{kind: diffRenamed, left: mkFilePrint("renamed", "renamed content\n"), right: mkFilePrint("sub/renamed2", "renamed content\n")},
+		{kind: diffSame, left: mkFilePrint("same", "same content\n"), right: mkFilePrint("same", "same content\n")},
+		{kind: diffRight, right: mkFilePrint("sub/right", "right content\n")},
+	}
+
+	got := diffDirPrints(a, b, janitor.PairOpts{})
+	if diff := cmp.Diff(exp, got, cmp.AllowUnexported(diffEntry{})); diff != "" {
+		t.Errorf("diffDirPrints() mismatch (-want +got):\n%s", diff)
+	}
+
+	// the tree positions entries by their left path, if they have one. folding sub hides the right-only file
+	dv := newDetailView(janitor.PairSim{Path1: "a", Path2: "b"}, a, b, janitor.PairOpts{})
+	if len(dv.rows) != 6 {
+		t.Errorf("expected 6 rows (5 files and the sub dir), got %d", len(dv.rows))
+	}
+	if dv.root.counts != [6]int{1, 1, 1, 1, 1, 0} {
+		t.Errorf("expected one entry of each kind but similar, got %v", dv.root.counts)
+	}
+	dv.folded["sub"] = true
+	dv.refresh()
+	if len(dv.rows) != 5 {
+		t.Errorf("expected 5 rows after folding sub, got %d", len(dv.rows))
+	}
+}
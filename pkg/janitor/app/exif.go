@@ -0,0 +1,110 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+type exifTag struct {
+	name  string
+	value string
+}
+
+// exifTags are the (IFD0 and Exif IFD) tags we show in image previews
+var exifTags = map[uint16]string{
+	0x010f: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x0132: "DateTime",
+	0x9003: "DateTimeOriginal",
+}
+
+const exifIFDPointer = 0x8769
+
+// parseExif extracts a few interesting tags from the EXIF data of a JPEG file, given its first bytes.
+// it's a minimal parser that is not meant to be complete. Anything unexpected results in fewer (or no) tags.
+func parseExif(jpeg []byte) []exifTag {
+	tiff := findExif(jpeg)
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil
+	}
+	return parseIFD(tiff, order, order.Uint32(tiff[4:]), true)
+}
+
+// findExif returns the TIFF structure within the APP1 segment of a JPEG file, if any
+func findExif(b []byte) []byte {
+	if len(b) < 2 || b[0] != 0xff || b[1] != 0xd8 {
+		return nil
+	}
+	b = b[2:]
+	for len(b) >= 4 && b[0] == 0xff {
+		marker := b[1]
+		size := int(binary.BigEndian.Uint16(b[2:]))
+		if marker == 0xda || size < 2 || len(b) < 2+size {
+			// start of scan: no more metadata segments follow. or a truncated segment
+			return nil
+		}
+		segment := b[4 : 2+size]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		b = b[2+size:]
+	}
+	return nil
+}
+
+func parseIFD(tiff []byte, order binary.ByteOrder, offset uint32, followExif bool) []exifTag {
+	if int(offset)+2 > len(tiff) {
+		return nil
+	}
+	n := int(order.Uint16(tiff[offset:]))
+	var tags []exifTag
+	for i := 0; i < n; i++ {
+		e := int(offset) + 2 + i*12
+		if e+12 > len(tiff) {
+			break
+		}
+		id := order.Uint16(tiff[e:])
+		typ := order.Uint16(tiff[e+2:])
+		count := order.Uint32(tiff[e+4:])
+		if id == exifIFDPointer && followExif {
+			tags = append(tags, parseIFD(tiff, order, order.Uint32(tiff[e+8:]), false)...)
+			continue
+		}
+		name, ok := exifTags[id]
+		if !ok {
+			continue
+		}
+		switch typ {
+		case 2: // ASCII
+			value := tiff[e+8 : e+12]
+			if count > 4 {
+				off := order.Uint32(tiff[e+8:])
+				if uint64(off)+uint64(count) > uint64(len(tiff)) {
+					continue
+				}
+				value = tiff[off : off+count]
+			}
+			if int(count) < len(value) {
+				value = value[:count]
+			}
+			tags = append(tags, exifTag{name: name, value: string(bytes.TrimRight(value, "\x00 "))})
+		case 3: // SHORT
+			tags = append(tags, exifTag{name: name, value: fmt.Sprint(order.Uint16(tiff[e+8:]))})
+		}
+	}
+	return tags
+}
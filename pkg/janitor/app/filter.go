@@ -0,0 +1,110 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+)
+
+// filterBytesSteps are the values the minimum shared bytes filter steps through
+var filterBytesSteps = []int64{0, 1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20, 1 << 30, 10 << 30}
+
+// filterFields are the filters that can be adjusted in the UI, in the order that f cycles through them
+var filterFields = []struct {
+	view   func(f janitor.Filter) string
+	adjust func(f *janitor.Filter, up bool) // raises or lowers the minimum by one step
+}{
+	{
+		func(f janitor.Filter) string { return fmt.Sprintf("content >= %.0f%%", f.MinContent*100) },
+		func(f *janitor.Filter, up bool) { f.MinContent = stepFraction(f.MinContent, up) },
+	},
+	{
+		func(f janitor.Filter) string { return "shared >= " + humanBytes(f.MinBytes) },
+		func(f *janitor.Filter, up bool) { f.MinBytes = stepBytes(f.MinBytes, up) },
+	},
+	{
+		func(f janitor.Filter) string { return fmt.Sprintf("files >= %d", f.MinFiles) },
+		func(f *janitor.Filter, up bool) {
+			if up {
+				f.MinFiles++
+			} else if f.MinFiles > 0 {
+				f.MinFiles--
+			}
+		},
+	},
+	{
+		func(f janitor.Filter) string { return fmt.Sprintf("path >= %.1f", f.MinPath) },
+		func(f *janitor.Filter, up bool) { f.MinPath = stepFraction(f.MinPath, up) },
+	},
+}
+
+// stepFraction raises or lowers v to the next multiple of 0.1, within [0, 1]
+func stepFraction(v float64, up bool) float64 {
+	tenths := v * 10
+	if up {
+		tenths = float64(int(tenths+1e-9) + 1)
+	} else {
+		tenths = float64(int(tenths-1e-9+1) - 1)
+	}
+	if tenths < 0 {
+		tenths = 0
+	}
+	if tenths > 10 {
+		tenths = 10
+	}
+	return tenths / 10
+}
+
+// stepBytes raises or lowers v to the next of the filterBytesSteps
+func stepBytes(v int64, up bool) int64 {
+	if up {
+		for _, s := range filterBytesSteps {
+			if s > v {
+				return s
+			}
+		}
+		return v
+	}
+	for i := len(filterBytesSteps) - 1; i >= 0; i-- {
+		if filterBytesSteps[i] < v {
+			return filterBytesSteps[i]
+		}
+	}
+	return 0
+}
+
+// updateFilter handles the keys to adjust the filters. It returns false if the key is not one of them.
+func (m *model) updateFilter(key string) bool {
+	switch key {
+	case "f":
+		m.filterFocus = (m.filterFocus + 1) % len(filterFields)
+	case "+", "=":
+		filterFields[m.filterFocus].adjust(&m.filter, true)
+	case "-":
+		filterFields[m.filterFocus].adjust(&m.filter, false)
+	case "F":
+		m.filter = janitor.Filter{}
+	default:
+		return false
+	}
+	m.listPairs(m.sortOrder)
+	return true
+}
+
+// viewFilter renders the filters, highlighting the one that can be adjusted, and how many pairs they hide
+func (m *model) viewFilter() string {
+	var fields []string
+	for i, ff := range filterFields {
+		s := ff.view(m.filter)
+		if i == m.filterFocus {
+			s = activeTabStyle(s)
+		}
+		fields = append(fields, s)
+	}
+	s := "filters: " + strings.Join(fields, " | ")
+	if hidden := len(m.pairSims) - len(m.order); hidden > 0 {
+		s += fmt.Sprintf(" - %d pairs hidden", hidden)
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package app
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStepFilters(t *testing.T) {
+	fractions := []struct {
+		v    float64
+		up   bool
+		want float64
+	}{
+		{0, true, 0.1},
+		{0.1, true, 0.2},
+		{0.45, true, 0.5},
+		{1, true, 1},
+		{0.5, false, 0.4},
+		{0.45, false, 0.4},
+		{0.1, false, 0},
+		{0, false, 0},
+	}
+	for _, c := range fractions {
+		if got := stepFraction(c.v, c.up); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("stepFraction(%v, %v) = %v, expected %v", c.v, c.up, got, c.want)
+		}
+	}
+	bytes := []struct {
+		v    int64
+		up   bool
+		want int64
+	}{
+		{0, true, 1 << 10},
+		{1 << 10, true, 10 << 10},
+		{5000, true, 10 << 10},
+		{10 << 30, true, 10 << 30},
+		{5000, false, 1 << 10},
+		{1 << 10, false, 0},
+		{0, false, 0},
+	}
+	for _, c := range bytes {
+		if got := stepBytes(c.v, c.up); got != c.want {
+			t.Errorf("stepBytes(%v, %v) = %v, expected %v", c.v, c.up, got, c.want)
+		}
+	}
+}
+
+// TestUpdateFilter tests that adjusting the filters in the UI hides and shows pairs, and counts the hidden ones
+func TestUpdateFilter(t *testing.T) {
+	m := newModel(nil, nil, nil, nil, "", scanSettings{}, nil, nil)
+	m.pairSims = []janitor.PairSim{
+		{Path1: "a", Path2: "b", Sim: janitor.Similarity{BytesSame: 10, BytesDiff: 90, FilesSame: 1}},
+		{Path1: "c", Path2: "d", Sim: janitor.Similarity{BytesSame: 3000, FilesSame: 3, PathSim: 1}},
+		{Path1: "e", Path2: "f", Sim: janitor.Similarity{BytesSame: 20, FilesSame: 2, PathSim: 0.5}},
+	}
+	m.listPairs(0)
+	m.cursor = 1
+
+	press := func(keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			msg, ok := parseKey(key)
+			if !ok {
+				t.Fatalf("invalid key %q", key)
+			}
+			res, _ := m.Update(msg)
+			m = res.(model)
+		}
+	}
+	press("+", "+") // content >= 20%
+	if diff := cmp.Diff([]int{1, 2}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	if i, _ := m.current(); i != 1 {
+		t.Errorf("expected the cursor to stay on pair 1, got %d", i)
+	}
+	if !strings.Contains(m.viewFilter(), "1 pairs hidden") {
+		t.Errorf("expected 1 hidden pair, got %q", m.viewFilter())
+	}
+
+	press("f", "+") // shared >= 1 KiB
+	if diff := cmp.Diff([]int{1}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	press("-", "f", "+", "+", "+") // shared >= 0, files >= 3
+	if diff := cmp.Diff([]int{1}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	press("-", "f", "+", "+", "+", "+", "+", "+") // files >= 2, path >= 0.6
+	if diff := cmp.Diff(janitor.Filter{MinContent: 0.2, MinFiles: 2, MinPath: 0.6}, m.filter); diff != "" {
+		t.Errorf("filter mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{1}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+
+	press("F")
+	if diff := cmp.Diff([]int{0, 1, 2}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	if strings.Contains(m.viewFilter(), "hidden") {
+		t.Errorf("expected no hidden pairs, got %q", m.viewFilter())
+	}
+}
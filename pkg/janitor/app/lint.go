@@ -0,0 +1,266 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// LintKind is a type of lint: files and directories that are most likely useless
+type LintKind int
+
+const (
+	LintEmptyFile  LintKind = iota // a zero-byte file
+	LintEmptyDir                   // a directory without any files or directories in it
+	LintCorruptZip                 // a zip file that can't be read. It is fingerprinted as a regular file instead
+	LintBackup                     // a backup or swap file left behind by an editor
+	LintPartial                    // a leftover of an unfinished download
+	LintJunk                       // metadata created by operating systems, such as .DS_Store and __MACOSX
+)
+
+var lintNames = [...]string{
+	LintEmptyFile:  "empty file",
+	LintEmptyDir:   "empty directory",
+	LintCorruptZip: "corrupt zip file",
+	LintBackup:     "editor backup file",
+	LintPartial:    "partial download",
+	LintJunk:       "OS junk",
+}
+
+func (k LintKind) String() string {
+	return lintNames[k]
+}
+
+// Finding is a lint finding of a walk
+type Finding struct {
+	Kind   LintKind
+	Path   string // path within the walked directory. May be within a zip file
+	Size   int64  // size of the file. 0 for directories
+	Detail string // additional information, e.g. why a zip file is corrupt
+}
+
+// junkNames are files and directories created by operating systems, that have no use to the user
+var junkNames = map[string]bool{
+	"__MACOSX":  true,
+	".DS_Store": true,
+	"Thumbs.db": true,
+}
+
+// lintFile returns what kind of lint the file with the given name and size is, if any.
+// When multiple kinds apply, the most specific one is returned. (e.g. a .DS_Store file is junk, whether empty or not)
+func lintFile(name string, size int64) (LintKind, bool) {
+	switch {
+	case junkNames[name]:
+		return LintJunk, true
+	case strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".crdownload"):
+		return LintPartial, true
+	case isBackupFile(name):
+		return LintBackup, true
+	case size == 0:
+		return LintEmptyFile, true
+	}
+	return 0, false
+}
+
+// isBackupFile returns whether the file name looks like one created by editors (emacs, vim and the like)
+func isBackupFile(name string) bool {
+	switch {
+	case len(name) > 1 && strings.HasSuffix(name, "~"):
+		return true
+	case len(name) > 2 && strings.HasPrefix(name, "#") && strings.HasSuffix(name, "#"):
+		return true
+	case strings.HasPrefix(name, ".") && (strings.HasSuffix(name, ".swp") || strings.HasSuffix(name, ".swo")):
+		return true
+	}
+	switch filepath.Ext(name) {
+	case ".bak", ".orig":
+		return true
+	}
+	return false
+}
+
+// lintView lists the lint findings of a scan, grouped by kind, and allows acting on many of them at once.
+type lintView struct {
+	findings []Finding
+	selected map[int]struct{} // by index within findings
+	outcome  map[int]string   // outcome of the action on the finding, by index within findings
+	cursor   int
+	offset   int // index within findings of the first one shown
+}
+
+func newLintView(findings []Finding) *lintView {
+	lv := &lintView{
+		findings: append([]Finding(nil), findings...),
+		selected: make(map[int]struct{}),
+		outcome:  make(map[int]string),
+	}
+	// the walk reports findings in lexical order. keep that order within each kind
+	sort.SliceStable(lv.findings, func(i, j int) bool {
+		return lv.findings[i].Kind < lv.findings[j].Kind
+	})
+	return lv
+}
+
+// toggleKind selects all findings of the same kind as the one under the cursor, or deselects them if they all are selected already.
+func (lv *lintView) toggleKind() {
+	if len(lv.findings) == 0 {
+		return
+	}
+	kind := lv.findings[lv.cursor].Kind
+	all := true
+	for i, fi := range lv.findings {
+		if _, ok := lv.selected[i]; fi.Kind == kind && !ok {
+			all = false
+		}
+	}
+	for i, fi := range lv.findings {
+		if fi.Kind != kind {
+			continue
+		}
+		if all {
+			delete(lv.selected, i)
+		} else {
+			lv.selected[i] = struct{}{}
+		}
+	}
+}
+
+// updateLint handles a key press in the lint tab
+func (m *model) updateLint(msg tea.KeyMsg) {
+	lv := m.lint
+	switch key := msg.String(); key {
+	case "up", "k":
+		if lv.cursor > 0 {
+			lv.cursor--
+		}
+	case "down", "j":
+		if lv.cursor < len(lv.findings)-1 {
+			lv.cursor++
+		}
+	case " ":
+		if len(lv.findings) == 0 {
+			break
+		}
+		if _, ok := lv.selected[lv.cursor]; ok {
+			delete(lv.selected, lv.cursor)
+		} else {
+			lv.selected[lv.cursor] = struct{}{}
+		}
+	case "a":
+		lv.toggleKind()
+	case "d":
+		m.actOnLint("trashed", trashTo)
+	default:
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 1 || n > len(m.bookmarks) {
+			break
+		}
+		dest := m.bookmarks[n-1]
+		m.actOnLint("moved to "+dest, func(abs string) (string, error) {
+			return move(abs, dest)
+		})
+	}
+
+	if lv.cursor < lv.offset {
+		lv.offset = lv.cursor
+	}
+	if page := m.lintPageSize(); lv.cursor >= lv.offset+page {
+		lv.offset = lv.cursor - page + 1
+	}
+}
+
+// actOnLint executes the action on the absolute paths of all selected findings, and deselects them.
+func (m *model) actOnLint(outcome string, action func(abs string) (string, error)) {
+	lv := m.lint
+	var todo []int
+	for i := range lv.selected {
+		todo = append(todo, i)
+	}
+	sort.Ints(todo)
+	for _, i := range todo {
+		fi := lv.findings[i]
+		delete(lv.selected, i)
+		if m.inArchive(filepath.Dir(fi.Path)) {
+			lv.outcome[i] = "can't act on entries within a zip file"
+			continue
+		}
+		abs := filepath.Join(m.scanRoot, fi.Path)
+		target, err := action(abs)
+		if err != nil {
+			fmt.Fprintln(m.log, "ERR lint:", abs, err)
+			lv.outcome[i] = "failed: " + err.Error()
+			continue
+		}
+		fmt.Fprintln(m.log, "INF lint:", abs, outcome)
+		lv.outcome[i] = outcome
+		m.relocated(fi.Path, target)
+	}
+}
+
+// lintPageSize returns how many findings fit on the screen.
+func (m *model) lintPageSize() int {
+	// we need about 8 lines for the header and help text.
+	if m.height <= 0 || m.height-8 < 1 {
+		return len(m.lint.findings) + 1
+	}
+	return m.height - 8
+}
+
+func (m *model) viewLint() string {
+	lv := m.lint
+	counts := make(map[LintKind]int)
+	for _, fi := range lv.findings {
+		counts[fi.Kind]++
+	}
+	var summary []string
+	for k := range lintNames {
+		if n := counts[LintKind(k)]; n > 0 {
+			summary = append(summary, fmt.Sprintf("%d %s", n, LintKind(k)))
+		}
+	}
+	s := m.viewTabs() + "\n\n"
+	if len(lv.findings) == 0 {
+		s += "nothing\n"
+	} else {
+		s += strings.Join(summary, ", ") + "\n\n"
+	}
+
+	end := lv.offset + m.lintPageSize()
+	if end > len(lv.findings) {
+		end = len(lv.findings)
+	}
+	w := m.previewWidth()
+	for i := lv.offset; i < end; i++ {
+		fi := lv.findings[i]
+		cursor := " "
+		if i == lv.cursor {
+			cursor = ">"
+		}
+		checked := " "
+		if _, ok := lv.selected[i]; ok {
+			checked = "x"
+		}
+		size := ""
+		if fi.Size > 0 {
+			size = humanBytes(fi.Size)
+		}
+		line := fmt.Sprintf("%s [%s] %-18s %10s  %s", cursor, checked, fi.Kind, size, fi.Path)
+		if fi.Detail != "" {
+			line += helpStyle(" (" + fi.Detail + ")")
+		}
+		if o, ok := lv.outcome[i]; ok {
+			line = fit(line, w-30) + " " + renamedStyle("["+o+"]")
+		}
+		s += line + "\n"
+	}
+
+	help := "\n up/down/j/k: navigate - space: select - a: select all of this kind - d: trash selected"
+	for i, b := range m.bookmarks {
+		help += fmt.Sprintf(" - %d: move selected to %s", i+1, b)
+	}
+	return s + helpStyle(help+" - tab: copies - q: quit\n")
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/Dieterbe/janitor/pkg/janitor/mkzip"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLintFile(t *testing.T) {
+	cases := []struct {
+		name string
+		size int64
+		kind LintKind
+		ok   bool
+	}{
+		{"notes.txt", 10, 0, false},
+		{"notes.txt", 0, LintEmptyFile, true},
+		{".DS_Store", 0, LintJunk, true},
+		{"Thumbs.db", 100, LintJunk, true},
+		{"movie.mkv.part", 100, LintPartial, true},
+		{"setup.exe.crdownload", 100, LintPartial, true},
+		{"notes.txt~", 10, LintBackup, true},
+		{"#notes.txt#", 10, LintBackup, true},
+		{".notes.txt.swp", 10, LintBackup, true},
+		{"main.go.orig", 10, LintBackup, true},
+		{"~", 10, 0, false},
+		{"#", 10, 0, false},
+	}
+	for _, c := range cases {
+		kind, ok := lintFile(c.name, c.size)
+		if kind != c.kind || ok != c.ok {
+			t.Errorf("lintFile(%q, %d) = %v, %t - expected %v, %t", c.name, c.size, kind, ok, c.kind, c.ok)
+		}
+	}
+}
+
+func TestWalkLint(t *testing.T) {
+	zipData, _ := mkzip.MustDo([]mkzip.Entry{
+		{Path: "doc.txt", Body: "hello"},
+		{Path: "doc.txt~", Body: "hell"},
+	})
+	f := fstest.MapFS{
+		"a/empty.txt":           {Data: []byte{}},
+		"a/.DS_Store":           {Data: []byte("junk")},
+		"a/__MACOSX/._foo":      {Data: []byte("junk")},
+		"b":                     {Mode: fs.ModeDir},
+		"c/bad.zip":             {Data: []byte("not a zip file")},
+		"c/good.zip":            {Data: zipData},
+		"c/movie.mkv.part":      {Data: []byte("movi")},
+		"c/regular.txt":         {Data: []byte("regular")},
+		"d/e/setup.crdownload":  {Data: []byte("setup")},
+		"d/e/notes.txt":         {Data: []byte("notes")},
+		"d/e/.notes.txt.swp":    {Data: []byte("notes")},
+		"d/e/#notes.txt#":       {Data: []byte("note")},
+		"d/nothing-to-see-here": {Data: []byte("nothing")},
+	}
+	var got []Finding
+	opts := Opts{
+		Lint: func(fi Finding) {
+			got = append(got, fi)
+		},
+	}
+	_, all, err := WalkFSContext(context.Background(), f, "/test/in-memory/lint", janitor.Sha256FingerPrint, ioutil.Discard, opts)
+	if err != nil {
+		t.Fatalf("WalkFSContext() unexpected error %v", err)
+	}
+	exp := []Finding{
+		{Kind: LintJunk, Path: "a/.DS_Store", Size: 4},
+		{Kind: LintJunk, Path: "a/__MACOSX"},
+		{Kind: LintEmptyFile, Path: "a/empty.txt"},
+		{Kind: LintEmptyDir, Path: "b"},
+		{Kind: LintCorruptZip, Path: "c/bad.zip", Size: 14, Detail: "zip: not a valid zip file"},
+		{Kind: LintBackup, Path: "c/good.zip/doc.txt~", Size: 4},
+		{Kind: LintPartial, Path: "c/movie.mkv.part", Size: 4},
+		{Kind: LintBackup, Path: "d/e/#notes.txt#", Size: 4},
+		{Kind: LintBackup, Path: "d/e/.notes.txt.swp", Size: 5},
+		{Kind: LintPartial, Path: "d/e/setup.crdownload", Size: 5},
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("lint findings mismatch (-want +got):\n%s", diff)
+	}
+
+	// the corrupt zip file should be fingerprinted as a regular file, not break the walk of its directory
+	var files []string
+	for _, fp := range all["c"].Files {
+		files = append(files, fp.Path)
+	}
+	sort.Strings(files)
+	if diff := cmp.Diff([]string{"bad.zip", "movie.mkv.part", "regular.txt"}, files); diff != "" {
+		t.Errorf("files of c mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLintViewToggleKind(t *testing.T) {
+	lv := newLintView([]Finding{
+		{Kind: LintJunk, Path: "a/.DS_Store"},
+		{Kind: LintEmptyFile, Path: "a/empty.txt"},
+		{Kind: LintJunk, Path: "b/Thumbs.db"},
+	})
+	// sorted by kind, but otherwise in the original order
+	exp := []string{"a/empty.txt", "a/.DS_Store", "b/Thumbs.db"}
+	var got []string
+	for _, fi := range lv.findings {
+		got = append(got, fi.Path)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("newLintView() mismatch (-want +got):\n%s", diff)
+	}
+
+	lv.cursor = 1
+	lv.selected[2] = struct{}{}
+	lv.toggleKind()
+	if diff := cmp.Diff(map[int]struct{}{1: {}, 2: {}}, lv.selected); diff != "" {
+		t.Errorf("toggleKind() mismatch (-want +got):\n%s", diff)
+	}
+	lv.toggleKind()
+	if len(lv.selected) != 0 {
+		t.Errorf("toggleKind() expected all to be deselected, got %v", lv.selected)
+	}
+}
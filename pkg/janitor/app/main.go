@@ -1,26 +1,376 @@
 package app
 
 import (
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/Dieterbe/janitor/pkg/janitor"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// stringsFlag is a flag that can be specified multiple times
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 func Run() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: janitor <path> [<path>...]")
+	var offline, bookmarks, excludes, preferRoots stringsFlag
+	flag.Var(&offline, "offline", "snapshot file of an offline volume to compare against (may be repeated)")
+	flag.Var(&bookmarks, "bookmark", "directory to offer as destination for moving files during triage (may be repeated)")
+	saveSnapshot := flag.String("save-snapshot", "", "scan the path and save it as a snapshot to this file, rather than starting the UI")
+	explain := flag.Bool("explain", false, "compare the 2 given directories and explain their similarity file by file, rather than starting the UI")
+	nearDuplicates := flag.Bool("near-duplicates", false, "list the pairs of files within the given path that have most of their content in common, rather than starting the UI (uses the sha256-chunked fingerprint)")
+	minOverlap := flag.Float64("min-overlap", 0.5, "with -near-duplicates: the minimum fraction of the largest file of a pair that both files have in common")
+	plan := flag.Bool("plan", false, "list which copy of each group of copies within the given path to keep, and which to remove, rather than starting the UI. nothing is removed")
+	keeper := flag.String("keeper", "", "comma separated rules to choose the copy to keep with, by priority: "+strings.Join(keeperRuleNames(), ", ")+" (default: "+strings.Join(janitor.DefaultKeeper.Rules, ",")+")")
+	flag.Var(&preferRoots, "prefer-root", "keep copies within this directory over all others (may be repeated)")
+	label := flag.String("label", "", "label of the volume when saving a snapshot (default: the scanned path)")
+	flag.Var(&excludes, "exclude", "gitignore-style pattern of files and directories to leave out of the scan (may be repeated)")
+	minSize := flag.Int64("min-size", 0, "leave out files smaller than this many bytes")
+	maxSize := flag.Int64("max-size", 0, "leave out files larger than this many bytes (0 means no limit)")
+	skipCommon := flag.Bool("skip-common-dirs", false, "don't descend into directories with generated or downloaded content: "+strings.Join(janitor.CommonSkipDirs, " "))
+	workers := flag.Int("workers", 1, "number of files to fingerprint concurrently")
+	imageDistance := flag.Int("image-distance", janitor.DefaultImageDistance, "maximum number of bits that the perceptual hashes of images may differ in, to count them as similar (with the sha256-image fingerprint). -1 disables")
+	fingerprint := flag.String("fingerprint", "sha256", "how to fingerprint files: "+strings.Join(fingerprinterNames(), ", "))
+	pathMetric := flag.String("path-metric", "hamming", "how to compare the paths of matching files: "+strings.Join(metricNames(), ", "))
+	rulesPath := flag.String("rules", "", "file to remember decisions in, and suggest them from (default: rules.json in the user config dir)")
+	configPath := flag.String("config", "", "config file with default options (default: config in the janitor dir of the user config dir)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: janitor [flags] <path> [<path>...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *configPath == "" {
+		var err error
+		*configPath, err = configFile()
+		perr(err)
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not load config:", err)
+		os.Exit(1)
+	}
+	// flags that were given take precedence over the config
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "min-size":
+			cfg.Ignore.MinSize = *minSize
+		case "max-size":
+			cfg.Ignore.MaxSize = *maxSize
+		case "skip-common-dirs":
+			cfg.Ignore.SkipCommonDirs = *skipCommon
+		case "workers":
+			cfg.Workers = *workers
+		case "fingerprint":
+			cfg.Fingerprint = *fingerprint
+		case "path-metric":
+			cfg.PathMetric = *pathMetric
+		case "image-distance":
+			cfg.ImageDistance = *imageDistance
+		case "keeper":
+			cfg.Clusters.Keeper = nil
+			if *keeper != "" {
+				cfg.Clusters.Keeper = strings.Split(*keeper, ",")
+			}
+		case "prefer-root":
+			cfg.Clusters.PreferredRoots = preferRoots
+		}
+	})
+	err = cfg.Validate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	scanPaths := flag.Args()
+	if len(scanPaths) == 0 {
+		scanPaths = cfg.ScanPaths
+	}
+	if len(scanPaths) < 1 {
+		flag.Usage()
 		os.Exit(1)
 	}
 
-	log, err := tea.LogToFile("janitor.log", "")
+	logFile, err := tea.LogToFile(cfg.Log.File, "")
 	perr(err)
-	defer log.Close()
+	defer logFile.Close()
+	log := newLevelWriter(logFile, cfg.Log.Level)
+
+	ignore, err := cfg.newIgnore(excludes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not load ignore rules:", err)
+		os.Exit(1)
+	}
+	settings := scanSettings{
+		ignore:  ignore,
+		fpr:     janitor.FingerPrinters[cfg.Fingerprint],
+		fprName: cfg.Fingerprint,
+		workers: cfg.Workers,
+		pairs: janitor.PairOpts{
+			PathMetric:    janitor.PathMetrics[cfg.PathMetric],
+			ImageDistance: &cfg.ImageDistance,
+		},
+		weights:  cfg.weights(),
+		order:    pairOrderNames[cfg.Sort],
+		filter:   cfg.Filter,
+		clusters: cfg.clusterOpts(),
+	}
+
+	if *saveSnapshot != "" {
+		err := doSaveSnapshot(scanPaths[0], *label, *saveSnapshot, settings, log)
+		if err != nil {
+			fmt.Fprintf(log, "ERROR could not save snapshot: %v - shutting down", err)
+			fmt.Fprintln(os.Stderr, "could not save snapshot:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *explain {
+		if len(flag.Args()) != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		err := doExplain(flag.Arg(0), flag.Arg(1), settings, log, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(log, "ERROR could not compare: %v - shutting down", err)
+			fmt.Fprintln(os.Stderr, "could not compare:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *nearDuplicates {
+		settings.fpr, settings.fprName = janitor.FingerPrinters["sha256-chunked"], "sha256-chunked"
+		err := doNearDuplicates(scanPaths[0], *minOverlap, settings, log, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(log, "ERROR could not find near-duplicates: %v - shutting down", err)
+			fmt.Fprintln(os.Stderr, "could not find near-duplicates:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *plan {
+		err := doPlan(scanPaths[0], settings, log, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(log, "ERROR could not plan: %v - shutting down", err)
+			fmt.Fprintln(os.Stderr, "could not plan:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var snaps []janitor.Snapshot
+	for _, o := range offline {
+		snap, err := loadSnapshot(o)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "could not load snapshot:", err)
+			os.Exit(1)
+		}
+		if snap.Fingerprint != cfg.Fingerprint {
+			fmt.Fprintf(os.Stderr, "snapshot %s was taken with the %s fingerprint: use -fingerprint %s to compare with it\n", o, snap.Fingerprint, snap.Fingerprint)
+			os.Exit(1)
+		}
+		snaps = append(snaps, snap)
+	}
+
+	var bookmarkDirs []string
+	for _, b := range bookmarks {
+		dir, err := filepath.Abs(b)
+		perr(err)
+		bookmarkDirs = append(bookmarkDirs, dir)
+	}
+
+	if *rulesPath == "" {
+		*rulesPath, err = rulesFile()
+		perr(err)
+	}
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "could not load rules:", err)
+		os.Exit(1)
+	}
 
-	p := tea.NewProgram(newModel(os.Args[1:], log), tea.WithAltScreen())
+	applyTheme(cfg.Theme)
+	p := tea.NewProgram(newModel(scanPaths, snaps, bookmarkDirs, rules, *rulesPath, settings, cfg.keyMap(), log), tea.WithAltScreen())
 	if err := p.Start(); err != nil {
 		fmt.Fprintf(log, "ERROR there's been an error: %v - shutting down", err)
 		os.Exit(1)
 	}
 	fmt.Fprintln(log, "INF closing")
 }
+
+func doSaveSnapshot(scanPath, label, file string, settings scanSettings, log io.Writer) error {
+	dir, err := filepath.Abs(scanPath)
+	if err != nil {
+		return err
+	}
+	if label == "" {
+		label = dir
+	}
+	root, _, err := WalkFSContext(context.Background(), os.DirFS(dir), dir, settings.fpr, log, settings.opts())
+	if err != nil {
+		return err
+	}
+	snap := janitor.Snapshot{
+		Label: label,
+		Path:  dir,
+		Taken: time.Now(),
+		Root:  root,
+
+		Fingerprint: settings.fprName,
+	}
+	fd, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = snap.Save(fd)
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
+
+// doExplain walks both directories and writes their comparison to w
+func doExplain(path1, path2 string, settings scanSettings, log, w io.Writer) error {
+	var roots []janitor.DirPrint
+	for _, p := range []string{path1, path2} {
+		dir, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		root, _, err := WalkFSContext(context.Background(), os.DirFS(dir), dir, settings.fpr, log, settings.opts())
+		if err != nil {
+			return err
+		}
+		roots = append(roots, root)
+	}
+	return writeComparison(w, janitor.CompareOpts(roots[0], roots[1], settings.pairs))
+}
+
+// writeComparison writes the comparison in a format that is easy to process with scripts: a line per file, with tab separated fields:
+//
+//	matched <size> <path similarity> <path in A> <path in B>
+//	normalized <size> <path similarity> <path in A> <path in B> (matched, but only after normalization, see janitor.TextFingerPrint)
+//	changed <size in A> <size in B> <path>
+//	only-a  <size> <path in A>
+//	only-b  <size> <path in B>
+//	similar <size in A> <size in B> <distance> <path in A> <path in B>
+//
+// followed by a summary line with the similarity.
+func writeComparison(w io.Writer, c janitor.Comparison) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range c.Matched {
+		kind := "matched"
+		if m.Normalized() {
+			kind = "normalized"
+		}
+		fmt.Fprintf(bw, "%s\t%d\t%.2f\t%s\t%s\n", kind, m.A.Size, m.PathSim, m.A.Path, m.B.Path)
+	}
+	for _, ch := range c.Changed {
+		fmt.Fprintf(bw, "changed\t%d\t%d\t%s\n", ch.A.Size, ch.B.Size, ch.A.Path)
+	}
+	for _, f := range c.OnlyA {
+		fmt.Fprintf(bw, "only-a\t%d\t%s\n", f.Size, f.Path)
+	}
+	for _, f := range c.OnlyB {
+		fmt.Fprintf(bw, "only-b\t%d\t%s\n", f.Size, f.Path)
+	}
+	for _, si := range c.Similar {
+		fmt.Fprintf(bw, "similar\t%d\t%d\t%d\t%s\t%s\n", si.A.Size, si.B.Size, si.Distance, si.A.Path, si.B.Path)
+	}
+	fmt.Fprintln(bw, c.Similarity())
+	return bw.Flush()
+}
+
+// doNearDuplicates walks the directory and writes the pairs of files that have at least minOverlap of their content in common to w,
+// one tab separated line per pair:
+//
+//	<overlap> <shared bytes> <size of A> <size of B> <path of A> <path of B>
+//
+// settings.fpr should be a chunked fingerprinter, as files without chunks are never near-duplicates.
+func doNearDuplicates(path string, minOverlap float64, settings scanSettings, log, w io.Writer) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	root, _, err := WalkFSContext(context.Background(), os.DirFS(dir), dir, settings.fpr, log, settings.opts())
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, nd := range janitor.NearDuplicates(root, minOverlap) {
+		fmt.Fprintf(bw, "%.2f\t%d\t%d\t%d\t%s\t%s\n", nd.Overlap, nd.SharedBytes, nd.A.Size, nd.B.Size, nd.A.Path, nd.B.Path)
+	}
+	return bw.Flush()
+}
+
+// doPlan walks the directory and writes which copy of each group of copies to keep, and which to remove, to w.
+// Each group is a tab separated line per copy, followed by an empty line:
+//
+//	keep   <size> <path> <reason>
+//	remove <size> <path>
+//	review <size> <path>
+//
+// followed by a summary line. The paths are absolute. Copies to review are merely similar, or nested with a copy to keep (see janitor.Plan).
+// Note that copies within zip files can't be removed by themselves.
+func doPlan(path string, settings scanSettings, log, w io.Writer) error {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	_, all, err := WalkFSContext(context.Background(), os.DirFS(dir), dir, settings.fpr, log, settings.opts())
+	if err != nil {
+		return err
+	}
+	pairSims, err := janitor.GetPairSimsContext(context.Background(), all, settings.pairs, log)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	var total int64
+	clusters := janitor.Clusters(all, pairSims, settings.clusterOpts(dir))
+	for _, d := range janitor.Plan(clusters) {
+		reason := d.Reason
+		if reason == "" {
+			reason = "-"
+		}
+		fmt.Fprintf(bw, "keep\t%d\t%s\t%s\n", d.Keep.Size, filepath.Join(dir, d.Keep.Path), reason)
+		for _, m := range d.Remove {
+			fmt.Fprintf(bw, "remove\t%d\t%s\n", m.Size, filepath.Join(dir, m.Path))
+		}
+		for _, m := range d.Review {
+			fmt.Fprintf(bw, "review\t%d\t%s\n", m.Size, filepath.Join(dir, m.Path))
+		}
+		fmt.Fprintln(bw)
+		total += d.Reclaimable()
+	}
+	fmt.Fprintf(bw, "%d groups of copies, %s reclaimable\n", len(clusters), humanBytes(total))
+	return bw.Flush()
+}
+
+func loadSnapshot(file string) (janitor.Snapshot, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return janitor.Snapshot{}, err
+	}
+	defer fd.Close()
+	return janitor.LoadSnapshot(fd)
+}
@@ -0,0 +1,67 @@
+package app
+
+import "github.com/Dieterbe/janitor/pkg/janitor"
+
+// pairOrder is an order in which the pairs can be listed
+type pairOrder struct {
+	name    string
+	weights *janitor.Weights // nil means the order of janitor.GetPairSims. (from least to most similar)
+}
+
+// pairOrders returns the orders the user can cycle through. score is the order by the configured weights
+func pairOrders(score janitor.Weights) []pairOrder {
+	return []pairOrder{
+		{"least similar first", nil},
+		{"highest score first", &score},
+		{"most reclaimable space first", &janitor.Weights{Bytes: 1}},
+		{"most identical first", &janitor.Weights{Content: 1, Path: 0.01}},
+		{"smallest first", &janitor.Weights{Bytes: -1}},
+	}
+}
+
+// pairOrderNames maps the names of the orders, as used in the config, to their index within pairOrders
+var pairOrderNames = map[string]int{
+	"similarity":  0,
+	"score":       1,
+	"reclaimable": 2,
+	"identical":   3,
+	"smallest":    4,
+}
+
+// listPairs lists the pairs that pass the filter in the given order (index within pairOrders), keeping the cursor on the same pair if it's still listed.
+// Selections and decisions are by index within pairSims, so they are unaffected.
+func (m *model) listPairs(order int) {
+	cur, hasCur := m.current()
+	m.sortOrder = order
+	var all []int
+	if o := pairOrders(m.weights)[order]; o.weights != nil {
+		all = o.weights.Rank(m.pairSims)
+	} else {
+		for i := range m.pairSims {
+			all = append(all, i)
+		}
+	}
+	m.order = nil
+	for _, i := range all {
+		if m.filter.Match(m.pairSims[i].Sim) {
+			m.order = append(m.order, i)
+		}
+	}
+	m.cursor = 0
+	if hasCur {
+		for row, i := range m.order {
+			if i == cur {
+				m.cursor = row
+			}
+		}
+	}
+	m.offset = 0
+}
+
+// current returns the index within pairSims of the pair under the cursor
+func (m *model) current() (int, bool) {
+	if m.cursor >= len(m.order) {
+		return 0, false
+	}
+	return m.order[m.cursor], true
+}
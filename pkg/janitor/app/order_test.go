@@ -0,0 +1,74 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/google/go-cmp/cmp"
+)
+
+// TestListPairs tests that changing the order of the pairs keeps the cursor, selections and decisions on the same pairs
+func TestListPairs(t *testing.T) {
+	m := newModel(nil, nil, nil, nil, "", scanSettings{}, nil, nil)
+	m.pairSims = []janitor.PairSim{
+		{Path1: "a", Path2: "b", Sim: janitor.Similarity{BytesSame: 10, BytesDiff: 10}},
+		{Path1: "c", Path2: "d", Sim: janitor.Similarity{BytesSame: 30}},
+		{Path1: "e", Path2: "f", Sim: janitor.Similarity{BytesSame: 20}},
+	}
+	m.listPairs(0)
+	if diff := cmp.Diff([]int{0, 1, 2}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+
+	press := func(key string) {
+		t.Helper()
+		msg, ok := parseKey(key)
+		if !ok {
+			t.Fatalf("invalid key %q", key)
+		}
+		res, _ := m.Update(msg)
+		m = res.(model)
+	}
+	press("down")
+	press("2")
+	press("down")
+
+	press("o") // highest score first
+	press("o") // most reclaimable space first
+	if diff := cmp.Diff([]int{1, 2, 0}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+	if i, _ := m.current(); i != 2 {
+		t.Errorf("expected the cursor to stay on pair 2, got %d", i)
+	}
+	if diff := cmp.Diff(map[int]int{1: 2}, m.keep); diff != "" {
+		t.Errorf("keep mismatch (-want +got):\n%s", diff)
+	}
+
+	press("up")
+	press(" ") // deselect c/d
+	if _, ok := m.selected[1]; ok {
+		t.Errorf("expected pair 1 to be deselected")
+	}
+	for i := 0; i < 3; i++ {
+		press("o")
+	}
+	if m.sortOrder != 0 {
+		t.Errorf("expected to cycle back to the first order, got %d", m.sortOrder)
+	}
+	if diff := cmp.Diff([]int{0, 1, 2}, m.order); diff != "" {
+		t.Errorf("order mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestRememberEmpty tests that remembering a decision as a rule does nothing when no pairs are listed
+func TestRememberEmpty(t *testing.T) {
+	m := newModel(nil, nil, nil, nil, "", scanSettings{}, nil, nil)
+	m.listPairs(0)
+	m.keep[0] = 1 // a decision for a pair that is not listed
+	msg, _ := parseKey("r")
+	res, _ := m.Update(msg)
+	if m = res.(model); m.status != "" {
+		t.Errorf("expected no status, got %q", m.status)
+	}
+}
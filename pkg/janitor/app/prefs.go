@@ -0,0 +1,152 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+)
+
+// rulesFile returns the default location of the preferences store
+func rulesFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "janitor", "rules.json"), nil
+}
+
+// loadRules reads the rules from the given file. A file that doesn't exist yet simply means no rules.
+func loadRules(file string) (janitor.Rules, error) {
+	fd, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+	return janitor.LoadRules(fd)
+}
+
+// saveRules writes the rules to the given file, replacing it atomically
+func saveRules(file string, rules janitor.Rules) error {
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	fd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	err = rules.Save(fd)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// tildePath abbreviates the home directory in the absolute path p as "~", for rules that are easier to read and edit.
+func tildePath(p string) string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" || home == "/" {
+		return p
+	}
+	if p == home {
+		return "~"
+	}
+	if strings.HasPrefix(p, home+"/") {
+		return "~" + p[len(home):]
+	}
+	return p
+}
+
+// pairRule generalizes the decision to keep one directory of a pair over the other (both absolute paths) into a rule
+// that applies to all their siblings, as long as they are similar to the same extent.
+// e.g. keeping ~/src/foo over ~/backup/src/foo when identical results in: keep "~/src/*" over "~/backup/src/*" when identical
+func pairRule(keep, over string, sim janitor.Similarity) janitor.Rule {
+	r := janitor.Rule{
+		Pattern: tildePath(filepath.Join(filepath.Dir(keep), "*")),
+		Over:    tildePath(filepath.Join(filepath.Dir(over), "*")),
+		Action:  janitor.ActionKeep,
+	}
+	if sim.Identical() {
+		r.When.Identical = true
+	} else {
+		// round down to 5% such that slightly less similar pairs also match
+		r.When.MinContent = math.Floor(sim.ContentSimilarity()*20) / 20
+	}
+	return r
+}
+
+// entryRule generalizes the decision for a file or directory into a rule that applies to all entries with the same extension,
+// or the same name if it has no extension. e.g. trashing foo.part results in: trash "*.part"
+func entryRule(name string, action janitor.Action) janitor.Rule {
+	pattern := name
+	if ext := filepath.Ext(name); ext != "" && ext != name {
+		pattern = "*" + ext
+	}
+	return janitor.Rule{
+		Pattern: pattern,
+		Action:  action,
+	}
+}
+
+// suggestion is a decision suggested by a rule
+type suggestion struct {
+	rule janitor.Rule
+	keep int // for pairs: which path to keep (1 or 2)
+}
+
+func (s suggestion) String() string {
+	return "rule: " + s.rule.String()
+}
+
+// suggestPairs applies the rules to the pairs (with paths relative to root), returning the suggestions by index within pairSims.
+func suggestPairs(rules janitor.Rules, root string, pairSims []janitor.PairSim) map[int]suggestion {
+	out := make(map[int]suggestion)
+	for i, ps := range pairSims {
+		r, which, ok := rules.ForPair(filepath.Join(root, ps.Path1), filepath.Join(root, ps.Path2), ps.Sim)
+		if !ok {
+			continue
+		}
+		keep := which
+		if r.Action == janitor.ActionTrash {
+			keep = 3 - which
+		}
+		out[i] = suggestion{rule: r, keep: keep}
+	}
+	return out
+}
+
+// addRule adds the rule to the preferences store, replacing any rule for the same pattern(s)
+func (m *model) addRule(r janitor.Rule) error {
+	var rules janitor.Rules
+	for _, o := range m.rules {
+		if o.Pattern != r.Pattern || o.Over != r.Over {
+			rules = append(rules, o)
+		}
+	}
+	// new rules come first, so that they take precedence over older, possibly more general ones
+	rules = append(janitor.Rules{r}, rules...)
+	if m.rulesFile == "" {
+		return fmt.Errorf("no rules file")
+	}
+	err := saveRules(m.rulesFile, rules)
+	if err != nil {
+		return err
+	}
+	m.rules = rules
+	fmt.Fprintln(m.log, "INF saved rule:", r)
+	return nil
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPairRule(t *testing.T) {
+	t.Setenv("HOME", "/home/joe")
+	got := pairRule("/home/joe/src/app", "/home/joe/backup/src/app", janitor.Similarity{BytesSame: 10, PathSim: 1})
+	exp := janitor.Rule{Pattern: "~/src/*", Over: "~/backup/src/*", When: janitor.Condition{Identical: true}, Action: janitor.ActionKeep}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("pairRule() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = pairRule("/mnt/a/x", "/mnt/b/x", janitor.Similarity{BytesSame: 93, BytesDiff: 7, PathSim: 0.5})
+	exp = janitor.Rule{Pattern: "/mnt/a/*", Over: "/mnt/b/*", When: janitor.Condition{MinContent: 0.9}, Action: janitor.ActionKeep}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("pairRule() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEntryRule(t *testing.T) {
+	cases := map[string]string{
+		"movie.mkv.part": "*.part",
+		"node_modules":   "node_modules",
+		".DS_Store":      ".DS_Store",
+	}
+	for name, exp := range cases {
+		if got := entryRule(name, janitor.ActionTrash).Pattern; got != exp {
+			t.Errorf("entryRule(%q) got pattern %q, expected %q", name, got, exp)
+		}
+	}
+}
+
+func TestRulesSuggest(t *testing.T) {
+	t.Setenv("HOME", "/home/joe")
+	rules := janitor.Rules{
+		entryRule("somefile", janitor.ActionTrash),
+		{Pattern: "/scan/foo/*", Over: "/scan/*", Action: janitor.ActionTrash},
+	}
+	pairSims := []janitor.PairSim{
+		{Path1: ".", Path2: "foo"},
+		{Path1: "bar", Path2: "foo/bar", Sim: janitor.Similarity{BytesSame: 3, BytesDiff: 6}},
+	}
+	got := suggestPairs(rules, "/scan", pairSims)
+	exp := map[int]suggestion{
+		1: {rule: rules[1], keep: 1},
+	}
+	if diff := cmp.Diff(exp, got, cmp.AllowUnexported(suggestion{})); diff != "" {
+		t.Errorf("suggestPairs() mismatch (-want +got):\n%s", diff)
+	}
+
+	all := janitor.Flatten(janitor.DataMainPrint)
+	tv := newTriageView("foo", all, janitor.NewHashIndex(janitor.DataMainPrint), false)
+	tv.suggest(rules, "/scan")
+	for _, e := range tv.entries {
+		if (e.suggested != nil) != (e.name == "somefile") {
+			t.Errorf("suggest(): entry %s got suggestion %v", e.name, e.suggested)
+		}
+	}
+}
+
+func TestSaveLoadRules(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "janitor", "rules.json")
+	rules, err := loadRules(file)
+	if err != nil || rules != nil {
+		t.Fatalf("loadRules() of non-existing file: expected no rules, got %v, %v", rules, err)
+	}
+	m := newModel(nil, nil, nil, nil, file, scanSettings{}, nil, ioutil.Discard)
+	err = m.addRule(entryRule("a.part", janitor.ActionTrash))
+	if err != nil {
+		t.Fatalf("addRule() unexpected error %v", err)
+	}
+	err = m.addRule(entryRule("b.tmp", janitor.ActionTrash))
+	if err != nil {
+		t.Fatalf("addRule() unexpected error %v", err)
+	}
+	// replaces the first rule
+	err = m.addRule(entryRule("c.part", janitor.ActionKeep))
+	if err != nil {
+		t.Fatalf("addRule() unexpected error %v", err)
+	}
+	exp := janitor.Rules{
+		{Pattern: "*.part", Action: janitor.ActionKeep},
+		{Pattern: "*.tmp", Action: janitor.ActionTrash},
+	}
+	got, err := loadRules(file)
+	if err != nil {
+		t.Fatalf("loadRules() unexpected error %v", err)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("loadRules() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,306 @@
+package app
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif" // register decoders for image previews
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// previewBytes is the maximum number of bytes we read from any file to generate its preview,
+// such that huge files don't stall the UI.
+const previewBytes = 128 * 1024
+
+// previewMsg delivers a preview that was generated in the background
+type previewMsg struct {
+	key  string // the path that was previewed
+	text string
+}
+
+// loadPreview generates the preview of the item at path p (relative to fsys) in the background.
+// directories and zip files (anything we have a DirPrint for) get a listing of their entries, files a preview of their content.
+func loadPreview(fsys fs.FS, all map[string]janitor.DirPrint, p string, width, lines int) tea.Cmd {
+	if dp, ok := all[p]; ok {
+		// this is cheap, no need to do it in the background
+		text := previewDir(dp, lines)
+		return func() tea.Msg {
+			return previewMsg{key: p, text: text}
+		}
+	}
+	return func() tea.Msg {
+		return previewMsg{key: p, text: previewFile(fsys, p, width, lines)}
+	}
+}
+
+// previewDir lists the entries of a directory (or zip file), directories first, by name.
+func previewDir(dp janitor.DirPrint, lines int) string {
+	var out []string
+	for _, d := range dp.Dirs {
+		out = append(out, fmt.Sprintf("%s/", d.Path))
+	}
+	// walked files are sorted by hash
+	files := append([]janitor.FilePrint(nil), dp.Files...)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	for _, f := range files {
+		out = append(out, fmt.Sprintf("%-40s %10s", f.Path, humanBytes(f.Size)))
+	}
+	if len(out) == 0 {
+		return "(empty)"
+	}
+	header := fmt.Sprintf("%d dirs, %d files", len(dp.Dirs), len(dp.Files))
+	return header + "\n" + strings.Join(truncLines(out, lines-1), "\n")
+}
+
+// previewFile reads the start of the file at path p and renders it as text, image information or a hex dump.
+func previewFile(fsys fs.FS, p string, width, lines int) string {
+	fd, err := openInScan(fsys, p)
+	if err != nil {
+		return fmt.Sprintf("can't preview: %v", err)
+	}
+	defer fd.Close()
+	head, err := io.ReadAll(io.LimitReader(fd, previewBytes))
+	if err != nil {
+		return fmt.Sprintf("can't preview: %v", err)
+	}
+	if len(head) == 0 {
+		return "(empty file)"
+	}
+
+	if strings.HasPrefix(http.DetectContentType(head), "image/") {
+		if s, ok := previewImage(head); ok {
+			return s
+		}
+	}
+	if janitor.IsText(head) {
+		return previewText(head, width, lines)
+	}
+	n := 16 * lines
+	if n > len(head) {
+		n = len(head)
+	}
+	return strings.TrimRight(hex.Dump(head[:n]), "\n")
+}
+
+// previewText renders the first lines of the text, expanding tabs, hiding control characters, and wrapping long lines at width.
+func previewText(b []byte, width, lines int) string {
+	if width < 10 {
+		width = 10
+	}
+	if lines < 1 {
+		lines = 1
+	}
+	var out []string
+	for _, line := range strings.Split(string(b), "\n") {
+		var buf strings.Builder
+		for _, r := range strings.TrimRight(line, "\r") {
+			switch {
+			case r == '\t':
+				buf.WriteString("    ")
+			case unicode.IsControl(r) || r == utf8.RuneError:
+				buf.WriteRune('·')
+			default:
+				buf.WriteRune(r)
+			}
+		}
+		runes := []rune(buf.String())
+		for len(runes) > width {
+			out = append(out, string(runes[:width]))
+			runes = runes[width:]
+		}
+		out = append(out, string(runes))
+		if len(out) > lines {
+			break
+		}
+	}
+	if len(out) > lines {
+		out = append(out[:lines-1], "...")
+	}
+	return strings.Join(out, "\n")
+}
+
+// previewImage describes the image format, dimensions, and some EXIF information if available.
+func previewImage(head []byte) (string, bool) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return "", false
+	}
+	s := fmt.Sprintf("%s image, %d x %d", format, cfg.Width, cfg.Height)
+	if format == "jpeg" {
+		for _, tag := range parseExif(head) {
+			s += fmt.Sprintf("\n%-18s %s", tag.name+":", tag.value)
+		}
+	}
+	return s, true
+}
+
+func truncLines(lines []string, n int) []string {
+	if n < 1 {
+		n = 1
+	}
+	if len(lines) <= n {
+		return lines
+	}
+	return append(lines[:n-1:n-1], fmt.Sprintf("... (%d more)", len(lines)-n+1))
+}
+
+// openInScan opens the file at path p within fsys. p may traverse into zip files (e.g. "foo.zip/bar/baz.txt"), just like the paths of
+// our DirPrints, in which case the file is read from within the zip file without extracting it.
+func openInScan(fsys fs.FS, p string) (fs.File, error) {
+	parts := strings.Split(p, "/")
+	for i := 1; i < len(parts); i++ {
+		if filepath.Ext(parts[i-1]) != ".zip" {
+			continue
+		}
+		zp := strings.Join(parts[:i], "/")
+		fd, err := fsys.Open(zp)
+		if err != nil {
+			return nil, err
+		}
+		info, err := fd.Stat()
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+		if info.IsDir() {
+			// a directory that happens to be named like a zip file
+			fd.Close()
+			continue
+		}
+		// try to avoid reading the entire zip file in memory. e.g. os.File supports random access.
+		ra, ok := fd.(io.ReaderAt)
+		if !ok {
+			b, err := io.ReadAll(fd)
+			fd.Close()
+			if err != nil {
+				return nil, err
+			}
+			ra = bytes.NewReader(b)
+			fd = nil
+		}
+		zr, err := zip.NewReader(ra, info.Size())
+		if err != nil {
+			if fd != nil {
+				fd.Close()
+			}
+			return nil, err
+		}
+		f, err := openInScan(zr, strings.Join(parts[i:], "/"))
+		if err != nil {
+			if fd != nil {
+				fd.Close()
+			}
+			return nil, err
+		}
+		return zipEntryFile{File: f, zip: fd}, nil
+	}
+	return fsys.Open(p)
+}
+
+// zipEntryFile is a file within a zip file. Closing it also closes the zip file (if needed).
+type zipEntryFile struct {
+	fs.File
+	zip fs.File
+}
+
+func (f zipEntryFile) Close() error {
+	err := f.File.Close()
+	if f.zip != nil {
+		if zerr := f.zip.Close(); err == nil {
+			err = zerr
+		}
+	}
+	return err
+}
+
+// previewHeight returns the number of lines used by the preview pane
+func (m *model) previewHeight() int {
+	if !m.showPreview {
+		return 0
+	}
+	if m.height <= 0 {
+		// window size unknown
+		return 10
+	}
+	h := m.height / 3
+	if h < 5 {
+		h = 5
+	}
+	return h
+}
+
+func (m *model) previewWidth() int {
+	if m.width <= 0 {
+		return 120
+	}
+	return m.width
+}
+
+// mainHeight returns the number of lines available to the main view (excluding the preview pane), or 0 if unknown.
+func (m *model) mainHeight() int {
+	if m.height <= 0 {
+		return 0
+	}
+	return m.height - m.previewHeight()
+}
+
+// viewPreview renders the preview pane with the given content
+func (m *model) viewPreview(text string) string {
+	if !m.showPreview {
+		return ""
+	}
+	lines := strings.Split(text, "\n")
+	if len(lines) > m.previewHeight()-1 {
+		lines = lines[:m.previewHeight()-1]
+	}
+	return helpStyle(strings.Repeat("─", m.previewWidth())) + "\n" + strings.Join(lines, "\n")
+}
+
+// updatePreview starts loading the preview of the item under the cursor of the triage or detail view, unless it is already loaded.
+func (m *model) updatePreview() tea.Cmd {
+	if !m.showPreview || (m.detail == nil && m.triage == nil) {
+		m.previewKey = ""
+		return nil
+	}
+	var left, right string
+	var ok bool
+	if m.triage != nil {
+		left, ok = m.triage.path()
+	} else {
+		left, right, ok = m.detail.target()
+	}
+	if !ok {
+		return nil
+	}
+	key := left
+	if key == "" {
+		key = right
+	}
+	if _, isDir := m.allDirPrints[key]; !isDir && right != "" {
+		if _, ok := m.allDirPrints[right]; ok {
+			key = right
+		}
+	}
+	if key == m.previewKey {
+		return nil
+	}
+	m.previewKey = key
+	m.previewText = "loading..."
+	return loadPreview(m.fsys, m.allDirPrints, key, m.previewWidth(), m.previewHeight()-1)
+}
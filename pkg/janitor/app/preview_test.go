@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Dieterbe/janitor/pkg/janitor/mkzip"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPreviewFile(t *testing.T) {
+	var img bytes.Buffer
+	err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 3, 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipData, _ := mkzip.MustDo([]mkzip.Entry{
+		{Path: "dir/in-zip.txt", Body: "hello from within a zip"},
+	})
+	f := fstest.MapFS{
+		"text.txt":   {Data: []byte("line1\n\tline2 is a long line that will be wrapped\nline3\nline4\n")},
+		"binary":     {Data: []byte{0, 1, 2, 3, 'a', 'b'}},
+		"image.png":  {Data: img.Bytes()},
+		"empty":      {},
+		"a/data.zip": {Data: zipData},
+	}
+
+	tests := []struct {
+		path  string
+		lines int
+		exp   string
+	}{
+		{"text.txt", 3, "line1\n    line2 is a long \n..."},
+		{"text.txt", 10, "line1\n    line2 is a long \nline that will be wr\napped\nline3\nline4\n"},
+		{"binary", 3, "00000000  00 01 02 03 61 62                                 |....ab|"},
+		{"image.png", 3, "png image, 3 x 2"},
+		{"empty", 3, "(empty file)"},
+		{"a/data.zip/dir/in-zip.txt", 3, "hello from within a \nzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := previewFile(f, tt.path, 20, tt.lines)
+			if diff := cmp.Diff(tt.exp, got); diff != "" {
+				t.Errorf("previewFile(%q) mismatch (-want +got):\n%s", tt.path, diff)
+			}
+		})
+	}
+
+	if got := previewFile(f, "a/data.zip/nonexistent", 20, 4); !strings.HasPrefix(got, "can't preview") {
+		t.Errorf("previewFile() of nonexistent file in zip = %q, expected an error", got)
+	}
+}
+
+func TestParseExif(t *testing.T) {
+	// construct a JPEG header with an APP1 segment containing a little endian TIFF structure with 2 tags in IFD0
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8)) // offset of IFD0
+	binary.Write(&tiff, le, uint16(2)) // number of entries
+	// Make: ASCII, 4 bytes, stored inline
+	binary.Write(&tiff, le, []uint16{0x010f, 2})
+	binary.Write(&tiff, le, uint32(4))
+	tiff.WriteString("Foo\x00")
+	// Model: ASCII, 8 bytes, stored at offset 8+2+2*12+4 = 38, after the IFD
+	binary.Write(&tiff, le, []uint16{0x0110, 2})
+	binary.Write(&tiff, le, []uint32{8, 38})
+	binary.Write(&tiff, le, uint32(0)) // no next IFD
+	tiff.WriteString("Camera1\x00")
+
+	var jpeg bytes.Buffer
+	jpeg.Write([]byte{0xff, 0xd8, 0xff, 0xe1})
+	binary.Write(&jpeg, binary.BigEndian, uint16(2+6+tiff.Len()))
+	jpeg.WriteString("Exif\x00\x00")
+	jpeg.Write(tiff.Bytes())
+	jpeg.Write([]byte{0xff, 0xda})
+
+	exp := []exifTag{
+		{name: "Make", value: "Foo"},
+		{name: "Model", value: "Camera1"},
+	}
+	got := parseExif(jpeg.Bytes())
+	if diff := cmp.Diff(exp, got, cmp.AllowUnexported(exifTag{})); diff != "" {
+		t.Errorf("parseExif() mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+)
+
+// Opts are optional settings for walking. The zero value is valid and means no progress reporting and no lint reporting.
+type Opts struct {
+	Progress   func(Progress)  // if set, called periodically with the progress of the walk
+	TotalFiles int64           // expected number of files (see Count). Allows computing the ETA. 0 means unknown
+	TotalBytes int64           // expected number of bytes (see Count). Allows computing the ETA. 0 means unknown
+	Lint       func(Finding)   // if set, called for every lint finding, including those within zip files
+	Ignore     *janitor.Ignore // which files and directories to leave out. nil means the janitor.DefaultIgnores
+	Ignored    func(p string)  // if set, called for every file or directory that is ignored, including those within zip files
+	Workers    int             // number of files to fingerprint concurrently. 0 or 1 means one at a time
+}
+
+// Progress describes how far along a walk is.
+// Note that zip files count as a single file, and their size is what counts towards Bytes.
+type Progress struct {
+	Files      int64         // number of files processed
+	Bytes      int64         // number of bytes read
+	Dir        string        // the directory currently being walked
+	Errors     int           // number of errors encountered (each of which results in a skipped directory or failed walk)
+	Ignored    int           // number of files and directories that were left out as per the ignore rules. (the contents of ignored directories aren't counted)
+	TotalFiles int64         // expected number of files. 0 means unknown
+	TotalBytes int64         // expected number of bytes. 0 means unknown
+	Elapsed    time.Duration // time since the walk started
+}
+
+// Fraction returns how much of the walk has completed, between 0 and 1, based on the number of bytes read.
+// If the total is unknown, it returns 0.
+func (p Progress) Fraction() float64 {
+	if p.TotalBytes <= 0 {
+		return 0
+	}
+	f := float64(p.Bytes) / float64(p.TotalBytes)
+	if f > 1 {
+		// files may have grown since we counted them
+		return 1
+	}
+	return f
+}
+
+// ETA returns the estimated remaining duration of the walk, assuming a constant reading rate.
+// It returns false if this can't be estimated (yet).
+func (p Progress) ETA() (time.Duration, bool) {
+	f := p.Fraction()
+	if f == 0 {
+		return 0, false
+	}
+	return time.Duration(float64(p.Elapsed) * (1 - f) / f), true
+}
+
+// tracker keeps track of the progress of a walk and reports it, but not more often than every reportInterval (unless forced)
+// It is safe for concurrent use, as files may be read by multiple workers.
+type tracker struct {
+	mu    sync.Mutex
+	p     Progress
+	fn    func(Progress)
+	start time.Time
+	last  time.Time
+}
+
+const reportInterval = 100 * time.Millisecond
+
+func newTracker(opts Opts) *tracker {
+	return &tracker{
+		p: Progress{
+			TotalFiles: opts.TotalFiles,
+			TotalBytes: opts.TotalBytes,
+		},
+		fn:    opts.Progress,
+		start: time.Now(),
+	}
+}
+
+// update applies fn to the progress, and reports it
+func (t *tracker) update(force bool, fn func(p *Progress)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn(&t.p)
+	t.reportLocked(force)
+}
+
+func (t *tracker) report(force bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.reportLocked(force)
+}
+
+func (t *tracker) reportLocked(force bool) {
+	if t.fn == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(t.last) < reportInterval {
+		return
+	}
+	t.last = now
+	t.p.Elapsed = now.Sub(t.start)
+	t.fn(t.p)
+}
+
+// reader returns a reader which accounts all bytes read from r.
+func (t *tracker) reader(r io.Reader) io.Reader {
+	return trackingReader{r: r, t: t}
+}
+
+type trackingReader struct {
+	r io.Reader
+	t *tracker
+}
+
+func (tr trackingReader) Read(b []byte) (int, error) {
+	n, err := tr.r.Read(b)
+	tr.t.update(false, func(p *Progress) {
+		p.Bytes += int64(n)
+	})
+	return n, err
+}
+
+// Count returns the number of files and bytes that a walk over f with the given ignore rules would process, which can be used for progress reporting.
+// Count is best effort: directories that can't be read are skipped.
+func Count(ctx context.Context, f fs.FS, ignore *janitor.Ignore) (files, bytes int64, err error) {
+	ig := ignore.Clone()
+	err = fs.WalkDir(f, ".", func(p string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			// unreadable directory. skip it
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if p != "." && ig.Ignored(p, d.IsDir(), info.Size()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			loadIgnoreFile(f, p, ig)
+			return nil
+		}
+		files++
+		bytes += info.Size()
+		return nil
+	})
+	return files, bytes, err
+}
@@ -0,0 +1,255 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// phases of a scan
+const (
+	phaseCounting  = "counting files"
+	phaseWalking   = "walking"
+	phaseComparing = "comparing directories"
+)
+
+// scanSettings determine how scans are done, and how their results are listed
+type scanSettings struct {
+	ignore   *janitor.Ignore
+	fpr      janitor.FingerPrinter
+	fprName  string // name of fpr, see janitor.FingerPrinters
+	workers  int
+	pairs    janitor.PairOpts
+	weights  janitor.Weights     // weights of the order by score
+	order    int                 // initial order of the pairs: index within pairOrders
+	filter   janitor.Filter      // initial filter of the listed pairs
+	clusters janitor.ClusterOpts // how to cluster copies. (Root and ModTime are set per scan, see clusterOpts)
+}
+
+// opts returns the walk options corresponding to the settings
+func (s scanSettings) opts() Opts {
+	return Opts{
+		Ignore:  s.ignore,
+		Workers: s.workers,
+	}
+}
+
+// scanProgressMsg is sent periodically while a scan is running
+type scanProgressMsg struct {
+	phase string
+	p     Progress // only set while walking
+}
+
+// scanDoneMsg is sent when a scan finishes, successfully or not
+type scanDoneMsg struct {
+	dir        string // the absolute path that was scanned
+	root       janitor.DirPrint
+	all        map[string]janitor.DirPrint
+	pairSims   []janitor.PairSim
+	clusters   []janitor.Cluster
+	presence   []janitor.Presence
+	index      janitor.HashIndex
+	findings   []Finding
+	ignored    int  // number of files and directories left out as per the ignore rules
+	incomplete bool // the user stopped the scan early, the results only cover part of the data
+	err        error
+}
+
+// stopper allows stopping the current phase of a scan (walking, or comparing directories) such that the scan proceeds
+// with the partial results, as opposed to canceling, which aborts the scan entirely.
+type stopper struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	stopped bool // whether the current phase was stopped
+}
+
+// phase returns the context to use for the next phase of the scan
+func (s *stopper) phase(ctx context.Context) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = false
+	ctx, s.cancel = context.WithCancel(ctx)
+	return ctx
+}
+
+// stop stops the current phase
+func (s *stopper) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// wasStopped returns whether the current phase was stopped
+func (s *stopper) wasStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// startScan resets the model and starts scanning in the background. The results we had are kept, to return to if the scan is canceled.
+// The returned command delivers the scan's messages to the model.
+func (m *model) startScan() tea.Cmd {
+	prev := *m
+	*m = newModel(m.scanPaths, m.offline, m.bookmarks, m.rules, m.rulesFile, m.settings, m.keys, m.log)
+	if prev.rootDirPrints != nil {
+		prev.previous = nil
+		m.previous = &prev
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan tea.Msg, 1)
+	m.scanning = true
+	m.cancelScan = cancel
+	m.stopScan = &stopper{}
+	m.scanMsgs = ch
+	// TODO support all paths
+	go scan(ctx, m.stopScan, m.scanPaths[0], m.offline, m.settings, m.log, ch)
+	return waitForScanMsg(ch)
+}
+
+func waitForScanMsg(ch <-chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+// sendProgress delivers the progress message without blocking the scan.
+// if the UI has not consumed the previous progress message yet, it is replaced, as it is stale anyway.
+func sendProgress(ch chan tea.Msg, msg scanProgressMsg) {
+	select {
+	case ch <- msg:
+		return
+	default:
+	}
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+// scan walks scanPath and computes all similarities, sending progress and the end result over ch.
+// canceling ctx aborts the scan, whereas stopping a phase through st makes the scan proceed with what it has so far.
+func scan(ctx context.Context, st *stopper, scanPath string, offline []janitor.Snapshot, settings scanSettings, log io.Writer, ch chan tea.Msg) {
+	// user input could be absolute or relative, and may include sections such as ./, /../ which add no meaning
+	// likewise, running the tool in different locations with different relative paths may refer to the same absolute locations
+	// it seems prudent to make the path "canonical" (absolute and simplified), even though at this time we don't strictly rely on it
+	// (e.g. the tool does not yet - and has no plans for - persisting information across different runs), but at least
+	// this ways things should be more obvious to the end user, especially if output text gets shared later without context about where the tool was run from.
+	dir, err := filepath.Abs(scanPath)
+	if err != nil {
+		ch <- scanDoneMsg{err: err}
+		return
+	}
+	f := os.DirFS(dir)
+
+	sendProgress(ch, scanProgressMsg{phase: phaseCounting})
+	// stopping the count just means we won't have an ETA
+	files, bytes, err := Count(st.phase(ctx), f, settings.ignore)
+	if ctx.Err() != nil {
+		ch <- scanDoneMsg{err: ctx.Err()}
+		return
+	}
+	if err != nil {
+		files, bytes = 0, 0
+	}
+	var findings []Finding
+	var ignored int
+	opts := settings.opts()
+	opts.TotalFiles = files
+	opts.TotalBytes = bytes
+	opts.Progress = func(p Progress) {
+		ignored = p.Ignored
+		sendProgress(ch, scanProgressMsg{phase: phaseWalking, p: p})
+	}
+	opts.Lint = func(fi Finding) {
+		findings = append(findings, fi)
+	}
+	root, all, err := WalkFSContext(st.phase(ctx), f, dir, settings.fpr, log, opts)
+	// if the walk was stopped, we got incomplete results which we can still use.
+	walkStopped := st.wasStopped()
+	if ctx.Err() != nil || (err != nil && !walkStopped) {
+		ch <- scanDoneMsg{err: err}
+		return
+	}
+
+	sendProgress(ch, scanProgressMsg{phase: phaseComparing})
+	pairSims, _ := janitor.GetPairSimsContext(st.phase(ctx), all, settings.pairs, log)
+	if ctx.Err() != nil {
+		ch <- scanDoneMsg{err: ctx.Err()}
+		return
+	}
+	done := scanDoneMsg{
+		dir:        dir,
+		root:       root,
+		all:        all,
+		pairSims:   pairSims,
+		clusters:   janitor.Clusters(all, pairSims, settings.clusterOpts(dir)),
+		index:      janitor.NewHashIndex(root),
+		findings:   findings,
+		ignored:    ignored,
+		incomplete: walkStopped || st.wasStopped(),
+	}
+	for _, snap := range offline {
+		presence, err := janitor.GetPresence(all, snap, settings.fprName, log)
+		if err != nil {
+			fmt.Fprintln(log, "ERR can't compare with snapshot:", err)
+			continue
+		}
+		for _, p := range presence {
+			p.Path = filepath.Join(dir, p.Path)
+			done.presence = append(done.presence, p)
+		}
+	}
+	ch <- done
+}
+
+const progressBarWidth = 40
+
+// viewProgress renders the progress of a running scan
+func viewProgress(phase string, p Progress) string {
+	if phase != phaseWalking {
+		return phase + "...\n"
+	}
+	filled := int(p.Fraction() * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	eta := "unknown"
+	if d, ok := p.ETA(); ok {
+		eta = d.Round(time.Second).String()
+	}
+	s := fmt.Sprintf("%s %3.0f%%\n\n", bar, p.Fraction()*100)
+	s += fmt.Sprintf("files:   %d / %d\n", p.Files, p.TotalFiles)
+	s += fmt.Sprintf("bytes:   %s / %s\n", humanBytes(p.Bytes), humanBytes(p.TotalBytes))
+	s += fmt.Sprintf("errors:  %d\n", p.Errors)
+	s += fmt.Sprintf("ignored: %d\n", p.Ignored)
+	s += fmt.Sprintf("elapsed: %s - ETA: %s\n", p.Elapsed.Round(time.Second), eta)
+	s += fmt.Sprintf("current: %s\n", p.Dir)
+	return s
+}
+
+// humanBytes formats a number of bytes using binary prefixes, e.g. 1.5 MiB
+func humanBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -1,13 +1,18 @@
 package app
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io/ioutil"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/Dieterbe/janitor/pkg/janitor"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 )
 
 // TestGetPairSimsPerfect confirms that we get perfect matches if content _within_ a zip or directory matches, regardless of the name or location of the zip file and directory
@@ -50,6 +55,7 @@ func TestGetPairSimsPerfect(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 14,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -59,6 +65,7 @@ func TestGetPairSimsPerfect(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 14,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -68,6 +75,7 @@ func TestGetPairSimsPerfect(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 14,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -170,6 +178,7 @@ func TestGetPairSims(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 6,
 				BytesDiff: 0,
+				FilesSame: 3,
 				PathSim:   1,
 			},
 		},
@@ -213,6 +222,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 		// - dir2-contents.zip
 		// We see pathsim scores of 0 and 1.
 		// The pathsim scores of 0 are a bit on the harsh side as they do have some commonalities
+		// (see TestGetPairSimsTestdataMetrics for how other path metrics score them)
 
 		{
 			Path1: "dir1",
@@ -220,6 +230,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 16,
+				FilesSame: 1,
 				PathSim:   0,
 			},
 		},
@@ -229,6 +240,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 16,
+				FilesSame: 1,
 				PathSim:   0,
 			},
 		},
@@ -238,6 +250,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 16,
+				FilesSame: 1,
 				PathSim:   0,
 			},
 		},
@@ -247,6 +260,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 10,
+				FilesSame: 1,
 				PathSim:   0,
 			},
 		},
@@ -256,6 +270,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 10,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -265,6 +280,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 10,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -274,6 +290,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 10,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -283,6 +300,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 10,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -304,6 +322,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -313,6 +332,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -322,6 +342,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -331,6 +352,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -340,6 +362,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 2,
 				BytesDiff: 0,
+				FilesSame: 1,
 				PathSim:   1,
 			},
 		},
@@ -349,6 +372,7 @@ func TestGetPairSimsTestdata(t *testing.T) {
 			Sim: janitor.Similarity{
 				BytesSame: 8,
 				BytesDiff: 0,
+				FilesSame: 3,
 				PathSim:   1,
 			},
 		},
@@ -359,3 +383,153 @@ func TestGetPairSimsTestdata(t *testing.T) {
 	}
 
 }
+
+// TestGetPairSimsTestdataMetrics shows how the path metrics change the path similarities, and thus the ranking,
+// of the pairs in the testdata directory that are not identical.
+// (the identical ones have a path similarity of 1 with any metric)
+func TestGetPairSimsTestdataMetrics(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("..", "testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, all, err := WalkFS(os.DirFS(dir), dir, janitor.Sha256FingerPrint, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	type pathSim struct {
+		Path1, Path2 string
+		PathSim      float64
+	}
+	// dir2-and-more has b.txt in common with all of these, which is at dir2/b.txt in dir1 and dir2.zip, and at dir1/dir2/b.txt in dir1.zip
+	// within the pairs of the same content similarity, the ones with the higher path similarity are ranked last (the most similar)
+	cases := map[string][]pathSim{
+		"hamming": {
+			{"dir1", "dir2-and-more", 0},
+			{"dir1.zip", "dir2-and-more", 0},
+			{"dir1.zip/dir1", "dir2-and-more", 0},
+			{"dir2-and-more", "dir2.zip", 0},
+		},
+		"levenshtein": {
+			{"dir1.zip", "dir2-and-more", 0.33},
+			{"dir1", "dir2-and-more", 0.5},
+			{"dir1.zip/dir1", "dir2-and-more", 0.5},
+			{"dir2-and-more", "dir2.zip", 0.5},
+		},
+		"jaro-winkler": {
+			{"dir1.zip", "dir2-and-more", 0},
+			{"dir1", "dir2-and-more", 0.83},
+			{"dir1.zip/dir1", "dir2-and-more", 0.83},
+			{"dir2-and-more", "dir2.zip", 0.83},
+		},
+		"components": {
+			{"dir1", "dir2-and-more", 0.67},
+			{"dir1.zip", "dir2-and-more", 0.67},
+			{"dir1.zip/dir1", "dir2-and-more", 0.67},
+			{"dir2-and-more", "dir2.zip", 0.67},
+		},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return math.Abs(x-y) < 0.01
+	})
+	for name, expected := range cases {
+		pairSims, err := janitor.GetPairSimsContext(context.Background(), all, janitor.PairOpts{PathMetric: janitor.PathMetrics[name]}, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pairSims) != 14 {
+			t.Errorf("%s: expected 14 pairs, got %d", name, len(pairSims))
+			continue
+		}
+		var got []pathSim
+		for _, p := range pairSims[:4] {
+			got = append(got, pathSim{p.Path1, p.Path2, p.Sim.PathSim})
+		}
+		if diff := cmp.Diff(expected, got, opt); diff != "" {
+			t.Errorf("%s: GetPairSimsContext() mismatch (-want +got):\n%s", name, diff)
+		}
+		for _, p := range pairSims[4:] {
+			if p.Sim.PathSim != 1 {
+				t.Errorf("%s: expected path similarity 1 for %s and %s, got %.2f", name, p.Path1, p.Path2, p.Sim.PathSim)
+			}
+		}
+	}
+}
+
+// TestGetPairSimsTestdataFilter tests that filtering leaves out the same pairs as filtering the unfiltered results afterwards.
+// (pairs that are equally similar may be sorted differently, so we don't compare their order)
+func TestGetPairSimsTestdataFilter(t *testing.T) {
+	dir, err := filepath.Abs(filepath.Join("..", "testdata"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, all, err := WalkFS(os.DirFS(dir), dir, janitor.Sha256FingerPrint, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unfiltered := janitor.GetPairSims(all, ioutil.Discard)
+	byPaths := cmpopts.SortSlices(func(a, b janitor.PairSim) bool {
+		return a.Path1 < b.Path1 || a.Path1 == b.Path1 && a.Path2 < b.Path2
+	})
+	cases := []struct {
+		filter janitor.Filter
+		exp    int // number of pairs that pass
+	}{
+		{janitor.Filter{}, 14},
+		{janitor.Filter{MinContent: 0.15}, 11}, // dir2-and-more only has 1/9th of its bytes in common with dir1 and its zips
+		{janitor.Filter{MinContent: 1}, 6},
+		{janitor.Filter{MinBytes: 3}, 1}, // only dir1 and dir1.zip/dir1 have more than b.txt in common
+		{janitor.Filter{MinFiles: 2}, 1},
+		{janitor.Filter{MinPath: 0.5}, 10},
+		{janitor.Filter{MinContent: 0.15, MinPath: 0.5}, 10},
+	}
+	for _, c := range cases {
+		got, err := janitor.GetPairSimsContext(context.Background(), all, janitor.PairOpts{Filter: c.filter}, ioutil.Discard)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var exp []janitor.PairSim
+		for _, p := range unfiltered {
+			if c.filter.Match(p.Sim) {
+				exp = append(exp, p)
+			}
+		}
+		if len(exp) != c.exp {
+			t.Errorf("%+v: expected %d pairs to pass the filter, got %d", c.filter, c.exp, len(exp))
+		}
+		if diff := cmp.Diff(exp, got, byPaths); diff != "" {
+			t.Errorf("%+v: GetPairSimsContext() mismatch (-want +got):\n%s", c.filter, diff)
+		}
+	}
+}
+
+// TestExplain tests the explanation of the similarity of two directories of the testdata, and that it agrees with their PairSim
+func TestExplain(t *testing.T) {
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1}
+	var buf bytes.Buffer
+	err := doExplain(filepath.Join("..", "testdata", "dir1"), filepath.Join("..", "testdata", "dir2-and-more"), settings, ioutil.Discard, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := `matched	2	0.00	dir2/b.txt	b.txt
+only-a	2	a
+only-a	4	foo
+only-b	10	otherfile
+<Similarity bytes=0.11 path=0.00>
+`
+	if diff := cmp.Diff(exp, buf.String()); diff != "" {
+		t.Errorf("doExplain() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestGetPairSimsCanceled tests that canceling the pair comparison returns the context's error
+func TestGetPairSimsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pairSims, err := janitor.GetPairSimsContext(ctx, janitor.Flatten(janitor.DataMainPrint), janitor.PairOpts{}, ioutil.Discard)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("GetPairSimsContext() error = %v, want %v", err, context.Canceled)
+	}
+	if len(pairSims) != 0 {
+		t.Errorf("GetPairSimsContext() returned %d pairs, want none", len(pairSims))
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashDir returns the trash directory as per the freedesktop.org trash specification
+func trashDir() (string, error) {
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, "Trash"), nil
+}
+
+// trash moves the file or directory at the absolute path p into the trash directory, along with the info file
+// that allows restoring it. See https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
+// Note that we don't support moving across filesystems: we never copy data.
+func trash(trashDir, p string) error {
+	files := filepath.Join(trashDir, "files")
+	info := filepath.Join(trashDir, "info")
+	for _, d := range []string{files, info} {
+		err := os.MkdirAll(d, 0700)
+		if err != nil {
+			return err
+		}
+	}
+
+	// find a name that is not in use yet, by reserving the info file.
+	base := filepath.Base(p)
+	name := base
+	var fd *os.File
+	for i := 2; ; i++ {
+		var err error
+		fd, err = os.OpenFile(filepath.Join(info, name+".trashinfo"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		name = base + "." + strconv.Itoa(i)
+	}
+	_, err := fmt.Fprintf(fd, "[Trash Info]\nPath=%s\nDeletionDate=%s\n", escapeTrashPath(p), time.Now().Format("2006-01-02T15:04:05"))
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(p, filepath.Join(files, name))
+	}
+	if err != nil {
+		os.Remove(filepath.Join(info, name+".trashinfo"))
+		return err
+	}
+	return nil
+}
+
+// escapeTrashPath escapes the path as required for trash info files (like an URL path)
+func escapeTrashPath(p string) string {
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// trashTo moves the file or directory at the absolute path p into the trash. Its signature is that of the actions of the triage and lint views:
+// there is no path that the file or directory can be found at afterwards.
+func trashTo(p string) (string, error) {
+	dir, err := trashDir()
+	if err != nil {
+		return "", err
+	}
+	return "", trash(dir, p)
+}
+
+// move moves the file or directory at the absolute path p into the directory dest, refusing to overwrite anything.
+// Note that we don't support moving across filesystems: we never copy data.
+func move(p, dest string) (string, error) {
+	target := filepath.Join(dest, filepath.Base(p))
+	_, err := os.Lstat(target)
+	if err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	return target, os.Rename(p, target)
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	dir := t.TempDir()
+	trashDir := filepath.Join(dir, "Trash")
+	for i := 0; i < 2; i++ {
+		p := filepath.Join(dir, "some file")
+		err := os.WriteFile(p, []byte("foo"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = trash(trashDir, p)
+		if err != nil {
+			t.Fatalf("trash() unexpected error %v", err)
+		}
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("expected %q to be gone after trashing it. got %v", p, err)
+		}
+	}
+
+	// the second file must not overwrite the first
+	for _, name := range []string{"some file", "some file.2"} {
+		if _, err := os.Stat(filepath.Join(trashDir, "files", name)); err != nil {
+			t.Errorf("expected trashed file %q: %v", name, err)
+		}
+		info, err := os.ReadFile(filepath.Join(trashDir, "info", name+".trashinfo"))
+		if err != nil {
+			t.Fatalf("expected trashinfo for %q: %v", name, err)
+		}
+		if !strings.Contains(string(info), "Path="+escapeTrashPath(dir)+"/some%20file\n") {
+			t.Errorf("unexpected trashinfo for %q:\n%s", name, info)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "dest")
+	err := os.Mkdir(dest, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(dir, "file")
+	err = os.WriteFile(p, []byte("foo"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := move(p, dest)
+	if err != nil {
+		t.Fatalf("move() unexpected error %v", err)
+	}
+	if target != filepath.Join(dest, "file") {
+		t.Errorf("move() target = %q", target)
+	}
+
+	// moving another file with the same name must fail
+	err = os.WriteFile(p, []byte("bar"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = move(p, dest)
+	if err == nil {
+		t.Errorf("move() onto an existing file should fail")
+	}
+	b, _ := os.ReadFile(target)
+	if string(b) != "foo" {
+		t.Errorf("existing file was overwritten. content now %q", b)
+	}
+}
@@ -0,0 +1,342 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// triageEntry is a direct child (file, directory or zip file) of the directory being triaged
+type triageEntry struct {
+	name      string
+	isDir     bool // directory or zip file
+	size      int64
+	elsewhere string         // describes whether (and where) the content exists elsewhere in the scan
+	decision  string         // what the user decided (and the outcome), if anything
+	action    janitor.Action // the action the user decided on, if it can be saved as a rule
+	suggested *janitor.Rule  // the rule that suggests an action for this entry, if any
+}
+
+// triageView allows going through the direct children of a directory one by one, and acting on each of them right away.
+type triageView struct {
+	dir      string // key of the DirPrint being triaged
+	archived bool   // dir is within a zip file, so we can't act on its entries
+	entries  []triageEntry
+	cursor   int
+	last     int // index of the entry that was decided on last, or -1
+}
+
+func newTriageView(dir string, all map[string]janitor.DirPrint, idx janitor.HashIndex, archived bool) *triageView {
+	dp := all[dir]
+	tv := &triageView{
+		dir:      dir,
+		archived: archived,
+		last:     -1,
+	}
+	for _, d := range dp.Dirs {
+		var size int64
+		it := d.Iterator()
+		for it.Next() {
+			v, _ := it.Value()
+			size += v.Size
+		}
+		tv.entries = append(tv.entries, triageEntry{
+			name:  d.Path,
+			isDir: true,
+			size:  size,
+		})
+	}
+	for _, f := range dp.Files {
+		tv.entries = append(tv.entries, triageEntry{
+			name: f.Path,
+			size: f.Size,
+		})
+	}
+	sort.Slice(tv.entries, func(i, j int) bool {
+		return tv.entries[i].name < tv.entries[j].name
+	})
+	tv.label(all, idx)
+	return tv
+}
+
+// label describes for each entry whether (and where) its content exists elsewhere in the scan, as per the index
+func (tv *triageView) label(all map[string]janitor.DirPrint, idx janitor.HashIndex) {
+	dp := all[tv.dir]
+	elsewhere := make(map[string]string)
+	for _, d := range dp.Dirs {
+		elsewhere[d.Path] = elsewhereDir(filepath.Join(tv.dir, d.Path), d, idx)
+	}
+	for _, f := range dp.Files {
+		elsewhere[f.Path] = elsewhereFile(filepath.Join(tv.dir, f.Path), f, idx)
+	}
+	for i := range tv.entries {
+		tv.entries[i].elsewhere = elsewhere[tv.entries[i].name]
+	}
+}
+
+// elsewhereFile describes where else in the scan the content of the file at path p exists.
+func elsewhereFile(p string, f janitor.FilePrint, idx janitor.HashIndex) string {
+	var others []string
+	for _, o := range idx[f.Hash] {
+		if o != p {
+			others = append(others, o)
+		}
+	}
+	switch len(others) {
+	case 0:
+		return "unique: not found elsewhere"
+	case 1:
+		return "also at " + others[0]
+	default:
+		return fmt.Sprintf("also at %s (and %d more)", others[0], len(others)-1)
+	}
+}
+
+// elsewhereDir describes how much of the content of the directory at path p exists elsewhere (outside of the directory) in the scan.
+func elsewhereDir(p string, d janitor.DirPrint, idx janitor.HashIndex) string {
+	var found, total int64
+	it := d.Iterator()
+	for it.Next() {
+		v, _ := it.Value()
+		total += v.Size
+		for _, o := range idx[v.Hash] {
+			if !janitor.Child(p, o) {
+				found += v.Size
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return "empty"
+	}
+	if found == total {
+		return fmt.Sprintf("all content (%s) exists elsewhere", humanBytes(total))
+	}
+	return fmt.Sprintf("%.0f%% of content (%s of %s) exists elsewhere", float64(found)*100/float64(total), humanBytes(found), humanBytes(total))
+}
+
+// suggest applies the rules to the entries, given the absolute path of the scan root
+func (tv *triageView) suggest(rules janitor.Rules, root string) {
+	for i := range tv.entries {
+		e := &tv.entries[i]
+		if r, ok := rules.ForPath(filepath.Join(root, tv.dir, e.name)); ok {
+			e.suggested = &r
+		}
+	}
+}
+
+// openTriage shows the triage view of the directory at path p (relative to the scan root)
+func (m *model) openTriage(p string) {
+	m.triage = newTriageView(p, m.allDirPrints, m.index, m.inArchive(p))
+	m.triage.suggest(m.rules, m.scanRoot)
+}
+
+// path returns the path (relative to the scan root) of the entry under the cursor
+func (tv *triageView) path() (string, bool) {
+	if len(tv.entries) == 0 {
+		return "", false
+	}
+	return filepath.Join(tv.dir, tv.entries[tv.cursor].name), true
+}
+
+// next moves to the next entry that has no decision yet (or the last one)
+func (tv *triageView) next() {
+	for tv.cursor < len(tv.entries)-1 {
+		tv.cursor++
+		if tv.entries[tv.cursor].decision == "" {
+			return
+		}
+	}
+}
+
+// updateTriage handles a key press in the triage view. It returns false if the view should be closed.
+func (m *model) updateTriage(msg tea.KeyMsg) bool {
+	tv := m.triage
+	switch key := msg.String(); key {
+	case "esc", "q":
+		return false
+	case "up":
+		if tv.cursor > 0 {
+			tv.cursor--
+		}
+	case "down":
+		if tv.cursor < len(tv.entries)-1 {
+			tv.cursor++
+		}
+	case "enter", "right":
+		// descend into a directory
+		p, ok := tv.path()
+		if ok && tv.entries[tv.cursor].isDir {
+			m.openTriage(p)
+		}
+	case "backspace", "left":
+		if tv.dir != "." {
+			m.openTriage(filepath.Dir(tv.dir))
+		}
+	case "k":
+		m.act(janitor.ActionKeep)
+	case "s":
+		m.decide("skipped", "", nil)
+	case "d":
+		m.act(janitor.ActionTrash)
+	case "a":
+		// accept the suggestion
+		if len(tv.entries) > 0 && tv.entries[tv.cursor].suggested != nil {
+			m.act(tv.entries[tv.cursor].suggested.Action)
+		}
+	case "r":
+		// remember the last decision as a rule
+		if tv.last < 0 || tv.entries[tv.last].action == "" {
+			break
+		}
+		e := &tv.entries[tv.last]
+		r := entryRule(e.name, e.action)
+		err := m.addRule(r)
+		if err != nil {
+			fmt.Fprintln(m.log, "ERR could not save rule:", err)
+			e.decision += " - could not save rule: " + err.Error()
+			break
+		}
+		e.decision += " - saved rule: " + r.String()
+		tv.suggest(m.rules, m.scanRoot)
+	default:
+		n, err := strconv.Atoi(key)
+		if err != nil || n < 1 || n > len(m.bookmarks) {
+			break
+		}
+		dest := m.bookmarks[n-1]
+		m.decide("moved to "+dest, "", func(abs string) (string, error) {
+			return move(abs, dest)
+		})
+	}
+	return true
+}
+
+// act carries out the action on the entry under the cursor
+func (m *model) act(action janitor.Action) {
+	switch action {
+	case janitor.ActionKeep:
+		m.decide("kept", action, nil)
+	case janitor.ActionTrash:
+		m.decide("trashed", action, trashTo)
+	}
+}
+
+// decide records the decision for the entry under the cursor, executing the action (if any) on its absolute path, and moves on to the next entry.
+// The action returns the absolute path that the entry was moved to, or "" if it is gone (see relocated).
+// ruleAction is the action that the decision can be saved as, if any.
+func (m *model) decide(decision string, ruleAction janitor.Action, action func(abs string) (string, error)) {
+	tv := m.triage
+	p, ok := tv.path()
+	if !ok {
+		return
+	}
+	e := &tv.entries[tv.cursor]
+	if action != nil {
+		if tv.archived {
+			e.decision = "can't act on entries within a zip file"
+			return
+		}
+		abs := filepath.Join(m.scanRoot, p)
+		target, err := action(abs)
+		if err != nil {
+			fmt.Fprintln(m.log, "ERR triage:", abs, err)
+			e.decision = "failed: " + err.Error()
+			return
+		}
+		fmt.Fprintln(m.log, "INF triage:", abs, decision)
+		m.relocated(p, target)
+	}
+	e.decision = decision
+	e.action = ruleAction
+	tv.last = tv.cursor
+	tv.next()
+}
+
+// relocated updates the index after the file or directory at path p (relative to the scan root) was moved to the absolute path target,
+// or trashed if target is "", such that the content no longer counts as existing at p. Content moved out of the scan root no longer counts at all.
+// The triage labels are updated accordingly.
+func (m *model) relocated(p, target string) {
+	if m.index == nil {
+		return
+	}
+	rel, err := filepath.Rel(m.scanRoot, target)
+	if target == "" || err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		m.index.Remove(p)
+	} else {
+		m.index.Move(p, rel)
+	}
+	if m.triage != nil {
+		m.triage.label(m.allDirPrints, m.index)
+	}
+}
+
+// inArchive returns whether the path (relative to the scan root) lives within a zip file.
+func (m *model) inArchive(p string) bool {
+	for ; p != "." && p != "/"; p = filepath.Dir(p) {
+		if filepath.Ext(p) != ".zip" {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(m.scanRoot, p))
+		if err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *model) viewTriage() string {
+	tv := m.triage
+	s := "Triage: " + filepath.Join(m.scanRoot, tv.dir) + "\n"
+	if tv.archived {
+		s += helpStyle("(within a zip file: entries can't be trashed or moved)") + "\n"
+	}
+	s += "\n"
+
+	page := m.mainHeight() - 6
+	if page <= 0 {
+		page = len(tv.entries)
+	}
+	start := 0
+	if tv.cursor >= page {
+		start = tv.cursor - page + 1
+	}
+	end := start + page
+	if end > len(tv.entries) {
+		end = len(tv.entries)
+	}
+	w := m.previewWidth()
+	for i := start; i < end; i++ {
+		e := tv.entries[i]
+		cursor := " "
+		if i == tv.cursor {
+			cursor = ">"
+		}
+		name := e.name
+		if e.isDir {
+			name += "/"
+		}
+		line := fmt.Sprintf("%s %s %10s  %s", cursor, fit(name, 30), humanBytes(e.size), e.elsewhere)
+		if e.decision != "" {
+			line = fit(line, w-30) + " " + renamedStyle("["+e.decision+"]")
+		} else if e.suggested != nil {
+			line = fit(line, w-30) + " " + changedStyle("[suggested by rule: "+e.suggested.String()+"]")
+		}
+		s += line + "\n"
+	}
+	if len(tv.entries) == 0 {
+		s += "(empty)\n"
+	}
+
+	help := "\n up/down: navigate - enter: descend - backspace: parent - k: keep - d: trash - s: skip - a: accept suggestion - r: remember last decision as rule"
+	for i, b := range m.bookmarks {
+		help += fmt.Sprintf(" - %d: move to %s", i+1, b)
+	}
+	return s + helpStyle(help+" - esc: back\n")
+}
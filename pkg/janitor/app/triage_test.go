@@ -0,0 +1,76 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewTriageView(t *testing.T) {
+	// in DataMainPrint, somefile (foo) exists in ., bar and foo. foo/bar has unique content.
+	all := janitor.Flatten(janitor.DataMainPrint)
+	idx := janitor.NewHashIndex(janitor.DataMainPrint)
+	tv := newTriageView(".", all, idx, false)
+
+	exp := []triageEntry{
+		{name: "bar", isDir: true, size: 3, elsewhere: "all content (3 B) exists elsewhere"},
+		{name: "foo", isDir: true, size: 12, elsewhere: "25% of content (3 B of 12 B) exists elsewhere"},
+		{name: "somefile", size: 3, elsewhere: "also at bar/somefile (and 1 more)"},
+	}
+	if diff := cmp.Diff(exp, tv.entries, cmp.AllowUnexported(triageEntry{})); diff != "" {
+		t.Errorf("newTriageView() mismatch (-want +got):\n%s", diff)
+	}
+
+	tv = newTriageView("foo/bar", all, idx, false)
+	exp = []triageEntry{
+		{name: "foobar.png.txt", size: 6, elsewhere: "unique: not found elsewhere"},
+		{name: "somefile", size: 3, elsewhere: "unique: not found elsewhere"},
+	}
+	if diff := cmp.Diff(exp, tv.entries, cmp.AllowUnexported(triageEntry{})); diff != "" {
+		t.Errorf("newTriageView() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestTriageRelocated tests that the labels are updated when a copy is trashed
+func TestTriageRelocated(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, "data"))
+	scanDir := filepath.Join(dir, "scan")
+	makeCopies(t, scanDir, "a", "b", "c")
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1}
+	m := scanModel(t, scanDir, settings)
+	press := func(key string) {
+		t.Helper()
+		msg, ok := parseKey(key)
+		if !ok {
+			t.Fatalf("invalid key %q", key)
+		}
+		m.updateTriage(msg)
+	}
+
+	m.openTriage("a")
+	if exp := "also at b/a.jpg (and 1 more)"; m.triage.entries[0].elsewhere != exp {
+		t.Fatalf("expected label %q, got %q", exp, m.triage.entries[0].elsewhere)
+	}
+	m.openTriage("b")
+	press("d")
+	if m.triage.entries[0].decision != "trashed" {
+		t.Fatalf("expected b/a.jpg to be trashed, got %+v", m.triage.entries[0])
+	}
+	m.openTriage("a")
+	if exp := "also at c/a.jpg"; m.triage.entries[0].elsewhere != exp {
+		t.Errorf("expected label %q after trashing another copy, got %q", exp, m.triage.entries[0].elsewhere)
+	}
+
+	// trashing the last other copy updates the labels of the view right away
+	m.openTriage(".")
+	if exp := "all content (3 B) exists elsewhere"; m.triage.entries[2].elsewhere != exp {
+		t.Fatalf("expected label %q for c, got %q", exp, m.triage.entries[2].elsewhere)
+	}
+	press("d")
+	if exp := "0% of content (0 B of 3 B) exists elsewhere"; m.triage.entries[2].elsewhere != exp {
+		t.Errorf("expected label %q for c after trashing a, got %q", exp, m.triage.entries[2].elsewhere)
+	}
+}
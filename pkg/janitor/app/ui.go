@@ -1,10 +1,14 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Dieterbe/janitor/pkg/janitor"
 	tea "github.com/charmbracelet/bubbletea"
@@ -14,6 +18,8 @@ import (
 var (
 	textStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("252")).Render
 	helpStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Render
+
+	activeTabStyle = lipgloss.NewStyle().Reverse(true).Render
 )
 
 type model struct {
@@ -21,35 +27,77 @@ type model struct {
 	rootDirPrints []janitor.DirPrint // corresponding to each scanpath. Not sure yet if we'll need this
 	allDirPrints  map[string]janitor.DirPrint
 	pairSims      []janitor.PairSim
-	cursor        int              // points to index within pairSims
-	selected      map[int]struct{} // points to index within pairSims
+	order         []int              // indices within pairSims, in the order they are listed
+	sortOrder     int                // index within pairOrders of the current order
+	weights       janitor.Weights    // weights of the order by score
+	filter        janitor.Filter     // pairs that don't pass it are not listed
+	filterFocus   int                // index within filterFields of the filter that can be adjusted
+	cursor        int                // points to index within order
+	selected      map[int]struct{}   // points to index within pairSims
+	offline       []janitor.Snapshot // snapshots of offline volumes to compare against
+	presence      []janitor.Presence // presence of scanned content on the offline volumes
 	log           io.Writer
-}
 
-func (m *model) scan() {
-	// TODO support all paths
-	*m = newModel(m.scanPaths, m.log)
-	// user input could be absolute or relative, and may include sections such as ./, /../ which add no meaning
-	// likewise, running the tool in different locations with different relative paths may refer to the same absolute locations
-	// it seems prudent to make the path "canonical" (absolute and simplified), even though at this time we don't strictly rely on it
-	// (e.g. the tool does not yet - and has no plans for - persisting information across different runs), but at least
-	// this ways things should be more obvious to the end user, especially if output text gets shared later without context about where the tool was run from.
-	dir, err := filepath.Abs(m.scanPaths[0])
-	perr(err)
-	f := os.DirFS(dir)
-	root, all, err := WalkFS(f, dir, janitor.Sha256FingerPrint, m.log)
-	perr(err)
-	m.rootDirPrints = []janitor.DirPrint{root}
-	m.allDirPrints = all
-	m.pairSims = janitor.GetPairSims(all, m.log)
+	scanning   bool               // whether a scan is running in the background
+	canceling  bool               // whether the user canceled the running scan, and we're waiting for it to stop
+	cancelScan context.CancelFunc // cancels the running scan
+	stopScan   *stopper           // stops the current phase of the running scan, such that it proceeds with partial results
+	scanMsgs   chan tea.Msg       // messages from the running scan
+	phase      string             // phase of the running scan
+	progress   Progress           // progress of the running scan
+	incomplete bool               // whether the last scan was stopped early, and thus has incomplete results
+	scanErr    error              // error of the last scan, if any
+	previous   *model             // the model before the running scan was started, to return to if it is canceled. nil if there were no results
+
+	detail *detailView // if set, we show the details of a PairSim rather than the list
+	triage *triageView // if set, we show the triage screen. (takes precedence over the detail view)
+	offset int         // index within order of the first one shown
+	width  int
+	height int
+
+	scanRoot    string // absolute path of the scanned directory. (the keys of allDirPrints are relative to it)
+	fsys        fs.FS  // the scanned directory
+	showPreview bool
+	previewKey  string // path (key within allDirPrints, or of a file) of the item being previewed
+	previewText string
+
+	index     janitor.HashIndex // all FilePrints of the scan
+	bookmarks []string          // absolute paths of directories we can move files into
+
+	rules     janitor.Rules      // the preferences store
+	rulesFile string             // where the rules are saved
+	keep      map[int]int        // for selected PairSims (by index): which path to keep (1 or 2), if decided
+	suggested map[int]suggestion // suggestions of the rules, by index within pairSims
+	status    string             // outcome of the last action, shown below the list
+
+	lint     *lintView    // lint findings of the last scan
+	clusters *clusterView // groups of copies found by the last scan
+	tab      int          // the tab that is shown: tabClusters, tabPairs or tabLint
+
+	settings scanSettings
+	ignored  int                   // number of files and directories the last scan left out
+	keys     map[string]tea.KeyMsg // key remaps. pressing a key acts like the key it maps to
 }
 
-func newModel(scanPaths []string, log io.Writer) model {
+func newModel(scanPaths []string, offline []janitor.Snapshot, bookmarks []string, rules janitor.Rules, rulesFile string, settings scanSettings, keys map[string]tea.KeyMsg, log io.Writer) model {
 	return model{
 		scanPaths:    scanPaths,
 		allDirPrints: make(map[string]janitor.DirPrint),
 		selected:     make(map[int]struct{}),
+		offline:      offline,
+		bookmarks:    bookmarks,
+		rules:        rules,
+		rulesFile:    rulesFile,
+		settings:     settings,
+		weights:      settings.weights,
+		sortOrder:    settings.order,
+		filter:       settings.filter,
+		keys:         keys,
+		keep:         make(map[int]int),
+		suggested:    make(map[int]suggestion),
 		log:          log,
+		showPreview:  true,
+		tab:          tabPairs,
 	}
 }
 
@@ -60,33 +108,244 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 
+	case scanProgressMsg:
+		m.phase = msg.phase
+		if msg.phase == phaseWalking {
+			m.progress = msg.p
+		}
+		return m, waitForScanMsg(m.scanMsgs)
+
+	case scanDoneMsg:
+		m.cancelScan()
+		m.scanning = false
+		m.canceling = false
+		if errors.Is(msg.err, context.Canceled) {
+			// the user canceled the scan, which is no failure: return to the results we had
+			fmt.Fprintln(m.log, "INF scan canceled")
+			if m.previous != nil {
+				prev := *m.previous
+				prev.width, prev.height = m.width, m.height
+				m = prev
+			}
+			m.status = "scan canceled"
+			if m.clusters != nil {
+				m.clusters.status = m.status
+			}
+			return m, nil
+		}
+		m.previous = nil
+		m.scanErr = msg.err
+		m.incomplete = msg.incomplete
+		if msg.err != nil {
+			fmt.Fprintln(m.log, "ERR scan failed:", msg.err)
+			return m, nil
+		}
+		m.scanRoot = msg.dir
+		m.fsys = os.DirFS(msg.dir)
+		m.rootDirPrints = []janitor.DirPrint{msg.root}
+		m.allDirPrints = msg.all
+		m.pairSims = msg.pairSims
+		m.order = nil
+		m.listPairs(m.sortOrder)
+		m.presence = msg.presence
+		m.index = msg.index
+		m.lint = newLintView(msg.findings)
+		m.clusters = newClusterView(msg.clusters)
+		m.tab = tabClusters
+		m.ignored = msg.ignored
+
+		// pre-select the pairs for which our rules suggest a decision
+		m.suggested = suggestPairs(m.rules, m.scanRoot, m.pairSims)
+		for i, sug := range m.suggested {
+			m.selected[i] = struct{}{}
+			m.keep[i] = sug.keep
+		}
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case previewMsg:
+		if msg.key == m.previewKey {
+			m.previewText = msg.text
+		}
+		return m, nil
+
 	case tea.KeyMsg:
+		if remapped, ok := m.keys[msg.String()]; ok {
+			msg = remapped
+		}
+
+		if m.triage != nil {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "p":
+				m.showPreview = !m.showPreview
+			default:
+				if !m.updateTriage(msg) {
+					m.triage = nil
+				}
+			}
+			return m, m.updatePreview()
+		}
+
+		if m.detail != nil {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "p":
+				m.showPreview = !m.showPreview
+			case "t":
+				if left, _, ok := m.detail.target(); ok {
+					if _, isDir := m.allDirPrints[left]; isDir {
+						m.openTriage(left)
+					}
+				}
+			default:
+				if !m.detail.update(msg, m.mainHeight()) {
+					m.detail = nil
+					return m, nil
+				}
+			}
+			return m, m.updatePreview()
+		}
+
+		// while scanning, s stops the current phase of the scan (and proceeds with what we have), any other key cancels the scan
+		if m.scanning {
+			switch msg.String() {
+			case "s":
+				m.stopScan.stop()
+			case "ctrl+c":
+				m.cancelScan()
+				return m, tea.Quit
+			default:
+				m.cancelScan()
+				m.canceling = true
+			}
+			return m, nil
+		}
+
+		if m.tab != tabPairs {
+			switch msg.String() {
+			case "s":
+				return m, m.startScan()
+			case "ctrl+c", "q":
+				return m, tea.Quit
+			case "tab":
+				m.nextTab()
+			default:
+				if m.tab == tabLint {
+					m.updateLint(msg)
+				} else {
+					m.updateClusters(msg)
+					if m.detail != nil {
+						return m, m.updatePreview()
+					}
+				}
+			}
+			return m, nil
+		}
 
 		switch msg.String() {
 
 		case "s":
-			m.scan()
+			return m, m.startScan()
+
+		case "tab":
+			m.nextTab()
 
 		case "ctrl+c", "q":
 			return m, tea.Quit
 
+		case "p":
+			m.showPreview = !m.showPreview
+
+		case "t":
+			if _, ok := m.allDirPrints["."]; ok {
+				m.openTriage(".")
+				return m, m.updatePreview()
+			}
+
 		case "up", "k":
 			if m.cursor > 0 {
 				m.cursor--
 			}
 
 		case "down", "j":
-			if m.cursor < len(m.pairSims)-1 {
+			if m.cursor < len(m.order)-1 {
 				m.cursor++
 			}
 
-		case "enter", " ":
-			_, ok := m.selected[m.cursor]
-			if ok {
-				delete(m.selected, m.cursor)
+		case "o":
+			m.listPairs((m.sortOrder + 1) % len(pairOrders(m.weights)))
+
+		case "enter":
+			if i, ok := m.current(); ok {
+				ps := m.pairSims[i]
+				m.detail = newDetailView(ps, m.allDirPrints[ps.Path1], m.allDirPrints[ps.Path2], m.settings.pairs)
+				return m, m.updatePreview()
+			}
+
+		case " ":
+			i, ok := m.current()
+			if !ok {
+				break
+			}
+			if _, ok := m.selected[i]; ok {
+				delete(m.selected, i)
+				delete(m.keep, i)
 			} else {
-				m.selected[m.cursor] = struct{}{}
+				m.selected[i] = struct{}{}
+			}
+
+		case "1", "2":
+			// decide which path of the pair to keep
+			if i, ok := m.current(); ok {
+				m.selected[i] = struct{}{}
+				m.keep[i] = int(msg.String()[0] - '0')
+			}
+
+		case "a":
+			m.keepByPolicy()
+
+		case "r":
+			// remember the decision as a rule
+			i, ok := m.current()
+			if !ok {
+				break
 			}
+			keep, ok := m.keep[i]
+			if !ok {
+				m.status = "first decide which path to keep (1 or 2)"
+				break
+			}
+			ps := m.pairSims[i]
+			p1, p2 := filepath.Join(m.scanRoot, ps.Path1), filepath.Join(m.scanRoot, ps.Path2)
+			if keep == 2 {
+				p1, p2 = p2, p1
+			}
+			r := pairRule(p1, p2, ps.Sim)
+			err := m.addRule(r)
+			if err != nil {
+				fmt.Fprintln(m.log, "ERR could not save rule:", err)
+				m.status = "could not save rule: " + err.Error()
+				break
+			}
+			m.status = "saved rule: " + r.String()
+
+		default:
+			m.updateFilter(msg.String())
+		}
+
+		// scroll such that the cursor is visible
+		if m.cursor < m.offset {
+			m.offset = m.cursor
+		}
+		if page := m.listPageSize(); m.cursor >= m.offset+page {
+			m.offset = m.cursor - page + 1
 		}
 	}
 
@@ -96,13 +355,56 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) View() string {
+	if m.triage != nil {
+		return m.viewTriage() + m.viewPreview(m.previewText)
+	}
+	if m.detail != nil {
+		return m.detail.view(m.width, m.mainHeight()) + m.viewPreview(m.previewText)
+	}
+	if m.scanning {
+		s := "Scanning " + m.scanPaths[0] + "\n\n" + viewProgress(m.phase, m.progress)
+		if m.canceling {
+			return s + helpStyle("\n canceling...\n")
+		}
+		return s + helpStyle("\n s: stop and show what we have - any other key: cancel\n")
+	}
+
+	switch {
+	case m.tab == tabLint:
+		return m.viewLint()
+	case m.tab == tabClusters:
+		return m.viewClusters()
+	}
+
 	s := "Similarities found:\n\n"
+	if m.clusters != nil {
+		s = m.viewTabs() + "\n\n"
+	}
+	if m.scanErr != nil {
+		s = fmt.Sprintf("Scan failed: %v\n\n", m.scanErr)
+	}
+	if m.incomplete {
+		s = "Scan was stopped early. Results are INCOMPLETE\n\n" + s
+	}
+	if m.ignored > 0 {
+		s = fmt.Sprintf("%d files and directories were ignored as per the ignore rules. Results only cover the rest\n\n", m.ignored) + s
+	}
 
-	for i, ps := range m.pairSims {
+	if len(m.pairSims) > 0 {
+		s += helpStyle("sorted by: "+pairOrders(m.weights)[m.sortOrder].name) + "\n" + m.viewFilter() + "\n\n"
+	}
+
+	end := m.offset + m.listPageSize()
+	if end > len(m.order) {
+		end = len(m.order)
+	}
+	for row := m.offset; row < end; row++ {
+		i := m.order[row]
+		ps := m.pairSims[i]
 
 		// Is the cursor pointing at this Pairesim?
 		cursor := " " // no cursor
-		if m.cursor == i {
+		if m.cursor == row {
 			cursor = ">" // cursor!
 		}
 
@@ -113,10 +415,91 @@ func (m model) View() string {
 		}
 
 		// Render the row
-		s += fmt.Sprintf("%s [%s] Path1: %s\n      Path2: %s\nSimilarity: %s\n\n", cursor, checked, ps.Path1, ps.Path2, ps.Sim)
+		incomplete := ""
+		if ps.Incomplete {
+			incomplete = " (incomplete)"
+		}
+		if ps.Partial {
+			incomplete += " (partial)"
+		}
+		if n := ps.Sim.FilesNormalized; n > 0 {
+			// there is no byte-level copy of these files
+			incomplete += changedStyle(fmt.Sprintf(" (%d files only match after normalization)", n))
+		}
+		decision := ""
+		if keep, ok := m.keep[i]; ok {
+			decision = fmt.Sprintf("  keep Path%d", keep)
+		}
+		if sug, ok := m.suggested[i]; ok {
+			decision += "  " + changedStyle("("+sug.String()+")")
+		}
+		s += fmt.Sprintf("%s [%s] Path1: %s\n      Path2: %s\nSimilarity: %s%s%s\n\n", cursor, checked, ps.Path1, ps.Path2, ps.Sim, incomplete, decision)
 	}
 
-	s += helpStyle("\n up/down/j/k : navigate - s: scan - q: quit\n")
+	if len(m.offline) > 0 {
+		s += "Present on offline volumes:\n\n"
+		for _, p := range m.presence {
+			s += p.String() + "\n"
+			if p.Full() {
+				for _, l := range p.Locations {
+					s += helpStyle("      "+l) + "\n"
+				}
+			}
+		}
+	}
+
+	if m.status != "" {
+		s += "\n" + m.status + "\n"
+	}
+	s += helpStyle("\n up/down/j/k : navigate - space: select - 1/2: keep Path1/Path2 - a: keep by policy - r: remember decision as rule - o: change order - f: next filter - +/-: adjust filter - F: clear filters - enter: details - tab: next view (clusters/pairs/lint) - t: triage - p: toggle preview - s: scan - q: quit\n")
+
+	if i, ok := m.current(); ok {
+		ps := m.pairSims[i]
+		w := m.previewWidth()/2 - 1
+		left := previewDir(m.allDirPrints[ps.Path1], m.previewHeight()-1)
+		right := previewDir(m.allDirPrints[ps.Path2], m.previewHeight()-1)
+		s += m.viewPreview(lipgloss.JoinHorizontal(lipgloss.Top,
+			lipgloss.NewStyle().Width(w).MaxWidth(w).Render(left), " ",
+			lipgloss.NewStyle().Width(w).MaxWidth(w).Render(right)))
+	}
 
 	return s
 }
+
+// nextTab shows the next tab. There is only the tab of the pairs until a scan is done
+func (m *model) nextTab() {
+	if m.clusters == nil {
+		return
+	}
+	m.tab = (m.tab + 1) % (tabLint + 1)
+}
+
+// viewTabs renders the names of the tabs (clusters, similarities and lint), highlighting the active one
+func (m *model) viewTabs() string {
+	tabs := []string{
+		tabClusters: fmt.Sprintf(" Copies (%d) ", len(m.clusters.clusters)),
+		tabPairs:    fmt.Sprintf(" Similarities (%d) ", len(m.order)),
+		tabLint:     fmt.Sprintf(" Lint (%d) ", len(m.lint.findings)),
+	}
+	for i, t := range tabs {
+		if i == m.tab {
+			tabs[i] = activeTabStyle(t)
+		} else {
+			tabs[i] = helpStyle(t)
+		}
+	}
+	return strings.Join(tabs, "|")
+}
+
+// listPageSize returns how many PairSims fit on the screen.
+func (m *model) listPageSize() int {
+	if m.mainHeight() <= 0 {
+		return len(m.order)
+	}
+	// each PairSim takes 4 lines, and we need about 11 lines for the header and help text.
+	n := (m.mainHeight() - 11) / 4
+	if n < 1 {
+		return 1
+	}
+	return n
+}
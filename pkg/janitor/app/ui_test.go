@@ -0,0 +1,39 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Dieterbe/janitor/pkg/janitor"
+)
+
+// TestRescanCanceled tests that canceling a rescan returns to the results of the previous scan
+func TestRescanCanceled(t *testing.T) {
+	dir := t.TempDir()
+	makeCopies(t, dir, "a", "b")
+	settings := scanSettings{fpr: janitor.Sha256FingerPrint, workers: 1}
+	m := scanModel(t, dir, settings)
+	if len(m.pairSims) != 1 {
+		t.Fatalf("expected a pair of copies, got %+v", m.pairSims)
+	}
+
+	m.startScan()
+	if len(m.pairSims) != 0 {
+		t.Fatalf("expected the results to be reset while scanning, got %+v", m.pairSims)
+	}
+	m.cancelScan()
+	// wait for the scan to end. it may finish before noticing the cancellation, so we deliver the outcome of a canceled scan
+	for msg := range m.scanMsgs {
+		if _, ok := msg.(scanDoneMsg); ok {
+			break
+		}
+	}
+	res, _ := m.Update(scanDoneMsg{err: context.Canceled})
+	m = res.(model)
+	if m.scanErr != nil || m.status != "scan canceled" {
+		t.Errorf("expected the scan to be canceled, not failed, got error %v and status %q", m.scanErr, m.status)
+	}
+	if m.scanning || len(m.pairSims) != 1 || m.scanRoot != dir {
+		t.Errorf("expected the results of the previous scan, got %+v", m.pairSims)
+	}
+}
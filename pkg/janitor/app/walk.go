@@ -3,10 +3,12 @@ package app
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -14,7 +16,22 @@ import (
 	"github.com/Dieterbe/janitor/pkg/janitor"
 )
 
-func walkZipReader(fd fs.File, path string, fpr janitor.FingerPrinter, log io.Writer) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
+// corruptZipError means the data could not be read as a zip file. The data is kept, such that it can be fingerprinted as a regular file.
+type corruptZipError struct {
+	err  error
+	data []byte
+}
+
+func (e corruptZipError) Error() string {
+	return "corrupt zip file: " + e.err.Error()
+}
+
+func (e corruptZipError) Unwrap() error {
+	return e.err
+}
+
+// walkZipReader walks the zip file read from fd. The callbacks in opts (if any) are called with paths relative to the zip file.
+func walkZipReader(ctx context.Context, fd io.Reader, path string, fpr janitor.FingerPrinter, log io.Writer, opts Opts) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
 
 	// fd is an io.Reader, but we need an io.ReaderAt; so "convert" it
 	var buf bytes.Buffer
@@ -27,32 +44,101 @@ func walkZipReader(fd fs.File, path string, fpr janitor.FingerPrinter, log io.Wr
 
 	zipfs, err := zip.NewReader(readerAt, size)
 	if err != nil {
-		return janitor.DirPrint{}, nil, err
+		return janitor.DirPrint{}, nil, corruptZipError{err: err, data: buf.Bytes()}
 	}
 
-	return WalkZip(zipfs, path, fpr, log)
+	// progress is only tracked for the files that are walked directly, not those within zip files.
+	opts.Progress = nil
+	return Walk(ctx, zipfs, "WalkZIP: ", path, fpr, log, true, opts)
 }
 
 func WalkZip(f fs.FS, walkPath string, fpr janitor.FingerPrinter, log io.Writer) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
-	return Walk(f, "WalkZIP: ", walkPath, fpr, log, true)
+	return Walk(context.Background(), f, "WalkZIP: ", walkPath, fpr, log, true, Opts{})
 }
 
 func WalkFS(f fs.FS, walkPath string, fpr janitor.FingerPrinter, log io.Writer) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
-	return Walk(f, "WalkFS : ", walkPath, fpr, log, false)
+	return Walk(context.Background(), f, "WalkFS : ", walkPath, fpr, log, false, Opts{})
+}
+
+// WalkFSContext is like WalkFS, but the walk can be canceled through ctx, and its progress can be tracked through opts.
+func WalkFSContext(ctx context.Context, f fs.FS, walkPath string, fpr janitor.FingerPrinter, log io.Writer, opts Opts) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
+	return Walk(ctx, f, "WalkFS : ", walkPath, fpr, log, false, opts)
 }
 
 // WalkFS walks the filesystem rooted at walkPath (absolute path to a directory or zip file)
 // and generates the Prints for all folders, files and zip files encountered
 // it returns the root DirPrint and all individual dirprints by path within walkPath (which is implicit)
 // crit means whether any error should fail the entire walk at the root level, or only skip the directory where the error occurs
-func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Writer, crit bool) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
+// cancellation of ctx always aborts the walk. It is checked for before processing every file and directory, and while reading files.
+// Upon cancellation, the context's error is returned along with the partial results: all directories that were completed, and all
+// directories that were in progress, marked as Incomplete (this always includes the root).
+// Files and directories are left out as per opts.Ignore, along with the IgnoreFile of every directory. Those of the walked
+// directories don't apply to the contents of zip files, as their paths are relative to the zip file.
+// Directories that lack anything that was left out (other than junk) or skipped due to an error are marked as Partial,
+// as are the directories they are in.
+// With multiple opts.Workers, files are fingerprinted in the background while the walk proceeds. The only difference in outcome is
+// that if fingerprinting a file fails, the directories after it (within the same directory) have already been walked.
+func Walk(ctx context.Context, f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Writer, crit bool, opts Opts) (janitor.DirPrint, map[string]janitor.DirPrint, error) {
 	if !strings.HasPrefix(walkPath, "/") {
 		panic(fmt.Sprintf("expected an absolute path. not %q - may not be strictly necessary, but it makes output clearer. this should never happen", walkPath))
 	}
 	logPrefix := prefix + walkPath
 	fmt.Fprintln(log, "INF", logPrefix+": START!!")
 	var dpStack []janitor.DirPrint                // dirprints in progress during walking.
+	var pStack []string                           // the paths corresponding to the dirprints in dpStack
+	var ignStack []bool                           // whether anything was ignored within the dirprints in dpStack
+	var jobStack [][]*hashJob                     // the files of the dirprints in dpStack, if fingerprinted by workers
 	var dpAll = make(map[string]janitor.DirPrint) // to be returned
+	tr := newTracker(opts)
+	ig := opts.Ignore.Clone()
+	ignored := func(p string) {
+		tr.update(false, func(pr *Progress) {
+			pr.Ignored++
+		})
+		if opts.Ignored != nil {
+			opts.Ignored(p)
+		}
+	}
+	var workers chan struct{} // limits the number of concurrent fingerprinting jobs. nil means we fingerprint files ourselves
+	if opts.Workers > 1 {
+		workers = make(chan struct{}, opts.Workers)
+	}
+	// addFile adds the FilePrint to the current directory. (via a job if we use workers, to preserve the order of the files)
+	addFile := func(pr janitor.FilePrint) {
+		if workers == nil {
+			dpStack[len(dpStack)-1].Files = append(dpStack[len(dpStack)-1].Files, pr)
+			return
+		}
+		job := &hashJob{pr: pr, done: make(chan struct{})}
+		close(job.done)
+		jobStack[len(jobStack)-1] = append(jobStack[len(jobStack)-1], job)
+	}
+	// collect waits for the jobs of the i'th directory in the stack, and adds their FilePrints to it.
+	// it returns the first error, if any
+	collect := func(i int) error {
+		var err error
+		for _, job := range jobStack[i] {
+			<-job.done
+			if job.err != nil {
+				if err == nil {
+					err = fmt.Errorf("%s: %w", job.p, job.err)
+				}
+				continue
+			}
+			if job.closeErr != nil {
+				fmt.Fprintln(log, "WARN", logPrefix+": "+job.p, "fd.Close() returned error:", job.closeErr, "..afaik these are harmless after read-only access. so ignoring")
+			}
+			dpStack[i].Files = append(dpStack[i].Files, job.pr)
+		}
+		jobStack[i] = nil
+		return err
+	}
+	lint := func(fi Finding) {
+		fmt.Fprintln(log, "INF", logPrefix+": lint:", fi.Kind, fi.Path, fi.Detail)
+		if opts.Lint != nil {
+			opts.Lint(fi)
+		}
+	}
 
 	// Note that WalkDir first processes a directory, then its children
 
@@ -67,14 +153,31 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 
 		// handleErr logs the error, and for a critical error, reports the failure, otherwise skips
 		handleErr := func(msg string, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// the error is likely caused by the cancellation (e.g. while reading a file), in which case it's not a real error.
+				fmt.Fprintln(log, "INF", logPrefix, msg, err, "walk canceled:", ctxErr, "..aborting")
+				return ctxErr
+			}
+			tr.update(true, func(p *Progress) {
+				p.Errors++
+			})
 			if !crit {
 				fmt.Fprintln(log, "WARN", logPrefix, msg, err, "..skipping dir")
+				if len(dpStack) > 0 {
+					// the current directory lacks whatever is skipped. (if that is the directory itself, it is discarded anyway)
+					dpStack[len(dpStack)-1].Partial = true
+				}
 				return fs.SkipDir
 			}
 			fmt.Fprintln(log, "ERR", logPrefix, msg, err, "..aborting")
 			return err
 		}
 
+		if err := ctx.Err(); err != nil {
+			fmt.Fprintln(log, "INF", logPrefix, "walk canceled:", err, "..aborting")
+			return err
+		}
+
 		if err != nil {
 			return handleErr("received Stat(root) or ReadDir(dir) error", err)
 		}
@@ -88,15 +191,39 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 			return handleErr("d.info() error", err)
 		}
 
-		if d.Name() == "__MACOSX" && info.IsDir() {
-			fmt.Fprintln(log, "INF", logPrefix, "don't descend into this one, it's not real important data")
-			return fs.SkipDir
+		if junkNames[d.Name()] && info.IsDir() {
+			// report these even though they're ignored by default: they still take up space
+			lint(Finding{Kind: LintJunk, Path: p})
+		}
+
+		if p != "." && ig.Ignored(p, info.IsDir(), info.Size()) {
+			fmt.Fprintln(log, "INF", logPrefix, "ignoring as per the ignore rules")
+			ignored(p)
+			ignStack[len(ignStack)-1] = true
+			if !junkNames[d.Name()] {
+				// junk has no use to the user, so lacking it doesn't make a difference
+				dpStack[len(dpStack)-1].Partial = true
+			}
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
 		}
 
 		if info.IsDir() {
 			// entering a new directory. start our DirPrint to capture FilePrint's in this directory
 			dpStack = append(dpStack, janitor.DirPrint{Path: filepath.Base(p)})
+			pStack = append(pStack, p)
+			ignStack = append(ignStack, false)
+			jobStack = append(jobStack, nil)
 			fmt.Fprintln(log, "INF", logPrefix, "PUSH: this is our current directory to add FilePrints into")
+			err := loadIgnoreFile(f, p, ig)
+			if err != nil {
+				fmt.Fprintln(log, "WARN", logPrefix, "could not read", janitor.IgnoreFile, "error:", err, "..not applying it")
+			}
+			tr.update(false, func(pr *Progress) {
+				pr.Dir = p
+			})
 		} else {
 			if filepath.Ext(p) == ".zip" {
 				fmt.Fprintln(log, "INF", logPrefix, "fingerprinting as a zip directory...")
@@ -105,11 +232,33 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 					return handleErr("f.Open() error", err)
 				}
 				path := filepath.Join(walkPath, p)
-				dp, all, err := walkZipReader(fd, path, fpr, log)
+				zipOpts := Opts{
+					Ignore: opts.Ignore,
+					Lint: func(fi Finding) {
+						fi.Path = filepath.Join(p, fi.Path)
+						lint(fi)
+					},
+					Ignored: func(q string) {
+						ignored(filepath.Join(p, q))
+					},
+				}
+				dp, all, err := walkZipReader(ctx, janitor.NewContextReader(ctx, tr.reader(fd)), path, fpr, log, zipOpts)
+				fd.Close() // ignore error. AFAIK this is fine after read-only access
+				var zerr corruptZipError
+				if errors.As(err, &zerr) {
+					// report it, and treat it like any other file
+					lint(Finding{Kind: LintCorruptZip, Path: p, Size: info.Size(), Detail: zerr.err.Error()})
+					pr, err := fpr(filepath.Base(p), bytes.NewReader(zerr.data))
+					if err != nil {
+						return handleErr("Fingerprint (io.Read) returned error:", err)
+					}
+					addFile(pr)
+					tr.update(false, countFile)
+					return nil
+				}
 				if err != nil {
 					return handleErr("walkZip returned error:", err)
 				}
-				fd.Close() // ignore error. AFAIK this is fine after read-only access
 				for k, v := range all {
 					// normally if you call a walk function, the paths of returned dirprints don't include the walkPath prefix, as it is implied.
 					// since we called walk within our walk, we have to prepend the portion of the path after (within) *our* walkPath
@@ -120,21 +269,43 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 				dp.Path = filepath.Base(p)
 				dpAll[p] = dp
 				dpStack[len(dpStack)-1].Dirs = append(dpStack[len(dpStack)-1].Dirs, dp)
+				dpStack[len(dpStack)-1].Partial = dpStack[len(dpStack)-1].Partial || dp.Partial
+				tr.update(false, countFile)
 			} else {
 				fmt.Fprintln(log, "INF", logPrefix, "fingerprinting as standalone file...")
+				if kind, ok := lintFile(d.Name(), info.Size()); ok {
+					lint(Finding{Kind: kind, Path: p, Size: info.Size()})
+				}
 				fd, err := f.Open(p)
 				if err != nil {
 					return handleErr("f.Open() error", err)
 				}
-				pr, err := fpr(filepath.Base(p), fd)
+				if workers != nil {
+					job := &hashJob{p: p, done: make(chan struct{})}
+					jobStack[len(jobStack)-1] = append(jobStack[len(jobStack)-1], job)
+					workers <- struct{}{}
+					go func() {
+						defer close(job.done)
+						defer func() { <-workers }()
+						job.pr, job.err = fpr(filepath.Base(p), janitor.NewContextReader(ctx, tr.reader(fd)))
+						job.closeErr = fd.Close()
+						if job.err == nil {
+							tr.update(false, countFile)
+						}
+					}()
+					return nil
+				}
+				pr, err := fpr(filepath.Base(p), janitor.NewContextReader(ctx, tr.reader(fd)))
 				if err != nil {
+					fd.Close()
 					return handleErr("Fingerprint (io.Read) returned error:", err)
 				}
 				err = fd.Close()
 				if err != nil {
 					fmt.Fprintln(log, "WARN", logPrefix, "fd.Close() returned error:", err, "..afaik these are harmless after read-only access. so ignoring")
 				}
-				dpStack[len(dpStack)-1].Files = append(dpStack[len(dpStack)-1].Files, pr)
+				addFile(pr)
+				tr.update(false, countFile)
 			}
 		}
 
@@ -144,14 +315,43 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 	doneDirFn := func(p string, d fs.DirEntry, err error) error {
 		logPrefix := logPrefix + ": DoneDir " + p
 
+		jobErr := collect(len(jobStack) - 1)
+		if err == nil && jobErr != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				fmt.Fprintln(log, "INF", logPrefix, "Fingerprint (io.Read) returned error:", jobErr, "walk canceled:", ctxErr, "..aborting")
+				return ctxErr
+			}
+			tr.update(true, func(pr *Progress) {
+				pr.Errors++
+			})
+			if crit {
+				fmt.Fprintln(log, "ERR", logPrefix, "Fingerprint (io.Read) returned error:", jobErr, "..aborting")
+				return jobErr
+			}
+			fmt.Fprintln(log, "WARN", logPrefix, "Fingerprint (io.Read) returned error:", jobErr, "..skipping dir")
+			err = jobErr
+		}
+
 		if err != nil {
 			// walking this dir was aborted
 			fmt.Fprintln(log, "INF", logPrefix, "POP: discarding directory due to error")
 			dpStack = dpStack[:len(dpStack)-1]
+			pStack = pStack[:len(pStack)-1]
+			ignStack = ignStack[:len(ignStack)-1]
+			jobStack = jobStack[:len(jobStack)-1]
+			if len(dpStack) > 0 {
+				dpStack[len(dpStack)-1].Partial = true
+			}
 			return nil
 		}
 
+		// sort once, rather than each time the directory is iterated over
+		janitor.SortByHash(dpStack[len(dpStack)-1].Files)
 		dpAll[p] = dpStack[len(dpStack)-1] // our stack should always have at least 1 element.
+		if done := dpStack[len(dpStack)-1]; p != "." && len(done.Files) == 0 && len(done.Dirs) == 0 && !ignStack[len(ignStack)-1] {
+			// (a directory in which we ignored anything is not necessarily empty)
+			lint(Finding{Kind: LintEmptyDir, Path: p})
+		}
 
 		// we are done with a directory, add it to its parent
 		// unless this was the root directory, which has no parent and will be the ultimate DirPrint to return below
@@ -159,13 +359,36 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 			fmt.Fprintln(log, "INF", logPrefix, "POP: adding this dir to its parent")
 			popped := dpStack[len(dpStack)-1]
 			dpStack = dpStack[:len(dpStack)-1]
+			pStack = pStack[:len(pStack)-1]
+			ignStack = ignStack[:len(ignStack)-1]
+			jobStack = jobStack[:len(jobStack)-1]
 			dpStack[len(dpStack)-1].Dirs = append(dpStack[len(dpStack)-1].Dirs, popped)
+			dpStack[len(dpStack)-1].Partial = dpStack[len(dpStack)-1].Partial || popped.Partial
 			return nil
 		}
 		fmt.Fprintln(log, "INF", logPrefix, "POP: this dir is the root and is complete")
 		return nil
 	}
 	err := fswalk.WalkDir(f, ".", walkDirFn, doneDirFn)
+	// when the walk was aborted, jobs may still be running for the directories in progress
+	for i := range jobStack {
+		collect(i)
+	}
+	tr.report(true)
+	if err != nil && ctx.Err() != nil && len(dpStack) > 0 {
+		// we were canceled. wrap up the directories in progress (from the deepest one up to the root) and return what we have
+		fmt.Fprintln(log, "INF", logPrefix+": walk canceled. returning incomplete results")
+		for i := len(dpStack) - 1; i >= 0; i-- {
+			dpStack[i].Incomplete = true
+			janitor.SortByHash(dpStack[i].Files)
+			dpAll[pStack[i]] = dpStack[i]
+			if i > 0 {
+				dpStack[i-1].Dirs = append(dpStack[i-1].Dirs, dpStack[i])
+				dpStack[i-1].Partial = dpStack[i-1].Partial || dpStack[i].Partial
+			}
+		}
+		return dpStack[0], dpAll, err
+	}
 	if err != nil {
 		return janitor.DirPrint{}, nil, err
 	}
@@ -174,3 +397,28 @@ func Walk(f fs.FS, prefix, walkPath string, fpr janitor.FingerPrinter, log io.Wr
 	}
 	return dpStack[0], dpAll, nil
 }
+
+// hashJob is a file being fingerprinted by a worker
+type hashJob struct {
+	p        string // path within the walked dir
+	done     chan struct{}
+	pr       janitor.FilePrint
+	err      error
+	closeErr error
+}
+
+// loadIgnoreFile adds the rules of the IgnoreFile in directory dir (if any) to ig
+func loadIgnoreFile(f fs.FS, dir string, ig *janitor.Ignore) error {
+	b, err := fs.ReadFile(f, path.Join(dir, janitor.IgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ig.AddFrom(bytes.NewReader(b), dir)
+}
+
+func countFile(p *Progress) {
+	p.Files++
+}
@@ -1,14 +1,18 @@
 package app
 
 import (
+	"context"
 	"crypto/sha256"
 	"errors"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/Dieterbe/janitor/pkg/janitor"
 	"github.com/Dieterbe/janitor/pkg/janitor/errfs"
@@ -40,6 +44,8 @@ func TestWalk(t *testing.T) {
 				return
 			}
 
+			// walked files are sorted by hash
+			tt.want = tt.want.SortedByHash()
 			if diff := cmp.Diff(tt.want, dirPrint); diff != "" {
 				t.Errorf("Walk() mismatch (-want +got):\n%s", diff)
 			}
@@ -139,6 +145,8 @@ func testWalkWithErrors(t *testing.T, fileIsZip bool) {
 
 	printsDirSkipped := printsNoErr
 	printsDirSkipped.Dirs = nil
+	// the root lacks what was skipped
+	printsDirSkipped.Partial = true
 
 	var tests = []struct {
 		name   string
@@ -190,6 +198,31 @@ func testWalkWithErrors(t *testing.T, fileIsZip bool) {
 			want: printsDirSkipped,
 			err:  nil,
 		},
+		{
+			name:   "file-read-midway",
+			baseFS: baseFS,
+			errors: map[string]errfs.Errs{
+				fname: {
+					Read:      &fs.PathError{Op: "read", Path: fname, Err: fs.ErrPermission},
+					ReadAfter: 2,
+				},
+			},
+			// a file that fails halfway is just as unreadable
+			want: printsDirSkipped,
+			err:  nil,
+		},
+		{
+			name:   "file-short-reads",
+			baseFS: baseFS,
+			errors: map[string]errfs.Errs{
+				fname: {
+					ShortRead: 1,
+					Delay:     time.Millisecond,
+				},
+			},
+			want: printsNoErr,
+			err:  nil,
+		},
 		{
 			name:   "file-close",
 			baseFS: baseFS,
@@ -286,14 +319,164 @@ func testWalkWithErrors(t *testing.T, fileIsZip bool) {
 				return
 			}
 
+			// walked files are sorted by hash
+			tt.want = tt.want.SortedByHash()
 			if diff := cmp.Diff(tt.want, dirPrint); diff != "" {
 				t.Errorf("Walk() mismatch (-want +got):\n%s", diff)
 			}
+
+			// fingerprinting with workers should have the same outcome
+			dirPrint, _, err = WalkFSContext(context.Background(), errfs.NewErrFS(tt.baseFS, tt.errors), "/test/in-memory/"+tt.name+".zip", janitor.Sha256FingerPrint, ioutil.Discard, Opts{Workers: 4})
+			if err != tt.err {
+				t.Errorf("Walk() with workers error = %v, wantErr %v", err, tt.err)
+			}
+			if diff := cmp.Diff(tt.want, dirPrint); diff != "" {
+				t.Errorf("Walk() with workers mismatch (-want +got):\n%s", diff)
+			}
 		})
 
 	}
 }
 
+// TestWalkOpensAndCloses tests that the walk opens every file exactly once, and closes everything it opened, also when reading fails
+func TestWalkOpensAndCloses(t *testing.T) {
+	zipData, _ := mkzip.MustDo([]mkzip.Entry{{Path: "a", Body: "foo"}, {Path: "sub/b", Body: "bar"}})
+	baseFS := fstest.MapFS{
+		"a":                  {Data: []byte("foo")},
+		"dir/b":              {Data: []byte("bar")},
+		"dir/ok.zip":         {Data: zipData},
+		"dir/corrupt.zip":    {Data: []byte("not a zip")},
+		"dir/unreadable.zip": {Data: zipData},
+		"dir/unreadable":     {Data: []byte("foobar")},
+		"other/c":            {Data: []byte("foobar")},
+	}
+	readErr := &fs.PathError{Op: "read", Err: fs.ErrPermission}
+	for _, workers := range []int{0, 4} {
+		efs := errfs.New(baseFS,
+			errfs.Rule{Pattern: "dir/unreadable*", Errs: errfs.Errs{Read: readErr, ReadAfter: 10}},
+		)
+		_, _, err := WalkFSContext(context.Background(), efs, "/test/in-memory", janitor.Sha256FingerPrint, ioutil.Discard, Opts{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers %d: Walk() unexpected error %v", workers, err)
+		}
+
+		opened := make(map[string]int)
+		closed := make(map[string]int)
+		for _, c := range efs.Calls() {
+			switch {
+			case c.Method == errfs.MethodOpen && c.Err == nil:
+				opened[c.Path]++
+			case c.Method == errfs.MethodClose:
+				closed[c.Path]++
+			}
+		}
+		for p, f := range baseFS {
+			if f.Mode.IsDir() {
+				continue
+			}
+			if opened[p] != 1 {
+				t.Errorf("workers %d: expected %s to be opened once, got %d", workers, p, opened[p])
+			}
+		}
+		if diff := cmp.Diff(opened, closed); diff != "" {
+			t.Errorf("workers %d: closes don't match the opens (-opened +closed):\n%s", workers, diff)
+		}
+	}
+}
+
+// TestWalkReadsDirsOnce tests that the walk reads all entries of a directory in one ReadDir call,
+// so that a directory that fails on a later page is walked completely
+func TestWalkReadsDirsOnce(t *testing.T) {
+	baseFS := fstest.MapFS{
+		"dir/a":     {Data: []byte("foo")},
+		"dir/b":     {Data: []byte("bar")},
+		"dir/c":     {Data: []byte("baz")},
+		"dir/sub/d": {Data: []byte("foobar")},
+	}
+	for _, workers := range []int{0, 4} {
+		efs := errfs.New(baseFS,
+			errfs.Rule{Pattern: "dir", Errs: errfs.Errs{ReadDir: errors.New("some read error"), ReadDirAfter: 1}},
+		)
+		_, all, err := WalkFSContext(context.Background(), efs, "/test/in-memory", janitor.Sha256FingerPrint, ioutil.Discard, Opts{Workers: workers})
+		if err != nil {
+			t.Fatalf("workers %d: Walk() unexpected error %v", workers, err)
+		}
+
+		readDirs := make(map[string]int)
+		for _, c := range efs.Calls() {
+			if c.Method != errfs.MethodReadDir {
+				continue
+			}
+			if c.Err != nil {
+				t.Errorf("workers %d: ReadDir of %s failed: %v", workers, c.Path, c.Err)
+			}
+			readDirs[c.Path]++
+		}
+		exp := map[string]int{".": 1, "dir": 1, "dir/sub": 1}
+		if diff := cmp.Diff(exp, readDirs); diff != "" {
+			t.Errorf("workers %d: ReadDir calls mismatch (-want +got):\n%s", workers, diff)
+		}
+		if got := all["dir"].Files; len(got) != 3 {
+			t.Errorf("workers %d: expected the 3 files of dir, got %+v", workers, got)
+		}
+	}
+}
+
+// TestWalkArchives tests walking zip files within zip files, with directory entries, junk and both compression methods
+func TestWalkArchives(t *testing.T) {
+	entries := func(store bool) []mkzip.Entry {
+		return []mkzip.Entry{
+			{Path: "empty", Dir: true},
+			{Path: "docs/", Dir: true, Mode: 0700, Modified: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+			{Path: "docs/a", Body: "foo", Store: store},
+			{Path: "__MACOSX/docs/._a", Body: "junk", Store: store},
+			{Path: "inner.zip", Store: store, Archive: &mkzip.Archive{Entries: []mkzip.Entry{{Path: "x", Body: "bar", Store: store}}}},
+		}
+	}
+	f := fstest.MapFS{
+		"deflated.zip": {Data: mkzip.Archive{Entries: entries(false), Comment: "deflated"}.MustBytes()},
+		"stored.zip":   {Data: mkzip.Archive{Entries: entries(true), Comment: "stored"}.MustBytes()},
+	}
+	var findings []Finding
+	opts := Opts{
+		Ignore: janitor.NewIgnore(),
+		Lint: func(fi Finding) {
+			findings = append(findings, fi)
+		},
+	}
+	root, all, err := WalkFSContext(context.Background(), f, "/test/in-memory/archives", janitor.Sha256FingerPrint, ioutil.Discard, opts)
+	if err != nil {
+		t.Fatalf("WalkFSContext() unexpected error %v", err)
+	}
+
+	zipPrint := func(name string) janitor.DirPrint {
+		return janitor.DirPrint{
+			Path: name,
+			Dirs: []janitor.DirPrint{
+				{Path: "docs", Files: []janitor.FilePrint{{Path: "a", Size: 3, Hash: janitor.FooHash}}},
+				{Path: "empty"},
+				{Path: "inner.zip", Files: []janitor.FilePrint{{Path: "x", Size: 3, Hash: janitor.BarHash}}},
+			},
+		}
+	}
+	exp := janitor.DirPrint{Path: ".", Dirs: []janitor.DirPrint{zipPrint("deflated.zip"), zipPrint("stored.zip")}}
+	if diff := cmp.Diff(exp, root); diff != "" {
+		t.Errorf("WalkFSContext() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := all["stored.zip/inner.zip"]; !ok {
+		t.Errorf("expected a DirPrint for the zip file within the zip file")
+	}
+	expFindings := []Finding{
+		{Kind: LintJunk, Path: "deflated.zip/__MACOSX"},
+		{Kind: LintEmptyDir, Path: "deflated.zip/empty"},
+		{Kind: LintJunk, Path: "stored.zip/__MACOSX"},
+		{Kind: LintEmptyDir, Path: "stored.zip/empty"},
+	}
+	if diff := cmp.Diff(expFindings, findings); diff != "" {
+		t.Errorf("findings mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func mkFilePrint(p string, content string) janitor.FilePrint {
 	return janitor.FilePrint{
 		Path: p,
@@ -393,3 +576,205 @@ func TestWalkTestdata(t *testing.T) {
 		t.Errorf("Walk() all mismatch (-want +got):\n%s", diff)
 	}
 }
+
+// TestWalkProgress tests whether progress is reported correctly, and whether the precount matches the walk.
+func TestWalkProgress(t *testing.T) {
+	files, bytes, err := Count(context.Background(), janitor.DataMain, nil)
+	if err != nil {
+		t.Fatalf("Count() unexpected error %v", err)
+	}
+	// all files except those in __MACOSX directories
+	if files != 5 || bytes != 3+3+6+3+3 {
+		t.Errorf("Count() = %d files, %d bytes, want 5 files, 18 bytes", files, bytes)
+	}
+
+	var last Progress
+	opts := Opts{
+		Progress:   func(p Progress) { last = p },
+		TotalFiles: files,
+		TotalBytes: bytes,
+	}
+	_, _, err = WalkFSContext(context.Background(), janitor.DataMain, "/test/in-memory/progress", janitor.Sha256FingerPrint, ioutil.Discard, opts)
+	if err != nil {
+		t.Fatalf("Walk() unexpected error %v", err)
+	}
+	if last.Files != files || last.Bytes != bytes || last.Errors != 0 || last.Fraction() != 1 {
+		t.Errorf("Walk() final progress = %+v, want all %d files and %d bytes processed without errors", last, files, bytes)
+	}
+}
+
+// TestWalkCanceled tests that a canceled walk aborts with the context's error
+func TestWalkCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err := WalkFSContext(ctx, janitor.DataMain, "/test/in-memory/canceled", janitor.Sha256FingerPrint, ioutil.Discard, Opts{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// TestWalkCanceledPartial tests that a walk canceled halfway returns the partial results, with all directories in progress marked as incomplete.
+func TestWalkCanceledPartial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// cancel while hashing foo/bar/foobar.png.txt, at which point bar is complete, and foo and foo/bar are in progress.
+	// (foo/somefile comes after foo/bar, so it is not included)
+	fpr := func(path string, r io.Reader) (janitor.FilePrint, error) {
+		if path == "foobar.png.txt" {
+			cancel()
+		}
+		return janitor.Sha256FingerPrint(path, r)
+	}
+	root, all, err := WalkFSContext(ctx, janitor.DataMain, "/test/in-memory/canceled", fpr, ioutil.Discard, Opts{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Walk() error = %v, want %v", err, context.Canceled)
+	}
+
+	dpBar := janitor.DataMainPrint.Dirs[0]
+	dpFooBar := janitor.DirPrint{
+		Path:       "bar",
+		Incomplete: true,
+	}
+	dpFoo := janitor.DirPrint{
+		Path:       "foo",
+		Dirs:       []janitor.DirPrint{dpFooBar},
+		Incomplete: true,
+	}
+	expRoot := janitor.DirPrint{
+		Path:       ".",
+		Dirs:       []janitor.DirPrint{dpBar, dpFoo},
+		Incomplete: true,
+	}
+	expAll := map[string]janitor.DirPrint{
+		".":       expRoot,
+		"bar":     dpBar,
+		"foo":     dpFoo,
+		"foo/bar": dpFooBar,
+	}
+	if diff := cmp.Diff(expRoot, root); diff != "" {
+		t.Errorf("Walk() root mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(expAll, all); diff != "" {
+		t.Errorf("Walk() all mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWalkIgnore(t *testing.T) {
+	f := fstest.MapFS{
+		"a/foo.txt":               {Data: []byte("foo")},
+		"a/foo.log":               {Data: []byte("log")},
+		"a/huge.bin":              {Data: []byte("0123456789012345678901234")},
+		"a/node_modules/x.js":     {Data: []byte("x")},
+		"b/" + janitor.IgnoreFile: {Data: []byte("*.txt\n!keep.txt\n")},
+		"b/bar.txt":               {Data: []byte("bar")},
+		"b/keep.txt":              {Data: []byte("keep")},
+		"b/__MACOSX/._bar.txt":    {Data: []byte("junk")},
+		"c/baz.txt":               {Data: []byte("baz")},
+	}
+	ig := janitor.NewIgnore()
+	ig.Add(".", janitor.CommonSkipDirs...)
+	ig.Add(".", "*.log")
+	ig.MaxSize = 20
+
+	var ignored []string
+	var findings []Finding
+	opts := Opts{
+		Ignore: ig,
+		Ignored: func(p string) {
+			ignored = append(ignored, p)
+		},
+		Lint: func(fi Finding) {
+			findings = append(findings, fi)
+		},
+	}
+	_, all, err := WalkFSContext(context.Background(), f, "/test/in-memory/ignore", janitor.Sha256FingerPrint, ioutil.Discard, opts)
+	if err != nil {
+		t.Fatalf("WalkFSContext() unexpected error %v", err)
+	}
+	exp := []string{"a/foo.log", "a/huge.bin", "a/node_modules", "b/__MACOSX", "b/bar.txt"}
+	if diff := cmp.Diff(exp, ignored); diff != "" {
+		t.Errorf("ignored mismatch (-want +got):\n%s", diff)
+	}
+	// the names of the files of the directory. (walked files are sorted by hash)
+	files := func(dir string) []string {
+		var out []string
+		for _, fp := range all[dir].Files {
+			out = append(out, fp.Path)
+		}
+		sort.Strings(out)
+		return out
+	}
+	if diff := cmp.Diff([]string{"foo.txt"}, files("a")); diff != "" {
+		t.Errorf("files of a mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{janitor.IgnoreFile, "keep.txt"}, files("b")); diff != "" {
+		t.Errorf("files of b mismatch (-want +got):\n%s", diff)
+	}
+	// the ignore file of b doesn't apply to c
+	if diff := cmp.Diff([]string{"baz.txt"}, files("c")); diff != "" {
+		t.Errorf("files of c mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := all["a/node_modules"]; ok {
+		t.Errorf("expected a/node_modules not to be walked")
+	}
+	// directories that lack ignored content are partial, as are the directories they are in. ignored junk doesn't count
+	partial := map[string]bool{}
+	for p, dp := range all {
+		partial[p] = dp.Partial
+	}
+	if diff := cmp.Diff(map[string]bool{".": true, "a": true, "b": true, "c": false}, partial); diff != "" {
+		t.Errorf("partial directories mismatch (-want +got):\n%s", diff)
+	}
+	// junk is still reported, despite being ignored
+	if diff := cmp.Diff([]Finding{{Kind: LintJunk, Path: "b/__MACOSX"}}, findings); diff != "" {
+		t.Errorf("lint findings mismatch (-want +got):\n%s", diff)
+	}
+
+	// counting should agree with what was walked
+	n, bytes, err := Count(context.Background(), f, ig)
+	if err != nil {
+		t.Fatalf("Count() unexpected error %v", err)
+	}
+	if n != 4 || bytes != 3+int64(len("*.txt\n!keep.txt\n"))+4+3 {
+		t.Errorf("Count() = %d files, %d bytes", n, bytes)
+	}
+}
+
+// TestWalkWorkers tests whether fingerprinting with workers results in the same DirPrints as doing it one file at a time
+func TestWalkWorkers(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir = filepath.Join(dir, "../testdata")
+	f := os.DirFS(dir)
+	expRoot, expAll, err := WalkFS(f, dir, janitor.Sha256FingerPrint, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("WalkFS() unexpected error %v", err)
+	}
+	var files int64
+	opts := Opts{
+		Workers: 3,
+		Progress: func(p Progress) {
+			files = p.Files
+		},
+	}
+	root, all, err := WalkFSContext(context.Background(), f, dir, janitor.Sha256FingerPrint, ioutil.Discard, opts)
+	if err != nil {
+		t.Fatalf("WalkFSContext() unexpected error %v", err)
+	}
+	if diff := cmp.Diff(expRoot, root); diff != "" {
+		t.Errorf("WalkFSContext() root mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(expAll, all); diff != "" {
+		t.Errorf("WalkFSContext() all mismatch (-want +got):\n%s", diff)
+	}
+	expFiles, _, err := Count(context.Background(), f, nil)
+	if err != nil {
+		t.Fatalf("Count() unexpected error %v", err)
+	}
+	if files != expFiles {
+		t.Errorf("expected progress to report %d files, got %d", expFiles, files)
+	}
+}
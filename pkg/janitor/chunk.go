@@ -0,0 +1,204 @@
+package janitor
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+	"sort"
+)
+
+// Chunk is a part of a file's content, as cut by a Chunker
+type Chunk struct {
+	Hash [32]byte
+	Size int64
+}
+
+// Chunker cuts content into chunks at content-defined boundaries: wherever a rolling hash over the last bytes has a given pattern.
+// Unlike fixed-size blocks, boundaries move along with inserted or removed data, so files that differ by a few bytes
+// still have most of their chunks in common.
+type Chunker struct {
+	Min  int64  // chunks are at least this large (except the last one)
+	Mask uint64 // a boundary is where the rolling hash has none of these bits set. Bit i of the hash only depends on the last i+1 bytes, so these should be the highest bits
+	Max  int64  // chunks are at most this large
+}
+
+// DefaultChunker cuts chunks of 16 to 256 KiB. With the 16 bits of its mask, a boundary follows after another 64 KiB on average (unless Max comes first).
+// Like gear, it must never change, as chunks of snapshots would no longer be comparable.
+var DefaultChunker = Chunker{
+	Min:  16 << 10,
+	Mask: (1<<16 - 1) << 48,
+	Max:  256 << 10,
+}
+
+// gear is the table of random values that the rolling hash mixes in for every byte.
+// It must never change, as chunks of snapshots would no longer be comparable.
+var gear = func() [256]uint64 {
+	var g [256]uint64
+	// splitmix64, with a fixed seed
+	x := uint64(0x6a616e69746f72) // "janitor"
+	for i := range g {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		g[i] = z ^ (z >> 31)
+	}
+	return g
+}()
+
+// ChunkedFingerPrinter returns a FingerPrinter that, in addition to the sha256 of the whole content, computes the chunks of the content.
+// Chunks are only kept for files that have more than one, as the chunk of a smaller file is the file itself.
+func ChunkedFingerPrinter(c Chunker) FingerPrinter {
+	return func(base string, r io.Reader) (FilePrint, error) {
+		pr := FilePrint{Path: base}
+		whole := sha256.New()
+		cw := chunkWriter{c: c, h: sha256.New()}
+		var err error
+		pr.Size, err = io.Copy(io.MultiWriter(whole, &cw), r)
+		if err != nil {
+			return pr, err
+		}
+		cw.cut()
+		copy(pr.Hash[:], whole.Sum(nil))
+		if len(cw.chunks) > 1 {
+			pr.Chunks = cw.chunks
+		}
+		return pr, nil
+	}
+}
+
+// chunkWriter cuts the content written to it into chunks
+type chunkWriter struct {
+	c      Chunker
+	h      hash.Hash // hash of the current chunk
+	size   int64     // size of the current chunk
+	roll   uint64    // rolling hash
+	chunks []Chunk
+}
+
+func (cw *chunkWriter) Write(p []byte) (int, error) {
+	start := 0
+	for i, b := range p {
+		cw.roll = cw.roll<<1 + gear[b]
+		cw.size++
+		if cw.size >= cw.c.Max || cw.size >= cw.c.Min && cw.roll&cw.c.Mask == 0 {
+			cw.h.Write(p[start : i+1])
+			start = i + 1
+			cw.cut()
+		}
+	}
+	cw.h.Write(p[start:])
+	return len(p), nil
+}
+
+// cut ends the current chunk, if it has any data
+func (cw *chunkWriter) cut() {
+	if cw.size == 0 {
+		return
+	}
+	var ch Chunk
+	copy(ch.Hash[:], cw.h.Sum(nil))
+	ch.Size = cw.size
+	cw.chunks = append(cw.chunks, ch)
+	cw.h.Reset()
+	cw.size = 0
+	cw.roll = 0
+}
+
+func chunkSet(chunks []Chunk) map[[32]byte]bool {
+	set := make(map[[32]byte]bool, len(chunks))
+	for _, ch := range chunks {
+		set[ch.Hash] = true
+	}
+	return set
+}
+
+// sharedChunkBytes returns the size of the chunks of a that b has as well. Chunks that occur multiple times in a count once.
+func sharedChunkBytes(a []Chunk, b map[[32]byte]bool) int64 {
+	var shared int64
+	seen := make(map[[32]byte]bool)
+	for _, ch := range a {
+		if b[ch.Hash] && !seen[ch.Hash] {
+			shared += ch.Size
+			seen[ch.Hash] = true
+		}
+	}
+	return shared
+}
+
+// NearDuplicate is a pair of files with different content, that have chunks in common
+type NearDuplicate struct {
+	A, B        FilePrint
+	SharedBytes int64   // size of the chunks they have in common
+	Overlap     float64 // SharedBytes relative to the size of the largest of the two
+}
+
+// maxChunkFiles is the maximum number of files a chunk may occur in, for it to be taken into account by NearDuplicates.
+// Chunks that are very common (e.g. blocks of zeroes) say little about the files being related, and would make us compare a lot of pairs.
+const maxChunkFiles = 100
+
+// NearDuplicates returns the pairs of files within the DirPrint that have at least minOverlap of their content in common, as per their chunks,
+// ordered by descending overlap. Exact duplicates are not included, neither are files without chunks.
+// (see ChunkedFingerPrinter)
+func NearDuplicates(dp DirPrint, minOverlap float64) []NearDuplicate {
+	var files []FilePrint
+	byChunk := make(map[[32]byte][]int) // indices within files of the files that have the chunk
+	chunkSize := make(map[[32]byte]int64)
+	it := dp.Iterator()
+	for it.Next() {
+		f, _ := it.Value()
+		if len(f.Chunks) == 0 {
+			continue
+		}
+		i := len(files)
+		files = append(files, f)
+		for _, ch := range f.Chunks {
+			ids := byChunk[ch.Hash]
+			if len(ids) > 0 && ids[len(ids)-1] == i {
+				// chunk repeated within the file
+				continue
+			}
+			byChunk[ch.Hash] = append(ids, i)
+			chunkSize[ch.Hash] = ch.Size
+		}
+	}
+
+	type pair struct{ a, b int }
+	shared := make(map[pair]int64)
+	for h, ids := range byChunk {
+		if len(ids) < 2 || len(ids) > maxChunkFiles {
+			continue
+		}
+		for x := 0; x < len(ids); x++ {
+			for y := x + 1; y < len(ids); y++ {
+				shared[pair{ids[x], ids[y]}] += chunkSize[h]
+			}
+		}
+	}
+
+	var out []NearDuplicate
+	for p, n := range shared {
+		a, b := files[p.a], files[p.b]
+		if a.Hash == b.Hash {
+			continue
+		}
+		largest := a.Size
+		if b.Size > largest {
+			largest = b.Size
+		}
+		nd := NearDuplicate{A: a, B: b, SharedBytes: n, Overlap: float64(n) / float64(largest)}
+		if nd.Overlap >= minOverlap {
+			out = append(out, nd)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Overlap != out[j].Overlap {
+			return out[i].Overlap > out[j].Overlap
+		}
+		if out[i].A.Path != out[j].A.Path {
+			return out[i].A.Path < out[j].A.Path
+		}
+		return out[i].B.Path < out[j].B.Path
+	})
+	return out
+}
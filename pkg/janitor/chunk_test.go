@@ -0,0 +1,167 @@
+package janitor
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testChunker cuts small chunks, so that tests don't need large content
+var testChunker = Chunker{Min: 64, Mask: (1<<6 - 1) << 58, Max: 512}
+
+func randomContent(seed int64, n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func chunkedPrint(t *testing.T, path string, content []byte) FilePrint {
+	t.Helper()
+	fp, err := ChunkedFingerPrinter(testChunker)(path, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func TestChunkedFingerPrinter(t *testing.T) {
+	content := randomContent(1, 10000)
+	got := chunkedPrint(t, "foo", content)
+
+	exp, err := Sha256FingerPrint("foo", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Path != exp.Path || got.Size != exp.Size || got.Hash != exp.Hash {
+		t.Errorf("ChunkedFingerPrinter() = %s, want %s", got, exp)
+	}
+
+	var total int64
+	for i, ch := range got.Chunks {
+		total += ch.Size
+		if ch.Size > testChunker.Max || ch.Size < testChunker.Min && i < len(got.Chunks)-1 {
+			t.Errorf("chunk %d has size %d, want within [%d, %d]", i, ch.Size, testChunker.Min, testChunker.Max)
+		}
+	}
+	if total != got.Size {
+		t.Errorf("chunks add up to %d bytes, want %d", total, got.Size)
+	}
+	// 10000 bytes in chunks of on average 128 bytes
+	if len(got.Chunks) < 40 {
+		t.Errorf("got %d chunks, want at least 40", len(got.Chunks))
+	}
+
+	// how the content is written must not matter
+	again, err := ChunkedFingerPrinter(testChunker)("foo", &oneByteReader{content})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(got, again); diff != "" {
+		t.Errorf("ChunkedFingerPrinter() mismatch when reading a byte at a time (-want +got):\n%s", diff)
+	}
+
+	// content that fits in one chunk has no chunks
+	small := chunkedPrint(t, "foo", content[:50])
+	if small.Chunks != nil {
+		t.Errorf("got %d chunks for content smaller than the minimum chunk size, want none", len(small.Chunks))
+	}
+}
+
+type oneByteReader struct {
+	b []byte
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.b) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = r.b[0]
+	r.b = r.b[1:]
+	return 1, nil
+}
+
+// TestChunkedInsertion tests that inserting bytes only changes the chunks around the insertion
+func TestChunkedInsertion(t *testing.T) {
+	content := randomContent(2, 20000)
+	edited := append(append(append([]byte{}, content[:10000]...), "inserted"...), content[10000:]...)
+
+	a := chunkedPrint(t, "a", content)
+	b := chunkedPrint(t, "b", edited)
+	shared := sharedChunkBytes(a.Chunks, chunkSet(b.Chunks))
+	if shared < a.Size-2*testChunker.Max {
+		t.Errorf("files share %d of %d bytes, want at most 2 chunks to differ", shared, a.Size)
+	}
+}
+
+func TestCompareSimilarityNear(t *testing.T) {
+	content := randomContent(3, 20000)
+	edited := append([]byte{}, content...)
+	edited[15000] ^= 0xff
+
+	a := DirPrint{Path: "a", Files: []FilePrint{chunkedPrint(t, "log", content)}}
+	b := DirPrint{Path: "b", Files: []FilePrint{chunkedPrint(t, "log", edited)}}
+	c := Compare(a, b)
+	if len(c.Changed) != 1 {
+		t.Fatalf("expected the file to be changed, got %+v", c)
+	}
+	sim := c.Similarity()
+	if sim.BytesSame != 0 || sim.BytesDiff != 40000 {
+		t.Errorf("got %d bytes same and %d bytes diff, want 0 and 40000", sim.BytesSame, sim.BytesDiff)
+	}
+	// one chunk differs on both sides
+	if sim.BytesNear < 40000-2*testChunker.Max || sim.BytesNear >= 40000 {
+		t.Errorf("got %d near bytes, want all but one chunk per side", sim.BytesNear)
+	}
+	if got := sim.NearContentSimilarity(); got < 0.95 || got >= 1 {
+		t.Errorf("NearContentSimilarity() = %f, want within [0.95, 1)", got)
+	}
+
+	// without chunks, near similarity is content similarity
+	plain := Similarity{BytesSame: 30, BytesDiff: 70}
+	if plain.NearContentSimilarity() != plain.ContentSimilarity() {
+		t.Errorf("NearContentSimilarity() = %f, want %f", plain.NearContentSimilarity(), plain.ContentSimilarity())
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+	content := randomContent(4, 20000)
+	appended := append(append([]byte{}, content...), randomContent(5, 5000)...)
+	other := randomContent(6, 20000)
+
+	orig := chunkedPrint(t, "orig", content)
+	copied := chunkedPrint(t, "copy", content)
+	grown := chunkedPrint(t, "grown", appended)
+	unrelated := chunkedPrint(t, "other", other)
+	root := DirPrint{
+		Path:  "root",
+		Files: []FilePrint{copied, grown, orig, unrelated},
+	}
+
+	got := NearDuplicates(root, 0.5)
+	// the exact copies are not near-duplicates of each other, but both are of the grown file
+	if len(got) != 2 {
+		t.Fatalf("NearDuplicates() returned %d pairs, want 2: %+v", len(got), got)
+	}
+	for _, nd := range got {
+		paths := []string{nd.A.Path, nd.B.Path}
+		if paths[0] != "grown" && paths[1] != "grown" {
+			t.Errorf("unexpected pair %v", paths)
+		}
+		if nd.SharedBytes < 20000-testChunker.Max || nd.SharedBytes > 20000 {
+			t.Errorf("pair %v shares %d bytes, want about 20000", paths, nd.SharedBytes)
+		}
+		if exp := float64(nd.SharedBytes) / 25000; nd.Overlap != exp {
+			t.Errorf("pair %v has overlap %f, want %f", paths, nd.Overlap, exp)
+		}
+	}
+
+	if got := NearDuplicates(root, 0.9); len(got) != 0 {
+		t.Errorf("NearDuplicates() with a minimum overlap of 0.9 returned %d pairs, want none", len(got))
+	}
+}
@@ -0,0 +1,196 @@
+package janitor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cluster is a group of directories that are all copies of each other.
+// Where GetPairSims reports n copies as n×(n-1)/2 pairs, they form a single cluster.
+type Cluster struct {
+	Members      []ClusterMember // by path
+	Size         int64           // size of a copy (the smallest, if they are not identical)
+	Reclaimable  int64           // bytes freed by removing the copies as per Plan, when the cluster was made. 0 if the members are merely similar, as they are left to review
+	Identical    bool            // whether the members are identical, as opposed to merely similar (see ClusterOpts.MinContent) or partial (see PairSim.Partial)
+	Keeper       int             // index within Members of the copy that is suggested to keep
+	KeeperReason string          // name of the keeper rule that made the keeper win over the runner-up, or the kept copy of another cluster that it goes along with (see Keeper.Choose). "" if none did
+}
+
+// ClusterMember is a directory within a cluster
+type ClusterMember struct {
+	Path    string    // key within the DirPrints
+	Size    int64     // total size of its files
+	ModTime time.Time // zero if unknown
+	Archive bool      // whether it is a zip file, or within one
+	Temp    bool      // whether it, or a directory it is in, is temporary (see Keeper.TempPatterns)
+	Partial bool      // whether some of its content was not scanned (see DirPrint.Partial), so it may hold more than its copies
+}
+
+// ClusterOpts are the options for clustering pairs. The zero value clusters identical pairs, and suggests the first member as keeper.
+type ClusterOpts struct {
+	MinContent float64                     // pairs with at least this content similarity (see Similarity.NearContentSimilarity) are clustered as well. 0 means only identical pairs
+	Keeper     Keeper                      // how to choose the copy to keep
+	Root       string                      // absolute path that the keys of the DirPrints are relative to, to match preferred roots against
+	ModTime    func(path string) time.Time // returns the modification time of the directory (key of the DirPrints), zero if unknown. nil means unknown for all
+}
+
+// Clusters groups the directories of the pairs that are copies of each other into clusters: pairs that are identical
+// (or similar enough, see ClusterOpts.MinContent) link their directories, and all linked directories form a cluster.
+// Note that with a MinContent, members may be linked through others, without being similar enough to each other directly.
+// Pairs that are identical but partial link their directories as well, but like similar pairs, make the cluster merely similar:
+// the content that was not scanned may differ.
+// A member that is within another member of the same cluster is left out, as removing the latter removes it too.
+// Members of different clusters can be nested though: the keepers are chosen such that they are consistent (see Keeper.Choose).
+// Pairs of incomplete DirPrints are never clustered.
+// The clusters are ordered by descending reclaimable bytes.
+func Clusters(all map[string]DirPrint, pairs []PairSim, opts ClusterOpts) []Cluster {
+	parent := make(map[string]string)
+	var find func(p string) string
+	find = func(p string) string {
+		if parent[p] == p {
+			return p
+		}
+		root := find(parent[p])
+		parent[p] = root
+		return root
+	}
+	similar := make(map[string]bool) // roots of the sets that were linked by a pair that is not identical
+
+	for _, p := range pairs {
+		if !opts.copies(p) {
+			continue
+		}
+		identical := p.Sim.Identical() && !p.Partial
+		for _, path := range []string{p.Path1, p.Path2} {
+			if _, ok := parent[path]; !ok {
+				parent[path] = path
+			}
+		}
+		r1, r2 := find(p.Path1), find(p.Path2)
+		if r1 != r2 {
+			parent[r2] = r1
+			similar[r1] = similar[r1] || similar[r2]
+		}
+		if !identical {
+			similar[r1] = true
+		}
+	}
+
+	sets := make(map[string][]string)
+	for path := range parent {
+		r := find(path)
+		sets[r] = append(sets[r], path)
+	}
+
+	var clusters []Cluster
+	for r, paths := range sets {
+		sort.Strings(paths)
+		var members []ClusterMember
+		for _, path := range paths {
+			nested := false
+			for _, other := range paths {
+				if other != path && Child(other, path) {
+					nested = true
+					break
+				}
+			}
+			if nested {
+				continue
+			}
+			members = append(members, opts.member(all, path))
+		}
+		if len(members) < 2 {
+			continue
+		}
+		c := Cluster{
+			Members:   members,
+			Size:      members[0].Size,
+			Identical: !similar[r],
+		}
+		for _, m := range members {
+			if m.Size < c.Size {
+				c.Size = m.Size
+			}
+		}
+		clusters = append(clusters, c)
+	}
+
+	// sets are unordered, but choosing the keepers depends on the order of the clusters
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i].Members[0].Path < clusters[j].Members[0].Path
+	})
+	opts.Keeper.Choose(clusters, opts.Root, nil)
+	for i, d := range Plan(clusters) {
+		clusters[i].Reclaimable = d.Reclaimable()
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Reclaimable != clusters[j].Reclaimable {
+			return clusters[i].Reclaimable > clusters[j].Reclaimable
+		}
+		return clusters[i].Members[0].Path < clusters[j].Members[0].Path
+	})
+	return clusters
+}
+
+// copies returns whether the directories of the pair are copies of each other: identical, or similar enough as per MinContent.
+// Incomplete pairs never are.
+func (opts ClusterOpts) copies(p PairSim) bool {
+	if p.Incomplete {
+		return false
+	}
+	return p.Sim.Identical() || opts.MinContent > 0 && p.Sim.NearContentSimilarity() >= opts.MinContent
+}
+
+// member returns the directory (key within all) as a member of a cluster
+func (opts ClusterOpts) member(all map[string]DirPrint, path string) ClusterMember {
+	m := ClusterMember{
+		Path:    path,
+		Size:    dirSize(all[path]),
+		Archive: archived(all, path),
+		Temp:    opts.Keeper.temp(opts.Root, path),
+		Partial: all[path].Partial,
+	}
+	if opts.ModTime != nil {
+		m.ModTime = opts.ModTime(path)
+	}
+	return m
+}
+
+// archived returns whether the directory (key within all) is a zip file, or within one.
+// Like the walk, we recognize zip files by their extension.
+func archived(all map[string]DirPrint, path string) bool {
+	for p := path; p != "." && p != "/"; p = filepath.Dir(p) {
+		if _, ok := all[p]; ok && filepath.Ext(p) == ".zip" {
+			return true
+		}
+	}
+	return false
+}
+
+// dirSize returns the total size of the files within the DirPrint
+func dirSize(dp DirPrint) int64 {
+	var size int64
+	for _, f := range dp.Files {
+		size += f.Size
+	}
+	for _, d := range dp.Dirs {
+		size += dirSize(d)
+	}
+	return size
+}
+
+// String returns the paths of the members, marking the keeper
+func (c Cluster) String() string {
+	var paths []string
+	for i, m := range c.Members {
+		if i == c.Keeper {
+			paths = append(paths, "*"+m.Path)
+		} else {
+			paths = append(paths, m.Path)
+		}
+	}
+	return "<Cluster " + strings.Join(paths, " ") + ">"
+}
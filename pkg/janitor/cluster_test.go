@@ -0,0 +1,111 @@
+package janitor
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClusters(t *testing.T) {
+	project := func(name string) DirPrint {
+		return DirPrint{Path: name, Files: []FilePrint{
+			{Path: "foo", Size: 3, Hash: FooHash},
+			{Path: "bar", Size: 5, Hash: BarHash},
+		}}
+	}
+	all := map[string]DirPrint{
+		".": {Path: ".", Dirs: []DirPrint{project("a"), project("b"), project("c"), project("d"), project("e")}},
+	}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		all[name] = project(name)
+	}
+	// a copy that lost a file
+	all["f"] = DirPrint{Path: "f", Files: []FilePrint{{Path: "foo", Size: 3, Hash: FooHash}}}
+	all["."] = DirPrint{Path: ".", Dirs: append(all["."].Dirs, all["f"])}
+
+	pairs := GetPairSims(all, ioutil.Discard)
+	if len(pairs) != 15 {
+		t.Fatalf("expected 15 pairs, got %d", len(pairs))
+	}
+
+	got := Clusters(all, pairs, ClusterOpts{})
+	exp := []Cluster{{
+		Members: []ClusterMember{
+			{Path: "a", Size: 8}, {Path: "b", Size: 8}, {Path: "c", Size: 8}, {Path: "d", Size: 8}, {Path: "e", Size: 8},
+		},
+		Size:        8,
+		Reclaimable: 32,
+		Identical:   true,
+	}}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("Clusters() mismatch (-want +got):\n%s", diff)
+	}
+
+	// f is 3/8 similar to the others. (foo matches, on one side. see Similarity.NearContentSimilarity)
+	got = Clusters(all, pairs, ClusterOpts{MinContent: 0.3})
+	if len(got) != 1 || len(got[0].Members) != 6 || got[0].Identical || got[0].Size != 3 || got[0].Reclaimable != 0 {
+		t.Errorf("Clusters() with a minimum content similarity = %+v, want a cluster of 6 similar members of 3 bytes, left to review", got)
+	}
+
+	// partial pairs are clustered, but as merely similar
+	partial := append([]PairSim(nil), pairs...)
+	for i := range partial {
+		partial[i].Partial = true
+	}
+	got = Clusters(all, partial, ClusterOpts{})
+	if len(got) != 1 || len(got[0].Members) != 5 || got[0].Identical || got[0].Reclaimable != 0 {
+		t.Errorf("Clusters() of partial pairs = %+v, want a cluster of 5 similar members, left to review", got)
+	}
+
+	// incomplete pairs are not clustered
+	for i := range pairs {
+		pairs[i].Incomplete = true
+	}
+	if got := Clusters(all, pairs, ClusterOpts{}); len(got) != 0 {
+		t.Errorf("Clusters() of incomplete pairs = %+v, want none", got)
+	}
+}
+
+func TestClustersNested(t *testing.T) {
+	all := map[string]DirPrint{
+		"x":     {Path: "x"},
+		"x/sub": {Path: "sub"},
+		"y":     {Path: "y"},
+	}
+	pairs := []PairSim{
+		{Path1: "x", Path2: "y", Sim: Similarity{BytesSame: 1, PathSim: 1}},
+		{Path1: "x/sub", Path2: "y", Sim: Similarity{BytesSame: 1, PathSim: 1}},
+	}
+	got := Clusters(all, pairs, ClusterOpts{})
+	if len(got) != 1 || len(got[0].Members) != 2 || got[0].Members[0].Path != "x" || got[0].Members[1].Path != "y" {
+		t.Errorf("Clusters() = %+v, want a cluster of x and y", got)
+	}
+}
+
+// TestClustersNestedKeepers tests that the keepers of clusters of which the members are nested are consistent:
+// x and y are copies, and so are their subdirectories along with z/sub. Keeping x/sub while removing x would remove the last copy of sub.
+func TestClustersNestedKeepers(t *testing.T) {
+	sub := DirPrint{Path: "sub", Files: []FilePrint{{Path: "a.jpg", Size: 3, Hash: FooHash}}}
+	root := DirPrint{Path: ".", Dirs: []DirPrint{
+		{Path: "x", Files: []FilePrint{{Path: "readme", Size: 5, Hash: BarHash}}, Dirs: []DirPrint{sub}},
+		{Path: "y", Files: []FilePrint{{Path: "readme", Size: 5, Hash: BarHash}}, Dirs: []DirPrint{sub}},
+		{Path: "z", Files: []FilePrint{{Path: "other", Size: 6, Hash: FooBarHash}}, Dirs: []DirPrint{sub}},
+	}}
+	all := Flatten(root)
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	// on their own, the oldest of x and y is y, and the oldest of the subdirectories is x/sub
+	times := map[string]time.Time{"x": day(2), "y": day(1), "x/sub": day(1), "y/sub": day(2), "z/sub": day(3)}
+	opts := ClusterOpts{Keeper: Keeper{Rules: []string{"oldest"}}, ModTime: func(p string) time.Time { return times[p] }}
+
+	got := Clusters(all, GetPairSims(all, ioutil.Discard), opts)
+	var keepers []string
+	for _, c := range got {
+		keepers = append(keepers, c.String()+" "+c.KeeperReason)
+	}
+	exp := []string{"<Cluster x *y> oldest", "<Cluster x/sub *y/sub z/sub> along with y"}
+	if diff := cmp.Diff(exp, keepers); diff != "" {
+		t.Errorf("Clusters() mismatch (-want +got):\n%s", diff)
+	}
+}
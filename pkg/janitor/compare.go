@@ -0,0 +1,458 @@
+package janitor
+
+import (
+	"bytes"
+	"math"
+	"sort"
+)
+
+// Comparison explains, file by file, how two DirPrints A and B relate. Every file of both is accounted for exactly once.
+// Paths are relative to A and B respectively.
+type Comparison struct {
+	Matched []Match        // files with the same content on both sides, in order of their hash
+	OnlyA   []FilePrint    // files of A without a match in B (and not changed), by path
+	OnlyB   []FilePrint    // files of B without a match in A (and not changed), by path
+	Changed []Change       // files without a match, that exist at the same path on both sides, by path
+	Similar []SimilarImage // images without a match, that look the same as one on the other side, by path in A
+}
+
+// Match is a file of A and a file of B with the same content
+type Match struct {
+	A, B    FilePrint
+	PathSim float64 // similarity of their paths
+}
+
+// Normalized returns whether the files only have the same content after normalization, see TextFingerPrint.
+// In other words, there is no byte-level copy.
+func (m Match) Normalized() bool {
+	return m.A.rawHash() != m.B.rawHash()
+}
+
+// Change is a file of A and a file of B with the same path, but different content
+type Change struct {
+	A, B FilePrint
+}
+
+// SimilarImage is an image of A and an image of B with different content, that look the same
+type SimilarImage struct {
+	A, B     FilePrint
+	Distance int // Hamming distance of their ImageHashes
+}
+
+// Compare compares the DirPrints, comparing the paths of matching files with the HammingMetric.
+// See NewSimilarityMetric for how files are matched.
+func Compare(a, b DirPrint) Comparison {
+	return CompareMetric(a, b, HammingMetric)
+}
+
+// CompareMetric is like Compare, but compares the paths of matching files with the given metric. nil means HammingMetric
+func CompareMetric(a, b DirPrint, metric PathMetric) Comparison {
+	return CompareOpts(a, b, PairOpts{PathMetric: metric})
+}
+
+// CompareOpts is like Compare, but takes the path metric and image distance from the options
+func CompareOpts(a, b DirPrint, opts PairOpts) Comparison {
+	return compareIterators(a.Iterator(), b.Iterator(), opts.pathMetric()).matchImages(opts.imageDistance())
+}
+
+// Similarity summarizes the comparison. Changed files and similar images count as different bytes, on both sides.
+// Of the other files without a match, the bytes in chunks that the other side has as well count as near bytes.
+func (c Comparison) Similarity() Similarity {
+	var t tally
+	for _, m := range c.Matched {
+		t.match(m)
+	}
+	t.rest(c)
+	return t.similarity()
+}
+
+// tally adds up the Similarity of a comparison, file by file. Both Comparison.Similarity and similarity (which doesn't
+// keep all files) use it, so they can't disagree.
+type tally struct {
+	sim     Similarity
+	pathSim float64 // sum of the path similarities of the matches
+}
+
+// match counts the matching files
+func (t *tally) match(m Match) {
+	t.sim.BytesSame += m.A.Size
+	t.sim.FilesSame++
+	t.pathSim += m.PathSim
+	if m.Normalized() {
+		t.sim.FilesNormalized++
+	}
+}
+
+// unmatched counts a file without a match
+func (t *tally) unmatched(f FilePrint) {
+	t.sim.BytesDiff += f.Size
+}
+
+// rest counts the files of the comparison that have no match, including the similar and near bytes among them
+func (t *tally) rest(c Comparison) {
+	var chunksA, chunksB []Chunk
+	for _, f := range c.OnlyA {
+		t.unmatched(f)
+		chunksA = append(chunksA, f.Chunks...)
+	}
+	for _, f := range c.OnlyB {
+		t.unmatched(f)
+		chunksB = append(chunksB, f.Chunks...)
+	}
+	for _, ch := range c.Changed {
+		t.unmatched(ch.A)
+		t.unmatched(ch.B)
+		chunksA = append(chunksA, ch.A.Chunks...)
+		chunksB = append(chunksB, ch.B.Chunks...)
+	}
+	for _, si := range c.Similar {
+		t.unmatched(si.A)
+		t.unmatched(si.B)
+		t.sim.BytesSimilar += si.A.Size + si.B.Size
+	}
+	if len(chunksA) > 0 && len(chunksB) > 0 {
+		t.sim.BytesNear = sharedChunkBytes(chunksA, chunkSet(chunksB)) + sharedChunkBytes(chunksB, chunkSet(chunksA))
+	}
+}
+
+func (t *tally) similarity() Similarity {
+	sim := t.sim
+	if sim.FilesSame > 0 {
+		sim.PathSim = t.pathSim / float64(sim.FilesSame)
+	}
+	return sim
+}
+
+func compareIterators(a, b Iterator, metric PathMetric) Comparison {
+	var c Comparison
+	mergeGroups(a, b, metric,
+		func(fa, fb FilePrint, pathSim float64) {
+			c.Matched = append(c.Matched, Match{A: fa, B: fb, PathSim: pathSim})
+		},
+		func(f FilePrint) { c.OnlyA = append(c.OnlyA, f) },
+		func(f FilePrint) { c.OnlyB = append(c.OnlyB, f) },
+	)
+	c.findChanged()
+	return c
+}
+
+// similarity returns the Similarity of compareIterators followed by matchImages, but rather than building the full Comparison,
+// it tallies the matches and most files without a match as they are merged. Only the files without a match that may have near bytes
+// or look like another image (those with chunks or an image hash) are kept, to find the changed files and similar images among them,
+// exactly like Compare does.
+// GetPairSims compares many pairs, but only needs their Similarity, which this gets with few allocations.
+func similarity(a, b Iterator, metric PathMetric, imageDistance int) Similarity {
+	var t tally
+	var rest Comparison
+	kept := func(f FilePrint) bool {
+		return len(f.Chunks) > 0 || f.ImageHash != nil
+	}
+	mergeGroups(a, b, metric,
+		func(fa, fb FilePrint, pathSim float64) {
+			t.match(Match{A: fa, B: fb, PathSim: pathSim})
+		},
+		func(f FilePrint) {
+			if kept(f) {
+				rest.OnlyA = append(rest.OnlyA, f)
+			} else {
+				t.unmatched(f)
+			}
+		},
+		func(f FilePrint) {
+			if kept(f) {
+				rest.OnlyB = append(rest.OnlyB, f)
+			} else {
+				t.unmatched(f)
+			}
+		},
+	)
+	if len(rest.OnlyA) > 0 && len(rest.OnlyB) > 0 {
+		rest.findChanged()
+		rest = rest.matchImages(imageDistance)
+	}
+	t.rest(rest)
+	return t.similarity()
+}
+
+// mergeGroups merges the files of both iterators, which are ordered by hash, calling match for every file of a that is paired up
+// with a file of b with the same hash (see matchGroups), and onlyA and onlyB for the files that are not.
+func mergeGroups(a, b Iterator, metric PathMetric, match func(fa, fb FilePrint, pathSim float64), onlyA, onlyB func(f FilePrint)) {
+	// the groups are reused, as most of them hold a single file
+	var bufA, bufB []FilePrint
+	a.Next()
+	b.Next()
+	ga := nextGroup(a, bufA)
+	gb := nextGroup(b, bufB)
+
+	for len(ga) > 0 || len(gb) > 0 {
+		cmp := 0
+		switch {
+		case len(gb) == 0:
+			cmp = -1
+		case len(ga) == 0:
+			cmp = 1
+		default:
+			cmp = bytes.Compare(ga[0].Hash[:], gb[0].Hash[:])
+		}
+
+		if cmp < 0 {
+			for _, f := range ga {
+				onlyA(f)
+			}
+			ga = nextGroup(a, ga)
+			continue
+		}
+		if cmp > 0 {
+			for _, f := range gb {
+				onlyB(f)
+			}
+			gb = nextGroup(b, gb)
+			continue
+		}
+
+		// we assume here that the files are the same size
+		// specifically, that sha256 hashes don't collide.
+		if len(ga) == 1 && len(gb) == 1 {
+			match(ga[0], gb[0], metric(ga[0].Path, gb[0].Path))
+		} else {
+			usedA := make([]bool, len(ga))
+			usedB := make([]bool, len(gb))
+			for _, m := range matchGroups(ga, gb, metric) {
+				match(ga[m.a], gb[m.b], m.sim)
+				usedA[m.a], usedB[m.b] = true, true
+			}
+			for i, f := range ga {
+				if !usedA[i] {
+					onlyA(f)
+				}
+			}
+			for i, f := range gb {
+				if !usedB[i] {
+					onlyB(f)
+				}
+			}
+		}
+		ga = nextGroup(a, ga)
+		gb = nextGroup(b, gb)
+	}
+}
+
+// findChanged moves the files without a match that exist on both sides under the same path from OnlyA and OnlyB to Changed,
+// and sorts them all by path. (paths are unique within each side)
+func (c *Comparison) findChanged() {
+	onlyB := make(map[string]int)
+	for i, f := range c.OnlyB {
+		onlyB[f.Path] = i
+	}
+	changedB := make(map[int]bool)
+	var onlyA []FilePrint
+	for _, f := range c.OnlyA {
+		if i, ok := onlyB[f.Path]; ok {
+			c.Changed = append(c.Changed, Change{A: f, B: c.OnlyB[i]})
+			changedB[i] = true
+			continue
+		}
+		onlyA = append(onlyA, f)
+	}
+	var onlyBUnchanged []FilePrint
+	for i, f := range c.OnlyB {
+		if !changedB[i] {
+			onlyBUnchanged = append(onlyBUnchanged, f)
+		}
+	}
+	c.OnlyA, c.OnlyB = onlyA, onlyBUnchanged
+
+	sortByPath(c.OnlyA)
+	sortByPath(c.OnlyB)
+	sort.Slice(c.Changed, func(i, j int) bool {
+		return c.Changed[i].A.Path < c.Changed[j].A.Path
+	})
+}
+
+func sortByPath(files []FilePrint) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+}
+
+// nextGroup returns the current value of the iterator, along with all following values with the same hash,
+// and advances the iterator past them. It returns nil if the iterator is exhausted.
+// The group is stored in buf (the previous group, which is overwritten), if it has the room.
+func nextGroup(it Iterator, buf []FilePrint) []FilePrint {
+	first, ok := it.Value()
+	if !ok {
+		return nil
+	}
+	group := append(buf[:0], first)
+	for it.Next() {
+		v, _ := it.Value()
+		if v.Hash != first.Hash {
+			break
+		}
+		group = append(group, v)
+	}
+	return group
+}
+
+// groupMatch is a pairing of a file in group a with one in group b
+type groupMatch struct {
+	a, b int     // indices within the groups
+	sim  float64 // path similarity
+}
+
+// maxAssignment is the largest number of candidate pairs (files in group a times files in group b) for which we find the optimal assignment.
+// The Hungarian algorithm is cubic, so for larger groups (e.g. thousands of empty files) we settle for greedy matching instead.
+const maxAssignment = 10000
+
+// matchGroups pairs up as many files of group a with files of group b as possible (the smallest of the two group sizes),
+// such that the sum of their path similarities is maximal.
+// The result is sorted by the index within group a.
+func matchGroups(a, b []FilePrint, metric PathMetric) []groupMatch {
+	if len(a) == 1 && len(b) == 1 {
+		return []groupMatch{{0, 0, metric(a[0].Path, b[0].Path)}}
+	}
+	if len(a)*len(b) > maxAssignment {
+		return matchGroupsGreedy(a, b, metric)
+	}
+
+	// rows are the files of the smallest group
+	rows, cols := a, b
+	if len(a) > len(b) {
+		rows, cols = b, a
+	}
+	sims := make([][]float64, len(rows))
+	for i, r := range rows {
+		sims[i] = make([]float64, len(cols))
+		for j, c := range cols {
+			if len(a) > len(b) {
+				sims[i][j] = metric(c.Path, r.Path)
+			} else {
+				sims[i][j] = metric(r.Path, c.Path)
+			}
+		}
+	}
+	var matches []groupMatch
+	for i, j := range assign(sims) {
+		if len(a) > len(b) {
+			matches = append(matches, groupMatch{j, i, sims[i][j]})
+		} else {
+			matches = append(matches, groupMatch{i, j, sims[i][j]})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].a < matches[j].a
+	})
+	return matches
+}
+
+// matchGroupsGreedy is like matchGroups, but rather than finding the optimal pairing, it pairs up files with identical paths,
+// and the others in order.
+func matchGroupsGreedy(a, b []FilePrint, metric PathMetric) []groupMatch {
+	var matches []groupMatch
+	usedA := make([]bool, len(a))
+	usedB := make([]bool, len(b))
+	byPath := make(map[string][]int)
+	for j, f := range b {
+		byPath[f.Path] = append(byPath[f.Path], j)
+	}
+	for i, f := range a {
+		if js := byPath[f.Path]; len(js) > 0 {
+			byPath[f.Path] = js[1:]
+			usedA[i], usedB[js[0]] = true, true
+			matches = append(matches, groupMatch{i, js[0], 1})
+		}
+	}
+	j := 0
+	for i := range a {
+		if usedA[i] {
+			continue
+		}
+		for j < len(b) && usedB[j] {
+			j++
+		}
+		if j == len(b) {
+			break
+		}
+		usedB[j] = true
+		matches = append(matches, groupMatch{i, j, metric(a[i].Path, b[j].Path)})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].a < matches[j].a
+	})
+	return matches
+}
+
+// assign solves the assignment problem with the Hungarian algorithm: it assigns each row of the weight matrix to a different column,
+// such that the sum of their weights is maximal. There may not be more rows than columns.
+// It returns the column assigned to each row.
+func assign(weights [][]float64) []int {
+	n := len(weights)
+	if n == 0 {
+		return nil
+	}
+	m := len(weights[0])
+
+	// this is the classic formulation that minimizes the cost, which is the negated weight.
+	// u and v are the potentials of the rows and columns, p[j] is the row assigned to column j,
+	// and way[j] is the previous column on the augmenting path to column j.
+	// all of these are 1-based, with index 0 as a sentinel.
+	inf := math.Inf(1)
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		for j := range minv {
+			minv[j] = inf
+		}
+		used := make([]bool, m+1)
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := inf
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := -weights[i0-1][j-1] - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	cols := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			cols[p[j]-1] = j - 1
+		}
+	}
+	return cols
+}
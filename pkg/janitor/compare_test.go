@@ -0,0 +1,142 @@
+package janitor
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompare(t *testing.T) {
+	fp := func(p string, hash [32]byte, size int64) FilePrint {
+		return FilePrint{Path: p, Hash: hash, Size: size}
+	}
+	a := DirPrint{
+		Path: "a",
+		Files: []FilePrint{
+			fp("same", h1, 10),
+			fp("renamed", h2, 20),
+			fp("changed", h3, 30),
+			fp("left", h4, 40),
+			fp("copy1", h7, 5),
+			fp("copy2", h7, 5),
+		},
+	}
+	b := DirPrint{
+		Path: "b",
+		Files: []FilePrint{
+			fp("same", h1, 10),
+			fp("changed", h5, 31),
+		},
+		Dirs: []DirPrint{
+			{
+				Path: "sub",
+				Files: []FilePrint{
+					fp("renamed", h2, 20),
+					fp("right", h6, 60),
+					fp("copy2", h7, 5),
+				},
+			},
+		},
+	}
+
+	// with the hamming metric, both copies would be as similar to sub/copy2
+	lev := LevenshteinMetric
+	got := CompareMetric(a, b, lev)
+	exp := Comparison{
+		Matched: []Match{
+			{A: fp("same", h1, 10), B: fp("same", h1, 10), PathSim: 1},
+			{A: fp("renamed", h2, 20), B: fp("sub/renamed", h2, 20), PathSim: lev("renamed", "sub/renamed")},
+			// of both copies, the one with the most similar path is matched
+			{A: fp("copy2", h7, 5), B: fp("sub/copy2", h7, 5), PathSim: lev("copy2", "sub/copy2")},
+		},
+		OnlyA: []FilePrint{fp("copy1", h7, 5), fp("left", h4, 40)},
+		OnlyB: []FilePrint{fp("sub/right", h6, 60)},
+		Changed: []Change{
+			{A: fp("changed", h3, 30), B: fp("changed", h5, 31)},
+		},
+	}
+	// Matched is in order of hash
+	sort.Slice(exp.Matched, func(i, j int) bool {
+		return bytes.Compare(exp.Matched[i].A.Hash[:], exp.Matched[j].A.Hash[:]) < 0
+	})
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("Compare() mismatch (-want +got):\n%s", diff)
+	}
+
+	expSim := Similarity{
+		BytesSame: 10 + 20 + 5,
+		BytesDiff: 5 + 40 + 60 + 30 + 31,
+		FilesSame: 3,
+		PathSim:   (1 + lev("renamed", "sub/renamed") + lev("copy2", "sub/copy2")) / 3,
+	}
+	if diff := cmp.Diff(expSim, got.Similarity()); diff != "" {
+		t.Errorf("Similarity() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// TestCompareSimilarity tests that the comparison accounts for every file, and agrees with NewSimilarity, for all pairs of the test data
+func TestCompareSimilarity(t *testing.T) {
+	count := func(dp DirPrint) int {
+		n := 0
+		it := dp.Iterator()
+		for it.Next() {
+			n++
+		}
+		return n
+	}
+	all := Flatten(DataMainPrint)
+	for k1, dp1 := range all {
+		for k2, dp2 := range all {
+			for name, metric := range PathMetrics {
+				c := CompareMetric(dp1, dp2, metric)
+				if n := len(c.Matched) + len(c.OnlyA) + len(c.Changed); n != count(dp1) {
+					t.Errorf("%s: Compare(%q, %q) accounts for %d files of A, expected %d", name, k1, k2, n, count(dp1))
+				}
+				if n := len(c.Matched) + len(c.OnlyB) + len(c.Changed); n != count(dp2) {
+					t.Errorf("%s: Compare(%q, %q) accounts for %d files of B, expected %d", name, k1, k2, n, count(dp2))
+				}
+				sim := NewSimilarityMetric(dp1.Iterator(), dp2.Iterator(), metric)
+				if diff := cmp.Diff(sim, c.Similarity()); diff != "" {
+					t.Errorf("%s: Compare(%q, %q).Similarity() mismatch with NewSimilarity (-want +got):\n%s", name, k1, k2, diff)
+				}
+			}
+		}
+	}
+}
+
+// TestSimilarityCounts tests that counting the similarity gets the same result as building the full comparison
+func TestSimilarityCounts(t *testing.T) {
+	h := func(v uint64) *uint64 { return &v }
+	content := randomContent(3, 20000)
+	edited := append([]byte{}, content...)
+	edited[15000] ^= 0xff
+
+	all := Flatten(DataMainPrint)
+	all["img1"] = DirPrint{Path: "img1", Files: []FilePrint{
+		{Path: "IMG_1.jpg", Size: 1000, Hash: FooHash, ImageHash: h(0xff00)},
+		{Path: "IMG_2.jpg", Size: 1000, Hash: BarHash, ImageHash: h(0x00ff)},
+		{Path: "notes.txt", Size: 10, Hash: [32]byte{3}},
+	}}
+	all["img2"] = DirPrint{Path: "img2", Files: []FilePrint{
+		{Path: "small/IMG_1.jpg", Size: 100, Hash: [32]byte{1}, ImageHash: h(0xff01)},
+		{Path: "IMG_2.jpg", Size: 200, Hash: [32]byte{2}, ImageHash: h(0xf0f0)},
+		{Path: "notes.txt", Size: 10, Hash: [32]byte{3}},
+	}}
+	all["log1"] = DirPrint{Path: "log1", Files: []FilePrint{chunkedPrint(t, "log", content), {Path: "notes.txt", Size: 10, Hash: [32]byte{3}}}}
+	all["log2"] = DirPrint{Path: "log2", Files: []FilePrint{chunkedPrint(t, "log", edited)}}
+	all["log3"] = DirPrint{Path: "log3", Files: []FilePrint{chunkedPrint(t, "other/log", edited), chunkedPrint(t, "log", content)}}
+
+	for k1, dp1 := range all {
+		for k2, dp2 := range all {
+			for _, dist := range []int{-1, 5, DefaultImageDistance} {
+				exp := compareIterators(dp1.Iterator(), dp2.Iterator(), HammingMetric).matchImages(dist).Similarity()
+				got := similarity(dp1.Iterator(), dp2.Iterator(), HammingMetric, dist)
+				if diff := cmp.Diff(exp, got); diff != "" {
+					t.Errorf("similarity(%q, %q) with image distance %d mismatch with Compare (-want +got):\n%s", k1, k2, dist, diff)
+				}
+			}
+		}
+	}
+}
@@ -8,9 +8,11 @@ import (
 )
 
 type DirPrint struct {
-	Path  string // always the basename, or "." for the root dir
-	Files []FilePrint
-	Dirs  []DirPrint
+	Path       string // always the basename, or "." for the root dir
+	Files      []FilePrint
+	Dirs       []DirPrint
+	Incomplete bool // the walk was canceled before this directory was fully processed, so the Files and Dirs only cover part of its contents
+	Partial    bool // some of its contents (or that of its subdirectories) were left out of the walk: ignored as per the ignore rules, or skipped due to an error
 }
 
 func (dp DirPrint) String() string {
@@ -18,7 +20,14 @@ func (dp DirPrint) String() string {
 }
 func (dp DirPrint) string(indent string) string {
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, "%sDirPrint path: %q\n", indent, dp.Path)
+	var flags string
+	if dp.Incomplete {
+		flags += " (incomplete)"
+	}
+	if dp.Partial {
+		flags += " (partial)"
+	}
+	fmt.Fprintf(&buf, "%sDirPrint path: %q%s\n", indent, dp.Path, flags)
 	fmt.Fprintf(&buf, "%s  Files:\n", indent)
 	for _, f := range dp.Files {
 		buf.WriteString(indent + "     " + f.String() + "\n")
@@ -52,6 +61,37 @@ func (dp DirPrint) Iterator() Iterator {
 	return &dpi
 }
 
+// SortedByHash returns a copy of the DirPrint in which the files of it and all its subdirectories are sorted by hash,
+// which iterating over it requires. (DirPrints that are walked have their files sorted by hash already, see SortByHash)
+// Sorting once is worthwhile when iterating over the same DirPrint many times.
+func (dp DirPrint) SortedByHash() DirPrint {
+	if !sortedByHash(dp.Files) {
+		dp.Files = append([]FilePrint(nil), dp.Files...)
+		SortByHash(dp.Files)
+	}
+	if len(dp.Dirs) > 0 {
+		dirs := make([]DirPrint, len(dp.Dirs))
+		for i, d := range dp.Dirs {
+			dirs[i] = d.SortedByHash()
+		}
+		dp.Dirs = dirs
+	}
+	return dp
+}
+
+// SortByHash sorts the files by hash, in place, as iterating over a DirPrint requires.
+func SortByHash(files []FilePrint) {
+	sort.SliceStable(files, func(i, j int) bool {
+		return bytes.Compare(files[i].Hash[:], files[j].Hash[:]) < 0
+	})
+}
+
+func sortedByHash(files []FilePrint) bool {
+	return sort.SliceIsSorted(files, func(i, j int) bool {
+		return bytes.Compare(files[i].Hash[:], files[j].Hash[:]) < 0
+	})
+}
+
 type Iterator interface {
 	Next() bool
 	Value() (FilePrint, bool)
@@ -62,12 +102,14 @@ type FilePrintIterator struct {
 	idx   int
 }
 
+// newFilePrintIterator returns an iterator over the files, ordered by hash.
+// Walked DirPrints have their files sorted by hash already. The files are never modified: if they are not sorted by hash
+// (e.g. DirPrints made by hand), the iterator sorts a copy of them. Thus, iterators are safe to use concurrently on shared DirPrints.
 func newFilePrintIterator(files []FilePrint) Iterator {
-
-	// sort all FilePrints by Hash. Note that this will change sorting of the original array
-	sort.Slice(files, func(i, j int) bool {
-		return bytes.Compare(files[i].Hash[:], files[j].Hash[:]) < 0
-	})
+	if !sortedByHash(files) {
+		files = append([]FilePrint(nil), files...)
+		SortByHash(files)
+	}
 
 	fpi := FilePrintIterator{
 		files: files,
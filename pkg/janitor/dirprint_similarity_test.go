@@ -1,7 +1,10 @@
 package janitor
 
 import (
+	"fmt"
+	"io"
 	"math"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -28,6 +31,7 @@ func TestDirPrintSimilarity(t *testing.T) {
 	exp := Similarity{
 		BytesDiff: 100 + 2*444 + 7777,
 		BytesSame: 122 + 333 + 555,
+		FilesSame: 3,
 		PathSim:   float64(2) / 3,
 	}
 
@@ -154,3 +158,235 @@ func TestSimilaritySimilarity(t *testing.T) {
 	}
 
 }
+
+func TestFilterMatch(t *testing.T) {
+	s := Similarity{BytesSame: 30, BytesDiff: 70, FilesSame: 2, PathSim: 0.5}
+	cases := []struct {
+		f   Filter
+		exp bool
+	}{
+		{Filter{}, true},
+		{Filter{MinContent: 0.3}, true},
+		{Filter{MinContent: 0.31}, false},
+		{Filter{MinBytes: 30}, true},
+		{Filter{MinBytes: 31}, false},
+		{Filter{MinFiles: 2}, true},
+		{Filter{MinFiles: 3}, false},
+		{Filter{MinPath: 0.5}, true},
+		{Filter{MinPath: 0.6}, false},
+		{Filter{MinContent: 0.2, MinBytes: 10, MinFiles: 1, MinPath: 0.6}, false},
+	}
+	for _, c := range cases {
+		if got := c.f.Match(s); got != c.exp {
+			t.Errorf("%+v.Match(%v) = %v, expected %v", c.f, s, got, c.exp)
+		}
+	}
+}
+
+// TestSimilarityDuplicates tests that duplicate files are compared as multisets:
+// copies are paired up such that their path similarity is maximal, regardless of the order in which they are iterated,
+// and the copies that can't be paired up count as different bytes.
+func TestSimilarityDuplicates(t *testing.T) {
+	fp := func(p string, hash [32]byte, size int64) FilePrint {
+		return FilePrint{Path: p, Hash: hash, Size: size}
+	}
+	cases := []struct {
+		name string
+		a, b []FilePrint
+		exp  Similarity
+	}{
+		{
+			name: "three copies vs one",
+			a:    []FilePrint{fp("x/foo", FooHash, 10), fp("y/foo", FooHash, 10), fp("z/foo", FooHash, 10)},
+			b:    []FilePrint{fp("y/foo", FooHash, 10)},
+			exp:  Similarity{BytesSame: 10, BytesDiff: 20, FilesSame: 1, PathSim: 1},
+		},
+		{
+			name: "one vs three copies",
+			a:    []FilePrint{fp("z/foo", FooHash, 10)},
+			b:    []FilePrint{fp("x/foo", FooHash, 10), fp("y/foo", FooHash, 10), fp("z/foo", FooHash, 10)},
+			exp:  Similarity{BytesSame: 10, BytesDiff: 20, FilesSame: 1, PathSim: 1},
+		},
+		{
+			name: "two copies vs two copies",
+			a:    []FilePrint{fp("one", FooHash, 10), fp("two", FooHash, 10)},
+			b:    []FilePrint{fp("two", FooHash, 10), fp("one", FooHash, 10)},
+			exp:  Similarity{BytesSame: 20, FilesSame: 2, PathSim: 1},
+		},
+		{
+			name: "copies amongst other files",
+			a:    []FilePrint{fp("a/bar", BarHash, 3), fp("a/foo", FooHash, 10), fp("b/foo", FooHash, 10), fp("c/foobar", FooBarHash, 5)},
+			b:    []FilePrint{fp("b/foo", FooHash, 10), fp("a/bar", BarHash, 3), fp("b/bar", BarHash, 3)},
+			exp:  Similarity{BytesSame: 13, BytesDiff: 10 + 3 + 5, FilesSame: 2, PathSim: 1},
+		},
+	}
+	for _, c := range cases {
+		// the order in which copies are iterated shouldn't matter
+		for _, reverse := range []bool{false, true} {
+			a := append([]FilePrint(nil), c.a...)
+			b := append([]FilePrint(nil), c.b...)
+			if reverse {
+				for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+					a[i], a[j] = a[j], a[i]
+				}
+				for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+					b[i], b[j] = b[j], b[i]
+				}
+			}
+			got := NewSimilarity(newFilePrintIterator(a), newFilePrintIterator(b))
+			if diff := cmp.Diff(c.exp, got); diff != "" {
+				t.Errorf("%s (reversed: %t): Similarity mismatch (-want +got):\n%s", c.name, reverse, diff)
+			}
+		}
+	}
+}
+
+// TestMatchGroups tests that the pairing of copies maximizes the total path similarity, rather than pairing up each one with its best match in turn
+func TestMatchGroups(t *testing.T) {
+	paths := func(ps ...string) []FilePrint {
+		var fps []FilePrint
+		for _, p := range ps {
+			fps = append(fps, FilePrint{Path: p, Hash: FooHash})
+		}
+		return fps
+	}
+	// "photos/img.jpg" matches "photos/img.jpeg" best, but pairing them would leave "img.jpg" with "photos/img.jpg"
+	a := paths("photos/img.jpg", "img.jpg")
+	b := paths("photos/img.jpeg", "photos/img.jpg")
+	got := matchGroups(a, b, LevenshteinMetric)
+	exp := []groupMatch{
+		{0, 1, 1},
+		{1, 0, LevenshteinMetric("img.jpg", "photos/img.jpeg")},
+	}
+	if diff := cmp.Diff(exp, got, cmp.AllowUnexported(groupMatch{})); diff != "" {
+		t.Errorf("matchGroups() mismatch (-want +got):\n%s", diff)
+	}
+
+	// more rows than columns: the best match of each file in b is found
+	a = paths("x/1", "y/2", "z/3")
+	b = paths("z/3", "x/1")
+	got = matchGroups(a, b, HammingMetric)
+	exp = []groupMatch{{0, 1, 1}, {2, 0, 1}}
+	if diff := cmp.Diff(exp, got, cmp.AllowUnexported(groupMatch{})); diff != "" {
+		t.Errorf("matchGroups() mismatch (-want +got):\n%s", diff)
+	}
+
+	// large groups are matched greedily: identical paths first, the others in order
+	var manyA, manyB []string
+	for i := 0; i < 200; i++ {
+		manyA = append(manyA, fmt.Sprintf("a/%d", i))
+		manyB = append(manyB, fmt.Sprintf("b/%d", i))
+	}
+	manyB[100] = "a/150"
+	got = matchGroups(paths(manyA...), paths(manyB...), HammingMetric)
+	if len(got) != 200 {
+		t.Fatalf("matchGroups() expected 200 matches, got %d", len(got))
+	}
+	if got[150] != (groupMatch{150, 100, 1}) {
+		t.Errorf("matchGroups() expected a/150 to be matched with itself, got %+v", got[150])
+	}
+	if got[0] != (groupMatch{0, 0, HammingMetric("a/0", "b/0")}) {
+		t.Errorf("matchGroups() expected a/0 to be matched with b/0, got %+v", got[0])
+	}
+}
+
+func TestAssign(t *testing.T) {
+	cases := []struct {
+		weights [][]float64
+		exp     []int
+	}{
+		{nil, nil},
+		{[][]float64{{1}}, []int{0}},
+		// greedily taking the best weight (0.9) would give a total of 1.0, rather than 1.6
+		{[][]float64{{0.9, 0.8}, {0.8, 0.1}}, []int{1, 0}},
+		{[][]float64{{0, 1, 0}, {1, 0, 0}}, []int{1, 0}},
+		{[][]float64{{0.2, 0.3, 0.9}}, []int{2}},
+		{[][]float64{{5, 4, 1}, {4, 1, 0}, {2, 0, 0}}, []int{1, 0, 2}},
+	}
+	for _, c := range cases {
+		got := assign(c.weights)
+		if diff := cmp.Diff(c.exp, got); diff != "" {
+			t.Errorf("assign(%v) mismatch (-want +got):\n%s", c.weights, diff)
+		}
+	}
+}
+
+// TestIteratorConcurrent tests that iterating over a DirPrint doesn't modify it, such that it is safe to do concurrently.
+// Run it with -race.
+func TestIteratorConcurrent(t *testing.T) {
+	dp := DataMain2Print
+	if sortedByHash(dp.Files) {
+		t.Fatal("the files of DataMain2Print should not be sorted by hash, for this test to be meaningful")
+	}
+	before := dp.String()
+
+	var wg sync.WaitGroup
+	iterated := make([][]FilePrint, 8)
+	for i := range iterated {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			it := dp.Iterator()
+			for it.Next() {
+				v, _ := it.Value()
+				iterated[i] = append(iterated[i], v)
+			}
+		}(i)
+	}
+	sims := make([]Similarity, 8)
+	for i := range sims {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sims[i] = NewSimilarity(dp.Iterator(), dp.Dirs[0].Iterator())
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		GetPairSims(map[string]DirPrint{".": dp, "x": dp.Dirs[0]}, io.Discard)
+	}()
+	wg.Wait()
+
+	for _, got := range iterated {
+		if diff := cmp.Diff(DataMain2Iterated, got); diff != "" {
+			t.Errorf("DirPrint iteration mismatch (-want +got):\n%s", diff)
+		}
+	}
+	for _, got := range sims {
+		if diff := cmp.Diff(sims[0], got); diff != "" {
+			t.Errorf("Similarity mismatch (-want +got):\n%s", diff)
+		}
+	}
+	if after := dp.String(); after != before {
+		t.Errorf("iterating modified the DirPrint. before:\n%s\nafter:\n%s", before, after)
+	}
+}
+
+func TestSortedByHash(t *testing.T) {
+	before := DataMain2Print.String()
+	sorted := DataMain2Print.SortedByHash()
+	if DataMain2Print.String() != before {
+		t.Errorf("SortedByHash() modified the DirPrint")
+	}
+	var check func(dp DirPrint)
+	check = func(dp DirPrint) {
+		if !sortedByHash(dp.Files) {
+			t.Errorf("SortedByHash() files of %q are not sorted", dp.Path)
+		}
+		for _, d := range dp.Dirs {
+			check(d)
+		}
+	}
+	check(sorted)
+
+	var got []FilePrint
+	it := sorted.Iterator()
+	for it.Next() {
+		v, _ := it.Value()
+		got = append(got, v)
+	}
+	if diff := cmp.Diff(DataMain2Iterated, got); diff != "" {
+		t.Errorf("DirPrint iteration mismatch (-want +got):\n%s", diff)
+	}
+}
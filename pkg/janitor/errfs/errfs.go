@@ -2,7 +2,11 @@
 package errfs
 
 import (
+	"bytes"
 	"io/fs"
+	"path"
+	"sync"
+	"time"
 )
 
 var _ fs.FS = ErrFS{}
@@ -18,34 +22,151 @@ type Errs struct {
 
 	ReadDir      error   // errors for ReadDir() for directories.
 	DirEntryInfo []error // errors for the fs.DirEntry's (which are returned by ReadDir()) Info() methods.
+
+	Delay        time.Duration // every call for the path (Open, and the methods of what it returns) sleeps this long before doing anything else
+	ReadAfter    int64         // number of bytes that can be read before Read fails with the Read error. 0 means it fails right away
+	ShortRead    int           // if > 0, every Read returns at most this many bytes
+	ReadDirAfter int           // number of ReadDir calls that succeed before it fails with the ReadDir error. 0 means it fails right away
+	Contents     [][]byte      // if set, the content of the file for successive opens (the last one for all further opens), instead of the wrapped content. e.g. to simulate a file being modified while it is scanned
+}
+
+// Rule configures the errors of the paths it matches
+type Rule struct {
+	Pattern string                 // path.Match pattern of the paths the rule applies to, e.g. "dir/*.zip". "" matches all paths
+	Match   func(name string) bool // if set, the rule applies to the paths for which it returns true, rather than those matching Pattern
+	Nth     int                    // if > 0, the errors only apply to the Nth call of each method for the path (counting calls across opens), rather than to all calls. Delays, short reads and contents always apply
+	Errs    Errs
+}
+
+// match returns whether the rule applies to the path
+func (r Rule) match(name string) bool {
+	if r.Match != nil {
+		return r.Match(name)
+	}
+	if r.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Pattern, name)
+	return ok
+}
+
+// Methods of the calls, as recorded in Call.Method
+const (
+	MethodOpen    = "Open"
+	MethodStat    = "Stat"
+	MethodRead    = "Read"
+	MethodClose   = "Close"
+	MethodReadDir = "ReadDir"
+	MethodInfo    = "Info" // of a DirEntry. The path is that of the entry
+)
+
+// Call is a call made to the ErrFS, or to any of the things it returned
+type Call struct {
+	Method string
+	Path   string
+	Err    error // the error returned by the call, configured or not
+}
+
+// recorder counts and records the calls made to an ErrFS
+type recorder struct {
+	mu     sync.Mutex
+	counts map[Call]int // by method and path, with a nil Err
+	calls  []Call
+}
+
+// call counts the call of the method for the path, returning the error configured for the rule, or nil if the rule doesn't apply to this call
+func (r *recorder) call(method, name string, rule Rule, err error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := Call{Method: method, Path: name}
+	r.counts[key]++
+	if rule.Nth > 0 && r.counts[key] != rule.Nth {
+		return nil
+	}
+	return err
+}
+
+// count returns the number of calls of the method for the path so far
+func (r *recorder) count(method, name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[Call{Method: method, Path: name}]
+}
+
+func (r *recorder) record(method, name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Path: name, Err: err})
 }
 
 // ErrFS wraps fs.FS and returns ErrFile and ErrDir upon calling the Open method.
 // The caller controls, on a per-path basis, whether the open fails, and which of the fs.File or fs.ReadDirFile methods should fail as well, or
 // any of the DirEntry's returned by ReadDir().
 // In other words, any method of ErrFS, or any of the things it returns (or the things they return), can be configured to fail.
+// Beyond failing, calls can be delayed, reads can be short, and file contents can change between opens.
+// All calls are recorded, see Calls.
+// It is safe for concurrent use, though the files it returns are not (like most files).
 type ErrFS struct {
-	fs  fs.FS
-	err map[string]Errs
+	fs    fs.FS
+	rules []Rule
+	rec   *recorder
 }
 
+// NewErrFS returns an ErrFS that fails as configured for the exact paths in err
 func NewErrFS(f fs.FS, err map[string]Errs) fs.FS {
+	var rules []Rule
+	for name, errs := range err {
+		name := name
+		rules = append(rules, Rule{Match: func(n string) bool { return n == name }, Errs: errs})
+	}
+	return New(f, rules...)
+}
+
+// New returns an ErrFS that fails as configured by the first of the rules that matches a path. Paths that no rule matches behave as in f.
+func New(f fs.FS, rules ...Rule) ErrFS {
 	return ErrFS{
-		fs:  f,
-		err: err,
+		fs:    f,
+		rules: rules,
+		rec:   &recorder{counts: make(map[Call]int)},
+	}
+}
+
+// Calls returns all calls made so far, in order
+func (efs ErrFS) Calls() []Call {
+	efs.rec.mu.Lock()
+	defer efs.rec.mu.Unlock()
+	return append([]Call(nil), efs.rec.calls...)
+}
+
+// rule returns the rule that applies to the path. The zero Rule if none does
+func (efs ErrFS) rule(name string) Rule {
+	for _, r := range efs.rules {
+		if r.match(name) {
+			return r
+		}
 	}
+	return Rule{}
 }
 
 // Open fails as configured, or returns a fs.File (or fs.ReadDirFile) which will fail as configured.
 func (efs ErrFS) Open(name string) (fs.File, error) {
-	errs, ok := efs.err[name]
-	if ok && errs.Open != nil {
-		return nil, errs.Open
+	f, err := efs.open(name)
+	efs.rec.record(MethodOpen, name, err)
+	return f, err
+}
+
+func (efs ErrFS) open(name string) (fs.File, error) {
+	rule := efs.rule(name)
+	errs := rule.Errs
+	time.Sleep(errs.Delay)
+	if err := efs.rec.call(MethodOpen, name, rule, errs.Open); err != nil {
+		return nil, err
 	}
 	f, err := efs.fs.Open(name)
 	if err != nil {
 		return f, err
 	}
+	c := caller{name: name, rule: rule, rec: efs.rec}
 	dir, ok := f.(fs.ReadDirFile)
 	if ok {
 		return ErrDir{
@@ -54,42 +175,136 @@ func (efs ErrFS) Open(name string) (fs.File, error) {
 			errReadDir:      errs.ReadDir,
 			errClose:        errs.Close,
 			errDirEntryInfo: errs.DirEntryInfo,
+			delay:           errs.Delay,
+			readDirAfter:    errs.ReadDirAfter,
+			state:           &state{},
+			caller:          c,
 			f:               dir,
 		}, nil
 	}
+	if len(errs.Contents) > 0 {
+		n := efs.rec.count(MethodOpen, name) - 1
+		if n >= len(errs.Contents) {
+			n = len(errs.Contents) - 1
+		}
+		f = &contentFile{File: f, r: bytes.NewReader(errs.Contents[n])}
+	}
 	return ErrFile{
-		errStat:  errs.Stat,
-		errRead:  errs.Read,
-		errClose: errs.Close,
-		f:        f,
+		errStat:   errs.Stat,
+		errRead:   errs.Read,
+		errClose:  errs.Close,
+		delay:     errs.Delay,
+		readAfter: errs.ReadAfter,
+		shortRead: errs.ShortRead,
+		state:     &state{},
+		caller:    c,
+		f:         f,
 	}, nil
 }
 
+// caller counts and records the calls to an opened file
+type caller struct {
+	name string
+	rule Rule
+	rec  *recorder
+}
+
+// call counts the call of the method, returning the configured error if it applies to this call
+func (c caller) call(method string, err error) error {
+	return c.rec.call(method, c.name, c.rule, err)
+}
+
+// record records the call of the method, with the error it returned
+func (c caller) record(method string, err error) {
+	c.rec.record(method, c.name, err)
+}
+
+// state tracks the calls made to an opened file, for the failures that only happen after a while
+type state struct {
+	read     int64 // number of bytes read
+	readDirs int   // number of successful ReadDir calls
+	entries  int   // number of entries returned by ReadDir
+}
+
 // ErrFile is like fs.File but it will fail any of its methods as configured
 type ErrFile struct {
-	errStat  error
-	errRead  error
-	errClose error
-	f        fs.File
+	errStat   error
+	errRead   error
+	errClose  error
+	delay     time.Duration
+	readAfter int64
+	shortRead int
+	state     *state
+	caller
+	f fs.File
 }
 
 func (f ErrFile) Stat() (fs.FileInfo, error) {
-	if f.errStat != nil {
-		return nil, f.errStat
+	time.Sleep(f.delay)
+	if err := f.call(MethodStat, f.errStat); err != nil {
+		f.record(MethodStat, err)
+		return nil, err
 	}
-	return f.f.Stat()
+	fi, err := f.f.Stat()
+	f.record(MethodStat, err)
+	return fi, err
 }
 func (f ErrFile) Read(b []byte) (int, error) {
-	if f.errRead != nil {
-		return 0, f.errRead
+	time.Sleep(f.delay)
+	if errRead := f.call(MethodRead, f.errRead); errRead != nil {
+		left := f.readAfter - f.state.read
+		if left <= 0 {
+			f.record(MethodRead, errRead)
+			return 0, errRead
+		}
+		if int64(len(b)) > left {
+			b = b[:left]
+		}
+	}
+	if f.shortRead > 0 && len(b) > f.shortRead {
+		b = b[:f.shortRead]
 	}
-	return f.f.Read(b)
+	n, err := f.f.Read(b)
+	f.state.read += int64(n)
+	f.record(MethodRead, err)
+	return n, err
 }
 func (f ErrFile) Close() error {
-	if f.errClose != nil {
-		return f.errClose
+	time.Sleep(f.delay)
+	err := f.call(MethodClose, f.errClose)
+	if err == nil {
+		err = f.f.Close()
 	}
-	return f.f.Close()
+	f.record(MethodClose, err)
+	return err
+}
+
+// contentFile is a file of which the content is replaced
+type contentFile struct {
+	fs.File
+	r *bytes.Reader
+}
+
+func (f *contentFile) Read(b []byte) (int, error) {
+	return f.r.Read(b)
+}
+
+func (f *contentFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return contentInfo{FileInfo: fi, size: f.r.Size()}, nil
+}
+
+// contentInfo is the fs.FileInfo of a contentFile: the size is that of the replaced content
+type contentInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi contentInfo) Size() int64 {
+	return fi.size
 }
 
 // ErrDir is like fs.ReadDirFile but it will fail any of its methods,
@@ -100,40 +315,65 @@ type ErrDir struct {
 	errReadDir      error
 	errClose        error
 	errDirEntryInfo []error
-	f               fs.ReadDirFile
+	delay           time.Duration
+	readDirAfter    int
+	state           *state
+	caller
+	f fs.ReadDirFile
 }
 
 func (f ErrDir) Stat() (fs.FileInfo, error) {
-	if f.errStat != nil {
-		return nil, f.errStat
+	time.Sleep(f.delay)
+	if err := f.call(MethodStat, f.errStat); err != nil {
+		f.record(MethodStat, err)
+		return nil, err
 	}
-	return f.f.Stat()
+	fi, err := f.f.Stat()
+	f.record(MethodStat, err)
+	return fi, err
 }
 func (f ErrDir) Read(b []byte) (int, error) {
-	if f.errRead != nil {
-		return 0, f.errRead
+	time.Sleep(f.delay)
+	if err := f.call(MethodRead, f.errRead); err != nil {
+		f.record(MethodRead, err)
+		return 0, err
 	}
 	// note, calling Read() on a directory always fails AFAIK
-	return f.f.Read(b)
+	n, err := f.f.Read(b)
+	f.record(MethodRead, err)
+	return n, err
 }
 
+// ReadDir returns the entries of the wrapped directory, or fails as configured.
+// The fs.DirEntry's are numbered across calls, for their Info errors.
 func (f ErrDir) ReadDir(n int) ([]fs.DirEntry, error) {
-	if f.errReadDir != nil {
-		return nil, f.errReadDir
+	entries, err := f.readDir(n)
+	f.record(MethodReadDir, err)
+	return entries, err
+}
+
+func (f ErrDir) readDir(n int) ([]fs.DirEntry, error) {
+	time.Sleep(f.delay)
+	if err := f.call(MethodReadDir, f.errReadDir); err != nil && f.state.readDirs >= f.readDirAfter {
+		return nil, err
 	}
 	entries, err := f.f.ReadDir(n)
 	if err != nil {
 		return entries, err
 	}
+	f.state.readDirs++
 	var dirEntries []fs.DirEntry
 	dirEntries = make([]fs.DirEntry, 0, len(entries))
-	for i, entry := range entries {
+	for _, entry := range entries {
 		var errInfo error
-		if i < len(f.errDirEntryInfo) {
+		if i := f.state.entries; i < len(f.errDirEntryInfo) {
 			errInfo = f.errDirEntryInfo[i]
 		}
+		f.state.entries++
 		dirEntries = append(dirEntries, ErrDirEntry{
 			errInfo:  errInfo,
+			delay:    f.delay,
+			caller:   f.caller,
 			DirEntry: entry,
 		})
 	}
@@ -141,21 +381,31 @@ func (f ErrDir) ReadDir(n int) ([]fs.DirEntry, error) {
 }
 
 func (f ErrDir) Close() error {
-	if f.errClose != nil {
-		return f.errClose
+	time.Sleep(f.delay)
+	err := f.call(MethodClose, f.errClose)
+	if err == nil {
+		err = f.f.Close()
 	}
-	return f.f.Close()
+	f.record(MethodClose, err)
+	return err
 }
 
 // ErrDirEntry is like fs.DirEntry but it will fail its Info() method as configured.
 type ErrDirEntry struct {
 	errInfo error
+	delay   time.Duration
+	caller  caller // of the directory
 	fs.DirEntry
 }
 
 func (e ErrDirEntry) Info() (fs.FileInfo, error) {
-	if e.errInfo != nil {
-		return nil, e.errInfo
+	time.Sleep(e.delay)
+	// the calls are counted per directory, as that is what the errors are configured for
+	err := e.caller.call(MethodInfo, e.errInfo)
+	var fi fs.FileInfo
+	if err == nil {
+		fi, err = e.DirEntry.Info()
 	}
-	return e.DirEntry.Info()
+	e.caller.rec.record(MethodInfo, path.Join(e.caller.name, e.Name()), err)
+	return fi, err
 }
@@ -0,0 +1,208 @@
+package errfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var errTest = errors.New("test error")
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"file":    {Data: []byte("foobar")},
+		"dir/a":   {Data: []byte("a")},
+		"dir/b":   {Data: []byte("b")},
+		"dir/c":   {Data: []byte("c")},
+		"dir/sub": {Mode: fs.ModeDir},
+	}
+}
+
+// TestReadAfter tests that reads fail after the configured number of bytes, and that reads can be short
+func TestReadAfter(t *testing.T) {
+	efs := NewErrFS(testFS(), map[string]Errs{
+		"file": {Read: errTest, ReadAfter: 4, ShortRead: 3},
+	})
+	f, err := efs.Open("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 10)
+	var got []int
+	for {
+		n, err := f.Read(b)
+		if err != nil {
+			if !errors.Is(err, errTest) {
+				t.Errorf("expected the read to fail with %v, got %v", errTest, err)
+			}
+			break
+		}
+		got = append(got, n)
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("expected reads of 3 and 1 bytes before failing, got %v", got)
+	}
+
+	// without a Read error, ReadAfter doesn't apply
+	efs = NewErrFS(testFS(), map[string]Errs{
+		"file": {ReadAfter: 2, ShortRead: 4},
+	})
+	b, err = fs.ReadFile(efs, "file")
+	if err != nil || string(b) != "foobar" {
+		t.Errorf("ReadFile() = %q, %v, want %q", b, err, "foobar")
+	}
+}
+
+// TestReadDirAfter tests that paging through a directory fails at the configured page, and that the Info errors are numbered across pages
+func TestReadDirAfter(t *testing.T) {
+	efs := NewErrFS(testFS(), map[string]Errs{
+		"dir": {ReadDir: errTest, ReadDirAfter: 2, DirEntryInfo: []error{nil, nil, errTest}},
+	})
+	f, err := efs.Open("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dir := f.(fs.ReadDirFile)
+	for page := 0; page < 2; page++ {
+		entries, err := dir.ReadDir(2)
+		if err != nil || len(entries) != 2 {
+			t.Fatalf("page %d: expected 2 entries, got %v, %v", page, entries, err)
+		}
+		_, err = entries[0].Info()
+		if exp := page == 1; errors.Is(err, errTest) != exp {
+			t.Errorf("page %d: expected an Info error: %t, got %v", page, exp, err)
+		}
+	}
+	if _, err := dir.ReadDir(2); !errors.Is(err, errTest) {
+		t.Errorf("expected the third page to fail with %v, got %v", errTest, err)
+	}
+}
+
+// TestContents tests that the content of a file changes between opens, and its size along with it
+func TestContents(t *testing.T) {
+	efs := NewErrFS(testFS(), map[string]Errs{
+		"file": {Contents: [][]byte{[]byte("foo"), []byte("modified")}},
+	})
+	for _, exp := range []string{"foo", "modified", "modified"} {
+		f, err := efs.Open("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(f)
+		if err != nil || string(b) != exp {
+			t.Errorf("read %q, %v, want %q", b, err, exp)
+		}
+		fi, err := f.Stat()
+		if err != nil || fi.Size() != int64(len(exp)) {
+			t.Errorf("expected size %d, got %v, %v", len(exp), fi, err)
+		}
+		f.Close()
+	}
+	b, err := fs.ReadFile(efs, "dir/a")
+	if err != nil || string(b) != "a" {
+		t.Errorf("the content of other files changed: %q, %v", b, err)
+	}
+}
+
+// TestDelay tests that calls are delayed
+func TestDelay(t *testing.T) {
+	delay := 5 * time.Millisecond
+	efs := NewErrFS(testFS(), map[string]Errs{
+		"file": {Delay: delay},
+	})
+	start := time.Now()
+	// Open, Stat, Read (twice, the last one returning EOF) and Close
+	_, err := fs.ReadFile(efs, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(start); took < 5*delay {
+		t.Errorf("expected ReadFile() to take at least %s, took %s", 5*delay, took)
+	}
+}
+
+// TestRules tests that the first matching rule applies, by pattern or predicate
+func TestRules(t *testing.T) {
+	efs := New(testFS(),
+		Rule{Pattern: "dir/a", Errs: Errs{}},
+		Rule{Pattern: "dir/*", Errs: Errs{Open: errTest}},
+		Rule{Match: func(name string) bool { return name == "file" }, Errs: Errs{Read: errTest}},
+	)
+	cases := []struct {
+		path string
+		err  bool
+	}{
+		{"dir/a", false},
+		{"dir/b", true},
+		{"dir/sub", true},
+		{"file", true},
+		{"dir", false},
+	}
+	for _, c := range cases {
+		_, err := fs.ReadFile(efs, c.path)
+		if c.path == "dir" || c.path == "dir/sub" {
+			_, err = fs.ReadDir(efs, c.path)
+		}
+		if errors.Is(err, errTest) != c.err {
+			t.Errorf("%s: expected an error: %t, got %v", c.path, c.err, err)
+		}
+	}
+}
+
+// TestNth tests that a rule with Nth only fails the Nth call of each method for the path
+func TestNth(t *testing.T) {
+	efs := New(testFS(), Rule{Pattern: "dir/?", Nth: 2, Errs: Errs{Open: errTest}})
+	for i, exp := range []bool{false, true, false} {
+		_, err := fs.ReadFile(efs, "dir/a")
+		if errors.Is(err, errTest) != exp {
+			t.Errorf("open %d: expected an error: %t, got %v", i+1, exp, err)
+		}
+	}
+	// the calls are counted per path
+	if _, err := fs.ReadFile(efs, "dir/b"); err != nil {
+		t.Errorf("unexpected error for the first open of another path: %v", err)
+	}
+}
+
+// TestCalls tests that all calls are recorded, including those to the files and directory entries that were returned
+func TestCalls(t *testing.T) {
+	efs := New(testFS(), Rule{Pattern: "dir", Errs: Errs{DirEntryInfo: []error{nil, errTest}}})
+	f, err := efs.Open("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(f)
+	f.Close()
+	entries, err := fs.ReadDir(efs, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries[1].Info()
+	efs.Open("nonexistent")
+
+	exp := []Call{
+		{MethodOpen, "file", nil},
+		{MethodRead, "file", nil},
+		{MethodRead, "file", io.EOF},
+		{MethodClose, "file", nil},
+		{MethodOpen, "dir", nil},
+		{MethodReadDir, "dir", nil},
+		{MethodClose, "dir", nil},
+		{MethodInfo, "dir/b", errTest},
+		{MethodOpen, "nonexistent", fs.ErrNotExist},
+	}
+	got := efs.Calls()
+	if len(got) != len(exp) {
+		t.Fatalf("expected %d calls, got %+v", len(exp), got)
+	}
+	for i := range exp {
+		if got[i].Method != exp[i].Method || got[i].Path != exp[i].Path || !errors.Is(got[i].Err, exp[i].Err) || (got[i].Err == nil) != (exp[i].Err == nil) {
+			t.Errorf("call %d: expected %+v, got %+v", i, exp[i], got[i])
+		}
+	}
+}
@@ -12,6 +12,18 @@ type FilePrint struct {
 	Path string // for a fingerprinted file, this is the basename. for an iterated file, this is the path including its parents
 	Size int64
 	Hash [32]byte
+
+	Chunks    []Chunk   // the chunks of the content, for files that have more than one. Only set by a chunked FingerPrinter, see ChunkedFingerPrinter
+	ImageHash *uint64   // the perceptual hash, for images. Only set by ImageFingerPrint
+	RawHash   *[32]byte // the hash of the content as is, for text files for which Hash is of the normalized content. Only set by TextFingerPrint
+}
+
+// rawHash returns the hash of the content as is
+func (fp FilePrint) rawHash() [32]byte {
+	if fp.RawHash != nil {
+		return *fp.RawHash
+	}
+	return fp.Hash
 }
 
 func (fp FilePrint) String() string {
@@ -20,6 +32,14 @@ func (fp FilePrint) String() string {
 
 type FingerPrinter func(path string, r io.Reader) (FilePrint, error)
 
+// FingerPrinters are the available fingerprint algorithms, by name
+var FingerPrinters = map[string]FingerPrinter{
+	"sha256":         Sha256FingerPrint,
+	"sha256-chunked": ChunkedFingerPrinter(DefaultChunker),
+	"sha256-image":   ImageFingerPrint,
+	"sha256-text":    TextFingerPrint,
+}
+
 // Sha256FingerPrint computes the sha256 based fingerprint for the given file content
 func Sha256FingerPrint(base string, r io.Reader) (FilePrint, error) {
 	pr := FilePrint{Path: base}
@@ -0,0 +1,79 @@
+package janitor
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// HashIndex maps content hashes to the paths of all files having that content.
+// paths are relative to the DirPrint the index was built from.
+type HashIndex map[[32]byte][]string
+
+// NewHashIndex indexes all files contained (recursively) within dp.
+func NewHashIndex(dp DirPrint) HashIndex {
+	idx := make(HashIndex)
+	it := dp.Iterator()
+	for it.Next() {
+		v, _ := it.Value()
+		idx[v.Hash] = append(idx[v.Hash], v.Path)
+	}
+	// iteration order within a hash depends on the order of the directories. sort for predictable output.
+	for _, paths := range idx {
+		sort.Strings(paths)
+	}
+	return idx
+}
+
+// Has returns whether content with the given hash is present in the index
+func (idx HashIndex) Has(hash [32]byte) bool {
+	_, ok := idx[hash]
+	return ok
+}
+
+// Remove removes the file at path p, or the files within the directory at p, from the index. e.g. after trashing it.
+func (idx HashIndex) Remove(p string) {
+	idx.Move(p, "")
+}
+
+// Move changes the paths of the file at path from, or of the files within the directory at from, to be at path to instead.
+// If to is "", they are removed from the index.
+func (idx HashIndex) Move(from, to string) {
+	for hash, paths := range idx {
+		kept := paths[:0]
+		changed := false
+		for _, p := range paths {
+			if p != from && !Child(from, p) {
+				kept = append(kept, p)
+				continue
+			}
+			changed = true
+			if to == "" {
+				continue
+			}
+			rel, _ := filepath.Rel(from, p)
+			kept = append(kept, filepath.Join(to, rel))
+		}
+		switch {
+		case len(kept) == 0:
+			delete(idx, hash)
+		case changed:
+			sort.Strings(kept)
+			idx[hash] = kept
+		}
+	}
+}
+
+// Flatten returns all DirPrints within the tree rooted at dp, keyed by their path relative to dp ("." for dp itself).
+// This is the same structure as returned by walking, which allows to reconstruct it from just the root DirPrint.
+func Flatten(dp DirPrint) map[string]DirPrint {
+	all := make(map[string]DirPrint)
+	flatten(dp, ".", all)
+	return all
+}
+
+func flatten(dp DirPrint, p string, all map[string]DirPrint) {
+	all[p] = dp
+	for _, d := range dp.Dirs {
+		flatten(d, filepath.Join(p, d.Path), all)
+	}
+}
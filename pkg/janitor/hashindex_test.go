@@ -0,0 +1,24 @@
+package janitor
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHashIndexMove(t *testing.T) {
+	// in DataMainPrint, somefile (foo) exists in ., bar and foo.
+	idx := NewHashIndex(DataMainPrint)
+	idx.Move("bar", "baz/bar")
+	if diff := cmp.Diff([]string{"baz/bar/somefile", "foo/somefile", "somefile"}, idx[FooHash]); diff != "" {
+		t.Errorf("Move() mismatch (-want +got):\n%s", diff)
+	}
+	idx.Remove("foo")
+	if diff := cmp.Diff([]string{"baz/bar/somefile", "somefile"}, idx[FooHash]); diff != "" {
+		t.Errorf("Remove() mismatch (-want +got):\n%s", diff)
+	}
+	idx.Remove(".")
+	if len(idx) != 0 {
+		t.Errorf("expected an empty index after removing everything, got %v", idx)
+	}
+}
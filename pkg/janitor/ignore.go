@@ -0,0 +1,154 @@
+package janitor
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// IgnoreFile is the name of per-directory ignore files. Their rules apply to the directory they're in, and everything below it.
+const IgnoreFile = ".janitorignore"
+
+// DefaultIgnores are the patterns that are ignored unless re-included (e.g. with "!__MACOSX/")
+var DefaultIgnores = []string{"__MACOSX/"}
+
+// CommonSkipDirs are directories that are typically not worth scanning: their content is generated or downloaded, and can be recreated.
+var CommonSkipDirs = []string{"node_modules/", ".git/", ".cache/"}
+
+type ignoreRule struct {
+	base     string // directory (relative to the root of the walk) that the rule applies within. "." for the root
+	pattern  string
+	negate   bool // the pattern re-includes what was ignored by earlier rules
+	dirOnly  bool // the pattern only matches directories
+	anchored bool // the pattern matches the path relative to base, rather than the name at any depth
+}
+
+// Ignore decides which files and directories to leave out of a walk, based on gitignore-style patterns and size limits.
+// Patterns support the following gitignore syntax:
+// - blank lines and lines starting with # are ignored
+// - a leading "!" negates the pattern: it re-includes a file that an earlier pattern ignored (but not if its parent directory was ignored)
+// - a trailing "/" only matches directories
+// - a pattern containing a "/" (other than at the end) is relative to the base directory, otherwise it matches a name at any depth
+// - "*", "?" and "[...]" match as per path.Match, "**" matches any number of directories
+// When multiple patterns match, the last one wins.
+type Ignore struct {
+	MinSize int64 // files smaller than this are ignored
+	MaxSize int64 // files larger than this are ignored. 0 means no limit
+	rules   []ignoreRule
+}
+
+// NewIgnore returns an Ignore with the DefaultIgnores
+func NewIgnore() *Ignore {
+	ig := &Ignore{}
+	ig.Add(".", DefaultIgnores...)
+	return ig
+}
+
+// Add adds the patterns, which apply within the base directory (relative to the root of the walk, "." for the root)
+func (ig *Ignore) Add(base string, patterns ...string) {
+	for _, p := range patterns {
+		p = strings.TrimRight(p, " \t\r")
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		r := ignoreRule{base: base}
+		if strings.HasPrefix(p, "!") {
+			r.negate = true
+			p = p[1:]
+		} else if strings.HasPrefix(p, `\`) {
+			// escaped leading ! or #
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			r.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			r.anchored = true
+			p = strings.TrimPrefix(p, "/")
+		}
+		if p == "" {
+			continue
+		}
+		r.pattern = p
+		ig.rules = append(ig.rules, r)
+	}
+}
+
+// AddFrom adds the patterns read from r (one per line, e.g. from an ignore file), which apply within the base directory
+func (ig *Ignore) AddFrom(r io.Reader, base string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		ig.Add(base, scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Clone returns a copy that can be added to without affecting the original.
+// Cloning a nil Ignore returns a new one with the DefaultIgnores.
+func (ig *Ignore) Clone() *Ignore {
+	if ig == nil {
+		return NewIgnore()
+	}
+	c := *ig
+	c.rules = append([]ignoreRule(nil), ig.rules...)
+	return &c
+}
+
+// Ignored returns whether the file or directory at path p (relative to the root of the walk) should be ignored.
+// size is only taken into account for files.
+func (ig *Ignore) Ignored(p string, isDir bool, size int64) bool {
+	if !isDir && (size < ig.MinSize || ig.MaxSize > 0 && size > ig.MaxSize) {
+		return true
+	}
+	ignored := false
+	for _, r := range ig.rules {
+		if r.negate == !ignored {
+			// can't change the outcome
+			continue
+		}
+		if r.match(p, isDir) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) match(p string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel := p
+	if r.base != "." {
+		if !strings.HasPrefix(p, r.base+"/") {
+			return false
+		}
+		rel = p[len(r.base)+1:]
+	}
+	if !r.anchored {
+		ok, _ := path.Match(r.pattern, path.Base(rel))
+		return ok
+	}
+	return matchSegments(strings.Split(r.pattern, "/"), strings.Split(rel, "/"))
+}
+
+// matchSegments matches the path segments against the pattern segments, where "**" matches any number of segments
+func matchSegments(pattern, segs []string) bool {
+	if len(pattern) == 0 {
+		return len(segs) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segs); i++ {
+			if matchSegments(pattern[1:], segs[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segs) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], segs[0])
+	return ok && matchSegments(pattern[1:], segs[1:])
+}
@@ -0,0 +1,64 @@
+package janitor
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIgnored(t *testing.T) {
+	ig := NewIgnore()
+	ig.Add(".", "*.log", "!keep.log", "build/", "/top.txt", "docs/**/*.tmp", "# a comment", "")
+	err := ig.AddFrom(strings.NewReader("secret\n!debug.log\n/local/\n"), "sub")
+	if err != nil {
+		t.Fatalf("AddFrom() unexpected error %v", err)
+	}
+	ig.MinSize = 2
+	ig.MaxSize = 100
+
+	cases := []struct {
+		p     string
+		isDir bool
+		size  int64
+		exp   bool
+	}{
+		{"foo.txt", false, 10, false},
+		{"foo.log", false, 10, true},
+		{"a/b/foo.log", false, 10, true},
+		{"a/keep.log", false, 10, false},
+		{"__MACOSX", true, 0, true},
+		{"a/__MACOSX", true, 0, true},
+		{"build", true, 0, true},
+		{"a/build", true, 0, true},
+		{"build", false, 10, false}, // a file named build
+		{"top.txt", false, 10, true},
+		{"a/top.txt", false, 10, false},
+		{"docs/x.tmp", false, 10, true},
+		{"docs/a/b/x.tmp", false, 10, true},
+		{"x.tmp", false, 10, false},
+		{"secret", false, 10, false}, // the rule only applies within sub
+		{"sub/secret", false, 10, true},
+		{"sub/a/secret", true, 0, true},
+		{"sub/debug.log", false, 10, false},
+		{"debug.log", false, 10, true},
+		{"sub/local", true, 0, true},
+		{"sub/a/local", true, 0, false},
+		{"small.txt", false, 1, true},
+		{"big.txt", false, 101, true},
+		{"dir", true, 0, false}, // size limits don't apply to directories
+	}
+	for _, c := range cases {
+		if got := ig.Ignored(c.p, c.isDir, c.size); got != c.exp {
+			t.Errorf("Ignored(%q, %t, %d) = %t, expected %t", c.p, c.isDir, c.size, got, c.exp)
+		}
+	}
+
+	// re-including the default
+	ig.Add(".", "!__MACOSX/")
+	if ig.Ignored("__MACOSX", true, 0) {
+		t.Errorf("Ignored(__MACOSX) expected to be re-included")
+	}
+	var nilIgnore *Ignore
+	if !nilIgnore.Clone().Ignored("__MACOSX", true, 0) {
+		t.Errorf("Clone() of nil Ignore expected to have the default ignores")
+	}
+}
@@ -0,0 +1,254 @@
+package janitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	_ "image/gif" // register the decoders that ImageFingerPrint supports
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+// DefaultImageDistance is the maximum Hamming distance between the ImageHashes of two images for them to look the same.
+// Resizing and re-encoding typically changes a few bits; different pictures differ in about half of the 64.
+const DefaultImageDistance = 10
+
+// maxImagePixels is the largest number of pixels of the images that ImageFingerPrint decodes. A small file can declare huge dimensions,
+// and decoding allocates memory for all of its pixels up front.
+const maxImagePixels = 100 << 20
+
+// ImageFingerPrint computes the sha256 based fingerprint for the given file content, like Sha256FingerPrint,
+// and if the content is a jpeg, png or gif image, also its perceptual hash. (see DHash)
+// Content that can't be decoded as an image, and images of more than maxImagePixels pixels, are fingerprinted as regular files.
+func ImageFingerPrint(base string, r io.Reader) (FilePrint, error) {
+	pr := FilePrint{Path: base}
+
+	h := sha256.New()
+	er := &errReader{r: r}
+	tr := io.TeeReader(er, h)
+	// check the dimensions before decoding. the header that was read to do so is decoded again, along with the rest
+	var head bytes.Buffer
+	var img image.Image
+	cfg, _, decodeErr := image.DecodeConfig(io.TeeReader(tr, &head))
+	if decodeErr == nil && int64(cfg.Width)*int64(cfg.Height) <= maxImagePixels {
+		img, _, decodeErr = image.Decode(io.MultiReader(&head, tr))
+	}
+	// the decoder may not have read everything, e.g. trailing data after the image
+	_, err := io.Copy(h, er)
+	if err == nil {
+		err = er.err
+	}
+	if err != nil {
+		return pr, err
+	}
+	pr.Size = er.n
+	copy(pr.Hash[:], h.Sum(nil))
+
+	if decodeErr == nil && img != nil {
+		d := DHash(img)
+		pr.ImageHash = &d
+	}
+	return pr, nil
+}
+
+// errReader counts the bytes read and remembers the first error other than io.EOF,
+// so that read errors can be told apart from content that is not an image.
+type errReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (er *errReader) Read(p []byte) (int, error) {
+	if er.err != nil {
+		return 0, er.err
+	}
+	n, err := er.r.Read(p)
+	er.n += int64(n)
+	if err != nil && err != io.EOF {
+		er.err = err
+	}
+	return n, err
+}
+
+// dhashSamples is the largest number of pixels per row and column that DHash samples
+const dhashSamples = 512
+
+// DHash computes the difference hash of the image: the image is scaled down to 9x8 gray pixels,
+// and each bit tells whether a pixel is brighter than its right neighbour.
+// It is insensitive to scaling, compression artifacts and small color adjustments.
+// Of large images, only every so many pixels are sampled (at most dhashSamples per row and column): that is plenty to tell the 9x8 cells apart.
+func DHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	var sums [h][w]float64
+	var counts [h][w]int
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+	lum := lumaFunc(img)
+	stepX := (b.Dx() + dhashSamples - 1) / dhashSamples
+	stepY := (b.Dy() + dhashSamples - 1) / dhashSamples
+	for y := b.Min.Y; y < b.Max.Y; y += stepY {
+		cy := (y - b.Min.Y) * h / b.Dy()
+		for x := b.Min.X; x < b.Max.X; x += stepX {
+			cx := (x - b.Min.X) * w / b.Dx()
+			sums[cy][cx] += lum(x, y)
+			counts[cy][cx]++
+		}
+	}
+	var gray [h][w]float64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if counts[y][x] > 0 {
+				gray[y][x] = sums[y][x] / float64(counts[y][x])
+			} else if x > 0 {
+				// images narrower than 9 pixels (or lower than 8) leave cells empty: repeat their neighbour
+				gray[y][x] = gray[y][x-1]
+			} else if y > 0 {
+				gray[y][x] = gray[y-1][x]
+			}
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// lumaFunc returns a function that returns the luma of a pixel of the image, as per ITU-R BT.601.
+// At returns an interface, which allocates a color for every pixel, so the image types that the decoders return
+// are read through their methods that return concrete colors.
+func lumaFunc(img image.Image) func(x, y int) float64 {
+	luma := func(r, g, b, _ uint32) float64 {
+		return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+	}
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return func(x, y int) float64 { return luma(img.YCbCrAt(x, y).RGBA()) }
+	case *image.Gray:
+		return func(x, y int) float64 { return luma(img.GrayAt(x, y).RGBA()) }
+	case *image.RGBA:
+		return func(x, y int) float64 { return luma(img.RGBAAt(x, y).RGBA()) }
+	case *image.NRGBA:
+		return func(x, y int) float64 { return luma(img.NRGBAAt(x, y).RGBA()) }
+	case *image.Paletted:
+		// compute the luma of each color once
+		lums := make([]float64, len(img.Palette))
+		for i, c := range img.Palette {
+			lums[i] = luma(c.RGBA())
+		}
+		return func(x, y int) float64 {
+			if i := int(img.ColorIndexAt(x, y)); i < len(lums) {
+				return lums[i]
+			}
+			return 0
+		}
+	}
+	return func(x, y int) float64 { return luma(img.At(x, y).RGBA()) }
+}
+
+// ImageDistance returns the number of bits that differ between the perceptual hashes of two images
+func ImageDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// matchImages pairs up images that don't match, but look the same: whose ImageHashes are at most maxDistance apart.
+// They are moved from OnlyA, OnlyB and Changed to Similar. The closest images are paired up first.
+// A negative maxDistance leaves the comparison as is.
+func (c Comparison) matchImages(maxDistance int) Comparison {
+	if maxDistance < 0 {
+		return c
+	}
+	// the candidate files of either side: OnlyA (OnlyB) followed by the A (B) side of Changed
+	var as, bs []FilePrint
+	as = append(as, c.OnlyA...)
+	bs = append(bs, c.OnlyB...)
+	for _, ch := range c.Changed {
+		as = append(as, ch.A)
+		bs = append(bs, ch.B)
+	}
+
+	type candidate struct {
+		a, b int
+		dist int
+	}
+	var candidates []candidate
+	for i, fa := range as {
+		if fa.ImageHash == nil {
+			continue
+		}
+		for j, fb := range bs {
+			if fb.ImageHash == nil {
+				continue
+			}
+			if d := ImageDistance(*fa.ImageHash, *fb.ImageHash); d <= maxDistance {
+				candidates = append(candidates, candidate{i, j, d})
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return c
+	}
+	// ties are broken by path, such that the outcome does not depend on the order of the candidates
+	sort.Slice(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		if ci.dist != cj.dist {
+			return ci.dist < cj.dist
+		}
+		if as[ci.a].Path != as[cj.a].Path {
+			return as[ci.a].Path < as[cj.a].Path
+		}
+		return bs[ci.b].Path < bs[cj.b].Path
+	})
+
+	usedA := make([]bool, len(as))
+	usedB := make([]bool, len(bs))
+	var similar []SimilarImage
+	for _, cand := range candidates {
+		if usedA[cand.a] || usedB[cand.b] {
+			continue
+		}
+		usedA[cand.a], usedB[cand.b] = true, true
+		similar = append(similar, SimilarImage{A: as[cand.a], B: bs[cand.b], Distance: cand.dist})
+	}
+
+	out := Comparison{Matched: c.Matched, Similar: similar}
+	for i, f := range c.OnlyA {
+		if !usedA[i] {
+			out.OnlyA = append(out.OnlyA, f)
+		}
+	}
+	for i, f := range c.OnlyB {
+		if !usedB[i] {
+			out.OnlyB = append(out.OnlyB, f)
+		}
+	}
+	for i, ch := range c.Changed {
+		ia, ib := len(c.OnlyA)+i, len(c.OnlyB)+i
+		switch {
+		case !usedA[ia] && !usedB[ib]:
+			out.Changed = append(out.Changed, ch)
+		case !usedA[ia]:
+			// its counterpart looks like another file
+			out.OnlyA = append(out.OnlyA, ch.A)
+		case !usedB[ib]:
+			out.OnlyB = append(out.OnlyB, ch.B)
+		}
+	}
+	sortByPath(out.OnlyA)
+	sortByPath(out.OnlyB)
+	sort.Slice(out.Similar, func(i, j int) bool {
+		return out.Similar[i].A.Path < out.Similar[j].A.Path
+	})
+	return out
+}
@@ -0,0 +1,258 @@
+package janitor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testPicture returns an image with some large scale structure, like a photo: a gradient with a few blobs
+func testPicture(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			fx, fy := float64(x)/float64(w), float64(y)/float64(h)
+			v := 255 * fx * (1 - fy)
+			if (fx-0.3)*(fx-0.3)+(fy-0.4)*(fy-0.4) < 0.03 {
+				v = 255 - v
+			}
+			if fx > 0.6 && fy > 0.6 {
+				v /= 3
+			}
+			img.Set(x, y, color.RGBA{uint8(v), uint8(v / 2), uint8(255 - v), 255})
+		}
+	}
+	return img
+}
+
+// scale resizes the image with nearest neighbour sampling
+func scale(src image.Image, w, h int) image.Image {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func imagePrint(t *testing.T, path string, content []byte) FilePrint {
+	t.Helper()
+	fp, err := ImageFingerPrint(path, bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func TestImageFingerPrint(t *testing.T) {
+	content := encodePNG(t, testPicture(64, 48))
+	// trailing data is part of the file, but not of the image
+	content = append(content, "trailer"...)
+	got := imagePrint(t, "pic.png", content)
+
+	exp, err := Sha256FingerPrint("pic.png", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ImageHash == nil {
+		t.Fatalf("ImageFingerPrint() did not compute a perceptual hash for a png")
+	}
+	got.ImageHash = nil
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("ImageFingerPrint() mismatch (-want +got):\n%s", diff)
+	}
+
+	got = imagePrint(t, "foo", []byte("foo"))
+	if diff := cmp.Diff(FilePrint{Path: "foo", Size: 3, Hash: FooHash}, got); diff != "" {
+		t.Errorf("ImageFingerPrint() mismatch for a file that is not an image (-want +got):\n%s", diff)
+	}
+
+	_, err = ImageFingerPrint("broken", &failingReader{content: content[:100]})
+	if err == nil {
+		t.Errorf("ImageFingerPrint() did not return the read error")
+	}
+}
+
+// failingReader returns its content, followed by an error
+type failingReader struct {
+	content []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.content) == 0 {
+		return 0, errRead
+	}
+	n := copy(p, r.content)
+	r.content = r.content[n:]
+	return n, nil
+}
+
+var errRead = errors.New("read error")
+
+func TestDHash(t *testing.T) {
+	pic := testPicture(640, 480)
+	orig := *imagePrint(t, "orig.png", encodePNG(t, pic)).ImageHash
+
+	copies := map[string][]byte{
+		"jpeg":        encodeJPEG(t, pic, 90),
+		"low quality": encodeJPEG(t, pic, 20),
+		"resized":     encodePNG(t, scale(pic, 160, 120)),
+		"thumbnail":   encodeJPEG(t, scale(pic, 64, 48), 50),
+	}
+	for name, content := range copies {
+		fp := imagePrint(t, name, content)
+		if fp.ImageHash == nil {
+			t.Fatalf("%s: no perceptual hash", name)
+		}
+		if d := ImageDistance(orig, *fp.ImageHash); d > DefaultImageDistance {
+			t.Errorf("%s: distance to the original is %d, want at most %d", name, d, DefaultImageDistance)
+		}
+	}
+
+	noise := image.NewGray(image.Rect(0, 0, 640, 480))
+	rand.New(rand.NewSource(1)).Read(noise.Pix)
+	if d := ImageDistance(orig, DHash(noise)); d <= DefaultImageDistance {
+		t.Errorf("distance of an unrelated image to the original is %d, want more than %d", d, DefaultImageDistance)
+	}
+
+	// images smaller than the hash
+	DHash(image.NewGray(image.Rect(0, 0, 3, 2)))
+	DHash(image.NewGray(image.Rect(0, 0, 0, 0)))
+}
+
+// opaqueImage hides the type of the image, so DHash reads it through At
+type opaqueImage struct {
+	image.Image
+}
+
+// TestDHashTypes tests that reading the pixels of the image types that the decoders return directly gives the same hash as At
+func TestDHashTypes(t *testing.T) {
+	pic := testPicture(64, 48)
+	b := pic.Bounds()
+	gray := image.NewGray(b)
+	nrgba := image.NewNRGBA(b)
+	paletted := image.NewPaletted(b, palette.Plan9)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gray.Set(x, y, pic.At(x, y))
+			nrgba.Set(x, y, pic.At(x, y))
+			paletted.Set(x, y, pic.At(x, y))
+		}
+	}
+	ycbcr, err := jpeg.Decode(bytes.NewReader(encodeJPEG(t, pic, 90)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgs := map[string]image.Image{
+		"rgba":     pic,
+		"gray":     gray,
+		"nrgba":    nrgba,
+		"paletted": paletted,
+		"ycbcr":    ycbcr,
+	}
+	for name, img := range imgs {
+		if got, exp := DHash(img), DHash(opaqueImage{img}); got != exp {
+			t.Errorf("%s: DHash() = %x, want %x", name, got, exp)
+		}
+	}
+}
+
+// TestImageFingerPrintHuge tests that an image that declares huge dimensions is fingerprinted as a regular file, without decoding it
+func TestImageFingerPrintHuge(t *testing.T) {
+	content := encodePNG(t, testPicture(4, 4))
+	// the IHDR chunk follows the 8 byte signature, its length and type. it starts with the width and height
+	binary.BigEndian.PutUint32(content[16:], 100000)
+	binary.BigEndian.PutUint32(content[20:], 100000)
+	binary.BigEndian.PutUint32(content[29:], crc32.ChecksumIEEE(content[12:29]))
+	if cfg, err := png.DecodeConfig(bytes.NewReader(content)); err != nil || cfg.Width != 100000 {
+		t.Fatalf("expected a png of 100000 pixels wide, got %+v, %v", cfg, err)
+	}
+
+	got := imagePrint(t, "huge.png", content)
+	exp, err := Sha256FingerPrint("huge.png", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("ImageFingerPrint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCompareSimilarImages(t *testing.T) {
+	h := func(v uint64) *uint64 { return &v }
+	a := DirPrint{Path: "a", Files: []FilePrint{
+		{Path: "IMG_1.jpg", Size: 1000, Hash: FooHash, ImageHash: h(0xff00)},
+		{Path: "IMG_2.jpg", Size: 1000, Hash: BarHash, ImageHash: h(0x00ff)},
+		{Path: "notes.txt", Size: 10, Hash: [32]byte{3}},
+	}}
+	b := DirPrint{Path: "b", Files: []FilePrint{
+		{Path: "small/IMG_1.jpg", Size: 100, Hash: [32]byte{1}, ImageHash: h(0xff01)}, // 1 bit away from IMG_1
+		{Path: "IMG_2.jpg", Size: 200, Hash: [32]byte{2}, ImageHash: h(0xf0f0)},       // 8 bits away from both
+		{Path: "notes.txt", Size: 10, Hash: [32]byte{3}},
+	}}
+
+	c := Compare(a, b)
+	exp := []SimilarImage{
+		{A: a.Files[0], B: b.Files[0], Distance: 1},
+		{A: a.Files[1], B: b.Files[1], Distance: 8},
+	}
+	if diff := cmp.Diff(exp, c.Similar); diff != "" {
+		t.Errorf("Compare() similar images mismatch (-want +got):\n%s", diff)
+	}
+	if len(c.OnlyA) != 0 || len(c.OnlyB) != 0 || len(c.Changed) != 0 {
+		t.Errorf("Compare() left files without a match: %+v", c)
+	}
+	sim := c.Similarity()
+	if sim.BytesSame != 10 || sim.BytesDiff != 2300 || sim.BytesSimilar != 2300 {
+		t.Errorf("Similarity() = %+v, want 10 bytes same, 2300 bytes diff and similar", sim)
+	}
+	if sim.NearContentSimilarity() != 1 {
+		t.Errorf("NearContentSimilarity() = %f, want 1", sim.NearContentSimilarity())
+	}
+
+	// with a lower distance, the IMG_2 files are too far apart, and merely changed
+	five := 5
+	c = CompareOpts(a, b, PairOpts{ImageDistance: &five})
+	if len(c.Similar) != 1 || c.Similar[0].A.Path != "IMG_1.jpg" {
+		t.Errorf("CompareOpts() with distance 5: similar images %+v, want only IMG_1.jpg", c.Similar)
+	}
+	if len(c.Changed) != 1 || c.Changed[0].A.Path != "IMG_2.jpg" {
+		t.Errorf("CompareOpts() with distance 5: changed %+v, want IMG_2.jpg", c.Changed)
+	}
+
+	off := -1
+	c = CompareOpts(a, b, PairOpts{ImageDistance: &off})
+	if len(c.Similar) != 0 {
+		t.Errorf("CompareOpts() with images disabled: got similar images %+v", c.Similar)
+	}
+}
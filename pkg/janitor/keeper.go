@@ -0,0 +1,316 @@
+package janitor
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// KeeperRule expresses a preference between two members of a cluster: negative if a should rather be kept than b,
+// positive for the opposite, 0 for no preference.
+type KeeperRule func(a, b ClusterMember) int
+
+// KeeperRules are the available rules, by name, for Keeper.Rules
+var KeeperRules = map[string]KeeperRule{
+	"oldest":      keepOldest,
+	"newest":      keepNewest,
+	"shortest":    keepShortest,
+	"shallowest":  keepShallowest,
+	"not-archive": keepNotArchive,
+	"archive":     keepArchive,
+	"not-temp":    keepNotTemp,
+}
+
+// keepOldest prefers the member that was modified first, which is likely the original. Members with unknown times come last.
+func keepOldest(a, b ClusterMember) int {
+	switch {
+	case a.ModTime.IsZero() && b.ModTime.IsZero():
+		return 0
+	case a.ModTime.IsZero():
+		return 1
+	case b.ModTime.IsZero():
+		return -1
+	case a.ModTime.Before(b.ModTime):
+		return -1
+	case b.ModTime.Before(a.ModTime):
+		return 1
+	}
+	return 0
+}
+
+// keepNewest prefers the member that was modified last, which is likely the one in use. Members with unknown times come last.
+func keepNewest(a, b ClusterMember) int {
+	if a.ModTime.IsZero() || b.ModTime.IsZero() {
+		return keepOldest(a, b)
+	}
+	return -keepOldest(a, b)
+}
+
+// keepShortest prefers the member with the shortest path, as copies tend to be nested in backup and export directories
+func keepShortest(a, b ClusterMember) int {
+	return len(a.Path) - len(b.Path)
+}
+
+// keepShallowest prefers the member with the fewest directories in its path. Unlike keepShortest, it is not swayed by long names.
+func keepShallowest(a, b ClusterMember) int {
+	return strings.Count(a.Path, "/") - strings.Count(b.Path, "/")
+}
+
+// keepNotArchive prefers members that are not zip files (nor within one): their files can be used as they are.
+func keepNotArchive(a, b ClusterMember) int {
+	return boolPreference(!a.Archive, !b.Archive)
+}
+
+// keepArchive prefers members that are zip files (or within one): they take less space.
+func keepArchive(a, b ClusterMember) int {
+	return boolPreference(a.Archive, b.Archive)
+}
+
+// keepNotTemp prefers members that are not temporary (see Keeper.TempPatterns)
+func keepNotTemp(a, b ClusterMember) int {
+	return boolPreference(!a.Temp, !b.Temp)
+}
+
+// boolPreference prefers a if only a is preferable, b if only b is
+func boolPreference(a, b bool) int {
+	switch {
+	case a && !b:
+		return -1
+	case b && !a:
+		return 1
+	}
+	return 0
+}
+
+// Keeper chooses which member of a cluster to keep
+type Keeper struct {
+	PreferredRoots []string // patterns (see MatchPattern) of the absolute paths of preferred members, e.g. "~/photos/". They take precedence over the rules
+	Rules          []string // names of KeeperRules, by priority
+	TempPatterns   []string // patterns (see MatchPattern) of temporary files and directories, for the not-temp rule. nil means DefaultTempPatterns
+}
+
+// DefaultKeeper keeps copies that are not temporary, then the oldest copy, or the one with the shortest path if that doesn't tell
+var DefaultKeeper = Keeper{Rules: []string{"not-temp", "oldest", "shortest"}}
+
+// DefaultTempPatterns match the directories and files that commonly hold temporary copies
+var DefaultTempPatterns = []string{"tmp", "temp", "Temp", "*.tmp", "cache", ".cache", ".Trash*"}
+
+// temp returns whether the path (relative to root) or any of its parent directories (up to root) matches the temp patterns
+func (k Keeper) temp(root, p string) bool {
+	patterns := k.TempPatterns
+	if patterns == nil {
+		patterns = DefaultTempPatterns
+	}
+	for ; p != "." && p != "/" && p != ""; p = filepath.Dir(p) {
+		abs := filepath.Join(root, p)
+		for _, pattern := range patterns {
+			if MatchPattern(pattern, abs) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type namedRule struct {
+	name string
+	rule KeeperRule
+}
+
+// rules returns the rules of the keeper, starting with the preferred roots. Unknown rule names are skipped.
+func (k Keeper) rules(root string) []namedRule {
+	var rules []namedRule
+	if len(k.PreferredRoots) > 0 {
+		preferred := func(m ClusterMember) bool {
+			abs := filepath.Join(root, m.Path)
+			for _, pattern := range k.PreferredRoots {
+				if MatchPattern(pattern, abs) {
+					return true
+				}
+			}
+			return false
+		}
+		rules = append(rules, namedRule{"preferred root", func(a, b ClusterMember) int {
+			return boolPreference(preferred(a), preferred(b))
+		}})
+	}
+	for _, name := range k.Rules {
+		if r, ok := KeeperRules[name]; ok {
+			rules = append(rules, namedRule{name, r})
+		}
+	}
+	return rules
+}
+
+// Rank returns the indices of the members, from most to least preferred to keep, along with the name of the rule that decided
+// between the first two. Members between which no rule decides keep their order.
+func (k Keeper) Rank(members []ClusterMember, root string) ([]int, string) {
+	rules := k.rules(root)
+	compare := func(a, b ClusterMember) (int, string) {
+		for _, r := range rules {
+			if c := r.rule(a, b); c != 0 {
+				return c, r.name
+			}
+		}
+		return 0, ""
+	}
+	order := make([]int, len(members))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		c, _ := compare(members[order[i]], members[order[j]])
+		return c < 0
+	})
+	if len(order) < 2 {
+		return order, ""
+	}
+	_, reason := compare(members[order[0]], members[order[1]])
+	return order, reason
+}
+
+// Choose chooses the keeper of each cluster, except those that are fixed (by index), for which it was chosen already.
+// Members of different clusters may be nested, e.g. when two directories are copies, and so are their subdirectories along with
+// a third one. The keepers are chosen consistently: rather than the keeper as per Rank, a cluster keeps the member that is within
+// (or contains) the keeper of another cluster, as that one is kept anyway. Otherwise, removing the copies of one cluster could
+// remove the keeper of the other, and with it the last copy. Likewise, a member within a copy that another cluster removes is not kept.
+// The fixed clusters go first, then the others from the outermost to the innermost.
+func (k Keeper) Choose(clusters []Cluster, root string, fixed map[int]bool) {
+	depth := func(c Cluster) int {
+		min := -1
+		for _, m := range c.Members {
+			if d := strings.Count(m.Path, "/"); min < 0 || d < min {
+				min = d
+			}
+		}
+		return min
+	}
+	order := make([]int, len(clusters))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if fixed[order[i]] != fixed[order[j]] {
+			return fixed[order[i]]
+		}
+		return depth(clusters[order[i]]) < depth(clusters[order[j]])
+	})
+
+	var kept, removed []string
+	for _, i := range order {
+		c := &clusters[i]
+		if !fixed[i] {
+			rank, reason := k.Rank(c.Members, root)
+			c.Keeper, c.KeeperReason = pick(c.Members, rank, reason, kept, removed)
+		}
+		for j, m := range c.Members {
+			if j == c.Keeper {
+				kept = append(kept, m.Path)
+			} else if c.Identical {
+				removed = append(removed, m.Path)
+			}
+		}
+	}
+}
+
+// pick returns the index of the member to keep out of the ranked ones, and why, given the paths that other clusters keep and remove
+func pick(members []ClusterMember, rank []int, reason string, kept, removed []string) (int, string) {
+	for _, j := range rank {
+		p := members[j].Path
+		if along := nestedWith(p, kept); along != "" && !within(p, removed) {
+			if j == rank[0] {
+				return j, reason
+			}
+			return j, "along with " + along
+		}
+	}
+	for _, j := range rank {
+		if !within(members[j].Path, removed) {
+			if j == rank[0] {
+				return j, reason
+			}
+			return j, "not within a removed copy"
+		}
+	}
+	return rank[0], reason
+}
+
+// within returns whether the path is any of the paths, or within one of them
+func within(p string, paths []string) bool {
+	for _, other := range paths {
+		if p == other || Child(other, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedWith returns the first of the paths that the path is within, or that is within the path. "" if there is none
+func nestedWith(p string, paths []string) string {
+	for _, other := range paths {
+		if Child(other, p) || Child(p, other) {
+			return other
+		}
+	}
+	return ""
+}
+
+// Decision is what to do with a group of copies: keep one, remove the others, or leave them to review
+type Decision struct {
+	Keep   ClusterMember
+	Remove []ClusterMember
+	Review []ClusterMember // copies that are not safe to remove automatically (see Plan)
+	Reason string          // why the kept copy was chosen (see Cluster.KeeperReason)
+}
+
+// Reclaimable returns the number of bytes that removing the copies frees
+func (d Decision) Reclaimable() int64 {
+	var size int64
+	for _, m := range d.Remove {
+		size += m.Size
+	}
+	return size
+}
+
+// Decision returns the decision for the cluster on its own. See Plan for the decisions for several clusters.
+func (c Cluster) Decision() Decision {
+	return Plan([]Cluster{c})[0]
+}
+
+// Plan returns the decisions for the clusters: keep the keeper of each, and remove the other members.
+// Only identical copies are removed: the members of clusters that are merely similar have content of their own, so they are left
+// to review. So are members that contain the keeper of another cluster, or are within one, as removing them would remove
+// (part of) a copy that is to be kept, and partial members, as their content that was not scanned may exist nowhere else.
+func Plan(clusters []Cluster) []Decision {
+	var kept []string
+	for _, c := range clusters {
+		kept = append(kept, c.Members[c.Keeper].Path)
+	}
+	decisions := make([]Decision, len(clusters))
+	for i, c := range clusters {
+		d := Decision{Keep: c.Members[c.Keeper], Reason: c.KeeperReason}
+		for j, m := range c.Members {
+			switch {
+			case j == c.Keeper:
+			case !c.Identical || m.Partial || nestedWith(m.Path, kept) != "":
+				d.Review = append(d.Review, m)
+			default:
+				d.Remove = append(d.Remove, m)
+			}
+		}
+		decisions[i] = d
+	}
+	return decisions
+}
+
+// DecidePair applies the keeper of the options to a pair of directories, if they are copies of each other as per Clusters.
+// Otherwise, or if one is within the other, it returns false.
+func DecidePair(all map[string]DirPrint, p PairSim, opts ClusterOpts) (Decision, bool) {
+	if !opts.copies(p) || Child(p.Path1, p.Path2) || Child(p.Path2, p.Path1) {
+		return Decision{}, false
+	}
+	members := []ClusterMember{opts.member(all, p.Path1), opts.member(all, p.Path2)}
+	order, reason := opts.Keeper.Rank(members, opts.Root)
+	c := Cluster{Members: members, Identical: p.Sim.Identical() && !p.Partial, Keeper: order[0], KeeperReason: reason}
+	return c.Decision(), true
+}
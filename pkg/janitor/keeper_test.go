@@ -0,0 +1,149 @@
+package janitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestKeeperRank(t *testing.T) {
+	t.Setenv("HOME", "/home/joe")
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	members := []ClusterMember{
+		{Path: "backup/2020/photos", ModTime: day(3)},
+		{Path: "photos", ModTime: day(2)},
+		{Path: "old/photos", ModTime: day(1), Temp: true},
+		{Path: "in.zip/photos", Archive: true}, // unknown time
+	}
+	cases := []struct {
+		keeper    Keeper
+		expOrder  []int
+		expReason string
+	}{
+		{Keeper{}, []int{0, 1, 2, 3}, ""},
+		{Keeper{Rules: []string{"shortest"}}, []int{1, 2, 3, 0}, "shortest"},
+		{Keeper{Rules: []string{"shallowest"}}, []int{1, 2, 3, 0}, "shallowest"},
+		{Keeper{Rules: []string{"oldest", "shortest"}}, []int{2, 1, 0, 3}, "oldest"},
+		{Keeper{Rules: []string{"newest"}}, []int{0, 1, 2, 3}, "newest"},
+		{Keeper{Rules: []string{"not-temp", "oldest"}}, []int{1, 0, 3, 2}, "oldest"},
+		{Keeper{Rules: []string{"archive"}}, []int{3, 0, 1, 2}, "archive"},
+		{Keeper{Rules: []string{"not-archive", "shortest"}}, []int{1, 2, 0, 3}, "shortest"},
+		{Keeper{PreferredRoots: []string{"~/scan/backup/"}, Rules: []string{"oldest"}}, []int{0, 2, 1, 3}, "preferred root"},
+		{Keeper{PreferredRoots: []string{"/elsewhere/"}, Rules: []string{"unknown", "shortest"}}, []int{1, 2, 3, 0}, "shortest"},
+	}
+	for _, c := range cases {
+		order, reason := c.keeper.Rank(members, "/home/joe/scan")
+		if diff := cmp.Diff(c.expOrder, order); diff != "" || reason != c.expReason {
+			t.Errorf("%+v: Rank() mismatch (-want +got):\n%s\nreason %q, want %q", c.keeper, diff, reason, c.expReason)
+		}
+	}
+}
+
+func TestKeeperTemp(t *testing.T) {
+	cases := []struct {
+		keeper Keeper
+		path   string
+		exp    bool
+	}{
+		{Keeper{}, "photos", false},
+		{Keeper{}, "tmp/photos", true},
+		{Keeper{}, "a/.cache/b/photos", true},
+		{Keeper{}, "photos.tmp", true},
+		{Keeper{}, "temperature", false},
+		{Keeper{TempPatterns: []string{"scratch"}}, "tmp/photos", false},
+		{Keeper{TempPatterns: []string{"scratch"}}, "scratch/photos", true},
+		{Keeper{TempPatterns: []string{"/scan/"}}, "photos", true},
+		{Keeper{TempPatterns: []string{}}, "tmp/photos", false},
+	}
+	for _, c := range cases {
+		if got := c.keeper.temp("/scan", c.path); got != c.exp {
+			t.Errorf("%+v: temp(%q) = %t, want %t", c.keeper, c.path, got, c.exp)
+		}
+	}
+}
+
+func TestDecisions(t *testing.T) {
+	all := map[string]DirPrint{
+		"photos":              {Path: "photos", Files: []FilePrint{{Path: "a.jpg", Size: 3, Hash: FooHash}}},
+		"tmp":                 {Path: "tmp"},
+		"tmp/photos":          {Path: "photos", Files: []FilePrint{{Path: "a.jpg", Size: 3, Hash: FooHash}}},
+		"backup.zip":          {Path: "backup.zip"},
+		"backup.zip/photos":   {Path: "photos", Files: []FilePrint{{Path: "a.jpg", Size: 3, Hash: FooHash}}},
+		"unrelated":           {Path: "unrelated", Files: []FilePrint{{Path: "b.jpg", Size: 5, Hash: BarHash}}},
+		"photos/nested.zip":   {Path: "nested.zip"},
+		"photos/nested.zip/x": {Path: "x"},
+	}
+	identical := Similarity{BytesSame: 3, FilesSame: 1, PathSim: 1}
+	pairs := []PairSim{
+		{Path1: "backup.zip/photos", Path2: "photos", Sim: identical},
+		{Path1: "photos", Path2: "tmp/photos", Sim: identical},
+		{Path1: "backup.zip/photos", Path2: "tmp/photos", Sim: identical},
+		{Path1: "photos", Path2: "unrelated", Sim: Similarity{BytesDiff: 8}},
+	}
+	opts := ClusterOpts{Keeper: Keeper{Rules: []string{"not-temp", "not-archive"}}, Root: "/scan"}
+
+	clusters := Clusters(all, pairs, opts)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %+v", clusters)
+	}
+	exp := Decision{
+		Keep: ClusterMember{Path: "photos", Size: 3},
+		Remove: []ClusterMember{
+			{Path: "backup.zip/photos", Size: 3, Archive: true},
+			{Path: "tmp/photos", Size: 3, Temp: true},
+		},
+		Reason: "not-archive",
+	}
+	d := clusters[0].Decision()
+	if diff := cmp.Diff(exp, d); diff != "" {
+		t.Errorf("Decision() mismatch (-want +got):\n%s", diff)
+	}
+	if d.Reclaimable() != 6 {
+		t.Errorf("expected 6 reclaimable bytes, got %d", d.Reclaimable())
+	}
+
+	d, ok := DecidePair(all, pairs[1], opts)
+	exp = Decision{
+		Keep:   ClusterMember{Path: "photos", Size: 3},
+		Remove: []ClusterMember{{Path: "tmp/photos", Size: 3, Temp: true}},
+		Reason: "not-temp",
+	}
+	if diff := cmp.Diff(exp, d); !ok || diff != "" {
+		t.Errorf("DecidePair() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := DecidePair(all, pairs[3], opts); ok {
+		t.Errorf("DecidePair() decided on a pair that is not a copy")
+	}
+	if !archived(all, "photos/nested.zip/x") || archived(all, "photos") {
+		t.Errorf("archived() does not recognize what is within a zip file")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	member := func(p string) ClusterMember { return ClusterMember{Path: p, Size: 3} }
+	parent := Cluster{Members: []ClusterMember{member("x"), member("y")}, Identical: true, Keeper: 1}
+	child := Cluster{Members: []ClusterMember{member("x/sub"), member("y/sub"), member("z/sub")}, Identical: true}
+	similar := Cluster{Members: []ClusterMember{member("a"), member("b")}}
+
+	// the keepers are inconsistent, as if the user chose them: removing x would remove x/sub, and removing y/sub would change y
+	got := Plan([]Cluster{parent, child, similar})
+	exp := []Decision{
+		{Keep: member("y"), Review: []ClusterMember{member("x")}},
+		{Keep: member("x/sub"), Remove: []ClusterMember{member("z/sub")}, Review: []ClusterMember{member("y/sub")}},
+		{Keep: member("a"), Review: []ClusterMember{member("b")}},
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("Plan() mismatch (-want +got):\n%s", diff)
+	}
+	if got[1].Reclaimable() != 3 || got[2].Reclaimable() != 0 {
+		t.Errorf("expected only removed copies to be reclaimable, got %d and %d", got[1].Reclaimable(), got[2].Reclaimable())
+	}
+
+	// with consistent keepers, all copies but the kept ones are removed
+	child.Keeper = 1
+	got = Plan([]Cluster{parent, child})
+	if len(got[0].Review) != 0 || len(got[1].Review) != 0 || len(got[0].Remove) != 1 || len(got[1].Remove) != 2 {
+		t.Errorf("Plan() of consistent keepers = %+v, want no copies to review", got)
+	}
+}
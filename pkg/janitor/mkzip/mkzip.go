@@ -1,44 +1,209 @@
-// package mkzip aids with making zip files
+// package mkzip aids with making zip files, and tar and tgz files
 package mkzip
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
 )
 
+// Entry is a file or directory within an archive. Only Path and Body are needed for a regular file
 type Entry struct {
-	Path string
-	Body string
+	Path     string
+	Body     string
+	Dir      bool        // a directory rather than a file. (the Path may or may not end with a slash)
+	Mode     fs.FileMode // permissions. 0 means 0644 for files and 0755 for directories
+	Modified time.Time   // zero means none (zip) or the unix epoch (tar)
+	Store    bool        // store the body as is, rather than deflating it (zip only)
+	Comment  string      // (zip only)
+	Archive  *Archive    // if set, the body is this archive
 }
 
-func Do(files []Entry) ([]byte, zip.Reader, error) {
+// Format is the format of an archive
+type Format int
+
+const (
+	Zip Format = iota
+	Tar
+	Tgz // gzipped tar
+)
+
+// Archive is an archive to make
+type Archive struct {
+	Format  Format
+	Entries []Entry
+	Comment string // (zip only)
+}
+
+// Bytes returns the archive
+func (a Archive) Bytes() ([]byte, error) {
+	switch a.Format {
+	case Zip:
+		return a.zip()
+	case Tar:
+		return a.tar()
+	case Tgz:
+		b, err := a.tar()
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		w := gzip.NewWriter(buf)
+		_, err = w.Write(b)
+		if err == nil {
+			err = w.Close()
+		}
+		return buf.Bytes(), err
+	}
+	return nil, fmt.Errorf("unknown format %d", a.Format)
+}
+
+// MustBytes is like Bytes but panics upon error
+func (a Archive) MustBytes() []byte {
+	b, err := a.Bytes()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// body returns the body of the entry, generating it if it is an archive
+func (e Entry) body() ([]byte, error) {
+	if e.Archive != nil {
+		return e.Archive.Bytes()
+	}
+	return []byte(e.Body), nil
+}
+
+// mode returns the permissions of the entry
+func (e Entry) mode() fs.FileMode {
+	switch {
+	case e.Mode != 0:
+		return e.Mode.Perm()
+	case e.Dir:
+		return 0755
+	}
+	return 0644
+}
+
+func (a Archive) zip() ([]byte, error) {
 	buf := new(bytes.Buffer)
 	w := zip.NewWriter(buf)
 
-	for _, file := range files {
-		f, err := w.Create(file.Path)
+	for _, e := range a.Entries {
+		hdr := &zip.FileHeader{
+			Name:     e.Path,
+			Method:   zip.Deflate,
+			Comment:  e.Comment,
+			Modified: e.Modified,
+		}
+		if e.Store {
+			hdr.Method = zip.Store
+		}
+		mode := e.mode()
+		if e.Dir {
+			// directories have no body to compress
+			hdr.Name = strings.TrimSuffix(e.Path, "/") + "/"
+			hdr.Method = zip.Store
+			mode |= fs.ModeDir
+		}
+		hdr.SetMode(mode)
+		f, err := w.CreateHeader(hdr)
 		if err != nil {
-			return nil, zip.Reader{}, err
+			return nil, err
+		}
+		if e.Dir {
+			continue
 		}
-		_, err = f.Write([]byte(file.Body))
+		body, err := e.body()
 		if err != nil {
-			return nil, zip.Reader{}, err
+			return nil, err
+		}
+		_, err = f.Write(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if a.Comment != "" {
+		err := w.SetComment(a.Comment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a Archive) tar() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := tar.NewWriter(buf)
+
+	for _, e := range a.Entries {
+		modified := e.Modified
+		if modified.IsZero() {
+			modified = time.Unix(0, 0)
+		}
+		hdr := &tar.Header{
+			Name:     e.Path,
+			Typeflag: tar.TypeReg,
+			Mode:     int64(e.mode()),
+			ModTime:  modified,
+		}
+		if e.Dir {
+			hdr.Name = strings.TrimSuffix(e.Path, "/") + "/"
+			hdr.Typeflag = tar.TypeDir
+			err := w.WriteHeader(hdr)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body, err := e.body()
+		if err != nil {
+			return nil, err
+		}
+		hdr.Size = int64(len(body))
+		err = w.WriteHeader(hdr)
+		if err != nil {
+			return nil, err
+		}
+		_, err = w.Write(body)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	err := w.Close()
 	if err != nil {
-		return nil, zip.Reader{}, err
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Do makes a zip file of the entries, returning both its data and a reader of it
+func Do(files []Entry) ([]byte, *zip.Reader, error) {
+	b, err := Archive{Entries: files}.Bytes()
+	if err != nil {
+		return nil, nil, err
 	}
-	b := buf.Bytes()
 	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
 	if err != nil {
-		return nil, zip.Reader{}, err
+		return nil, nil, err
 	}
-	return b, *zr, nil
+	return b, zr, nil
 }
 
-func MustDo(files []Entry) ([]byte, zip.Reader) {
+// MustDo is like Do but panics upon error
+func MustDo(files []Entry) ([]byte, *zip.Reader) {
 	b, r, err := Do(files)
 	if err != nil {
 		panic(err)
@@ -0,0 +1,124 @@
+package mkzip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestZip(t *testing.T) {
+	day := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	inner := &Archive{Entries: []Entry{{Path: "x", Body: "inner"}}}
+	b := Archive{
+		Entries: []Entry{
+			{Path: "dir", Dir: true, Mode: 0700},
+			{Path: "dir/a", Body: "foo", Store: true, Modified: day, Comment: "a comment"},
+			{Path: "dir/b", Body: "bar", Mode: 0600},
+			{Path: "nested.zip", Archive: inner},
+		},
+		Comment: "an archive",
+	}.MustBytes()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.Comment != "an archive" {
+		t.Errorf("expected the archive comment, got %q", zr.Comment)
+	}
+	exp := []struct {
+		name    string
+		mode    fs.FileMode
+		method  uint16
+		comment string
+	}{
+		{"dir/", fs.ModeDir | 0700, zip.Store, ""},
+		{"dir/a", 0644, zip.Store, "a comment"},
+		{"dir/b", 0600, zip.Deflate, ""},
+		{"nested.zip", 0644, zip.Deflate, ""},
+	}
+	if len(zr.File) != len(exp) {
+		t.Fatalf("expected %d entries, got %d", len(exp), len(zr.File))
+	}
+	for i, e := range exp {
+		f := zr.File[i]
+		if f.Name != e.name || f.Mode() != e.mode || f.Method != e.method || f.Comment != e.comment {
+			t.Errorf("entry %d: expected %+v, got %s %s %d %q", i, e, f.Name, f.Mode(), f.Method, f.Comment)
+		}
+	}
+	if !zr.File[1].Modified.Equal(day) {
+		t.Errorf("expected modification time %s, got %s", day, zr.File[1].Modified)
+	}
+
+	// the nested archive can be read as well
+	rc, err := zr.File[3].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nr, err := zip.NewReader(bytes.NewReader(nested), int64(len(nested)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(nr, "x")
+	if err != nil || string(data) != "inner" {
+		t.Errorf("expected the nested file to contain %q, got %q, %v", "inner", data, err)
+	}
+}
+
+func TestTar(t *testing.T) {
+	day := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	entries := []Entry{
+		{Path: "dir/", Dir: true},
+		{Path: "dir/a", Body: "foo", Modified: day, Mode: 0600},
+		{Path: "nested.zip", Archive: &Archive{Entries: []Entry{{Path: "x", Body: "inner"}}}},
+	}
+	for _, format := range []Format{Tar, Tgz} {
+		var r io.Reader = bytes.NewReader(Archive{Format: format, Entries: entries}.MustBytes())
+		if format == Tgz {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = gr
+		}
+		tr := tar.NewReader(r)
+		var got []string
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("format %d: %v", format, err)
+			}
+			body, _ := io.ReadAll(tr)
+			got = append(got, hdr.Name)
+			switch hdr.Name {
+			case "dir/":
+				if hdr.Typeflag != tar.TypeDir || hdr.Mode != 0755 {
+					t.Errorf("format %d: expected a directory with mode 0755, got %+v", format, hdr)
+				}
+			case "dir/a":
+				if string(body) != "foo" || hdr.Mode != 0600 || !hdr.ModTime.Equal(day) {
+					t.Errorf("format %d: unexpected entry %+v with body %q", format, hdr, body)
+				}
+			case "nested.zip":
+				if _, err := zip.NewReader(bytes.NewReader(body), int64(len(body))); err != nil {
+					t.Errorf("format %d: the nested archive is not a zip file: %v", format, err)
+				}
+			}
+		}
+		if len(got) != len(entries) {
+			t.Errorf("format %d: expected %d entries, got %v", format, len(entries), got)
+		}
+	}
+}
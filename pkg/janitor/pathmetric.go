@@ -0,0 +1,85 @@
+package janitor
+
+import (
+	"path"
+	"strings"
+
+	"github.com/adrg/strutil"
+	"github.com/adrg/strutil/metrics"
+)
+
+// PathMetric returns the similarity of two paths of matching files, from 0 (nothing in common) to 1 (equal)
+type PathMetric func(a, b string) float64
+
+// HammingMetric counts the positions at which the paths differ.
+// It is harsh for paths of different lengths: "photos/2019/img.jpg" and "2019/img.jpg" have nothing in common.
+func HammingMetric(a, b string) float64 {
+	return strutil.Similarity(a, b, metrics.NewHamming())
+}
+
+// LevenshteinMetric counts the edits (insertions, deletions and substitutions of characters) needed to turn one path into the other.
+func LevenshteinMetric(a, b string) float64 {
+	return strutil.Similarity(a, b, metrics.NewLevenshtein())
+}
+
+// JaroWinklerMetric compares the characters that the paths have in common (within some distance of each other),
+// and favors paths with a common prefix.
+func JaroWinklerMetric(a, b string) float64 {
+	return strutil.Similarity(a, b, metrics.NewJaroWinkler())
+}
+
+// ComponentMetric compares the base names and the directories of the paths separately, weighing the base names twice as much.
+// Base names are compared with Levenshtein, directories by the longest common sequence of their segments.
+// This way, files that kept their name but were moved into another (sub)directory still score well.
+func ComponentMetric(a, b string) float64 {
+	dirA, baseA := path.Split(a)
+	dirB, baseB := path.Split(b)
+	baseSim := strutil.Similarity(baseA, baseB, metrics.NewLevenshtein())
+	return (2*baseSim + segmentSimilarity(splitDir(dirA), splitDir(dirB))) / 3
+}
+
+// splitDir splits a directory as returned by path.Split (e.g. "foo/bar/") into its segments
+func splitDir(dir string) []string {
+	dir = strings.TrimSuffix(dir, "/")
+	if dir == "" {
+		return nil
+	}
+	return strings.Split(dir, "/")
+}
+
+// segmentSimilarity returns the length of the longest common subsequence of the segments, relative to the longest of the two.
+func segmentSimilarity(a, b []string) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			case lcs[i+1][j] > lcs[i][j+1]:
+				lcs[i][j] = lcs[i+1][j]
+			default:
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	max := len(a)
+	if len(b) > max {
+		max = len(b)
+	}
+	return float64(lcs[0][0]) / float64(max)
+}
+
+// PathMetrics are the available path metrics, by name
+var PathMetrics = map[string]PathMetric{
+	"hamming":      HammingMetric,
+	"levenshtein":  LevenshteinMetric,
+	"jaro-winkler": JaroWinklerMetric,
+	"components":   ComponentMetric,
+}
@@ -0,0 +1,66 @@
+package janitor
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPathMetrics(t *testing.T) {
+	cases := []struct {
+		a, b string
+		exp  map[string]float64
+	}{
+		{
+			// a file that moved into a subdirectory
+			"photos/2019/img.jpg", "2019/img.jpg",
+			map[string]float64{"hamming": 0, "levenshtein": 0.63, "jaro-winkler": 0.82, "components": 0.83},
+		},
+		{
+			"src/main.go", "backup/src/main.go",
+			map[string]float64{"hamming": 0.06, "levenshtein": 0.61, "jaro-winkler": 0.78, "components": 0.83},
+		},
+		{
+			// jaro-winkler only considers characters that are near each other
+			"dir1/dir2/b.txt", "b.txt",
+			map[string]float64{"hamming": 0, "levenshtein": 0.33, "jaro-winkler": 0, "components": 0.67},
+		},
+		{
+			"img.jpg", "IMG_0001.jpg",
+			map[string]float64{"hamming": 0, "levenshtein": 0.33, "jaro-winkler": 0.63, "components": 0.56},
+		},
+		{
+			"a/b/c.txt", "a/b/c.txt",
+			map[string]float64{"hamming": 1, "levenshtein": 1, "jaro-winkler": 1, "components": 1},
+		},
+		{
+			"c.txt", "c.txt",
+			map[string]float64{"hamming": 1, "levenshtein": 1, "jaro-winkler": 1, "components": 1},
+		},
+	}
+	for _, c := range cases {
+		for name, exp := range c.exp {
+			got := PathMetrics[name](c.a, c.b)
+			if math.Abs(got-exp) > 0.01 {
+				t.Errorf("%s(%q, %q) = %.2f, expected %.2f", name, c.a, c.b, got, exp)
+			}
+		}
+	}
+}
+
+func TestSegmentSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b []string
+		exp  float64
+	}{
+		{nil, nil, 1},
+		{[]string{"a"}, nil, 0},
+		{[]string{"photos", "2019"}, []string{"2019"}, 0.5},
+		{[]string{"a", "b", "c"}, []string{"a", "x", "c"}, float64(2) / 3},
+		{[]string{"a", "b"}, []string{"b", "a"}, 0.5},
+	}
+	for _, c := range cases {
+		if got := segmentSimilarity(c.a, c.b); math.Abs(got-c.exp) > 0.001 {
+			t.Errorf("segmentSimilarity(%q, %q) = %.3f, expected %.3f", c.a, c.b, got, c.exp)
+		}
+	}
+}
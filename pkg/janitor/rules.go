@@ -0,0 +1,152 @@
+package janitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Action is what the user wants to happen to a file or directory
+type Action string
+
+const (
+	ActionKeep  Action = "keep"
+	ActionTrash Action = "trash"
+)
+
+// Condition is a condition on the Similarity of a pair of directories. The zero value matches anything.
+type Condition struct {
+	Identical  bool    `json:",omitempty"` // the pair must be identical
+	MinContent float64 `json:",omitempty"` // minimum content similarity
+	MinPath    float64 `json:",omitempty"` // minimum path similarity
+}
+
+func (c Condition) Match(s Similarity) bool {
+	if c.Identical && !s.Identical() {
+		return false
+	}
+	if c.MinContent > 0 && (s.BytesSame+s.BytesDiff == 0 || s.ContentSimilarity() < c.MinContent) {
+		return false
+	}
+	return s.PathSim >= c.MinPath
+}
+
+func (c Condition) String() string {
+	var parts []string
+	if c.Identical {
+		parts = append(parts, "identical")
+	}
+	if c.MinContent > 0 {
+		parts = append(parts, fmt.Sprintf("bytes>=%.2f", c.MinContent))
+	}
+	if c.MinPath > 0 {
+		parts = append(parts, fmt.Sprintf("path>=%.2f", c.MinPath))
+	}
+	return strings.Join(parts, " and ")
+}
+
+// Rule remembers a decision of the user, such that it can be suggested again for matching files, directories or pairs.
+//
+// Patterns are matched against absolute paths, and support these forms:
+// - a pattern with a trailing slash is a path prefix: it matches the path itself and everything within it, e.g. "~/backup/"
+// - a pattern without any slash matches the basename, e.g. "*.part"
+// - anything else is a glob as per filepath.Match, e.g. "~/src/*"
+// A leading "~/" refers to the home directory.
+type Rule struct {
+	Pattern string    // the path that the action applies to
+	Over    string    `json:",omitempty"` // for pairs only: the path of the other directory
+	When    Condition // for pairs only: condition on their similarity
+	Action  Action
+}
+
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s %q", r.Action, r.Pattern)
+	if r.Over != "" {
+		s += fmt.Sprintf(" over %q", r.Over)
+	}
+	if c := r.When.String(); c != "" {
+		s += " when " + c
+	}
+	return s
+}
+
+// MatchPattern returns whether the absolute path p matches the pattern (see Rule for the syntax)
+func MatchPattern(pattern, p string) bool {
+	if strings.HasPrefix(pattern, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		pattern = strings.TrimSuffix(home, "/") + pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		return p+"/" == pattern || strings.HasPrefix(p, pattern)
+	}
+	if !strings.Contains(pattern, "/") {
+		p = filepath.Base(p)
+	}
+	ok, _ := filepath.Match(pattern, p)
+	return ok
+}
+
+// MatchPath returns whether the rule applies to the file or directory at absolute path p.
+// rules for pairs never match individual paths.
+func (r Rule) MatchPath(p string) bool {
+	return r.Over == "" && MatchPattern(r.Pattern, p)
+}
+
+// MatchPair returns whether the rule applies to the pair of directories at absolute paths p1 and p2, and if so,
+// which of the paths (1 or 2) the action applies to.
+func (r Rule) MatchPair(p1, p2 string, s Similarity) (int, bool) {
+	if r.Over == "" || !r.When.Match(s) {
+		return 0, false
+	}
+	if MatchPattern(r.Pattern, p1) && MatchPattern(r.Over, p2) {
+		return 1, true
+	}
+	if MatchPattern(r.Pattern, p2) && MatchPattern(r.Over, p1) {
+		return 2, true
+	}
+	return 0, false
+}
+
+// Rules is an ordered list of rules. When multiple rules match, the first one wins.
+type Rules []Rule
+
+// LoadRules reads rules previously written by Rules.Save
+func LoadRules(r io.Reader) (Rules, error) {
+	var rs Rules
+	err := json.NewDecoder(r).Decode(&rs)
+	return rs, err
+}
+
+// Save writes the rules in a human readable (and editable) format
+func (rs Rules) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rs)
+}
+
+// ForPath returns the first rule that matches the absolute path p
+func (rs Rules) ForPath(p string) (Rule, bool) {
+	for _, r := range rs {
+		if r.MatchPath(p) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// ForPair returns the first rule that matches the pair of directories at the absolute paths p1 and p2,
+// and which of the paths (1 or 2) the action applies to.
+func (rs Rules) ForPair(p1, p2 string, s Similarity) (Rule, int, bool) {
+	for _, r := range rs {
+		if which, ok := r.MatchPair(p1, p2, s); ok {
+			return r, which, true
+		}
+	}
+	return Rule{}, 0, false
+}
@@ -0,0 +1,106 @@
+package janitor
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchPattern(t *testing.T) {
+	t.Setenv("HOME", "/home/joe")
+	cases := []struct {
+		pattern string
+		p       string
+		exp     bool
+	}{
+		{"*.part", "/home/joe/Downloads/movie.mkv.part", true},
+		{"*.part", "/home/joe/Downloads/movie.mkv", false},
+		{"node_modules", "/home/joe/src/app/node_modules", true},
+		{"~/src/*", "/home/joe/src/app", true},
+		{"~/src/*", "/home/joe/src/app/lib", false},
+		{"~/src/*", "/home/jane/src/app", false},
+		{"/mnt/backup/", "/mnt/backup", true},
+		{"/mnt/backup/", "/mnt/backup/src/app", true},
+		{"/mnt/backup/", "/mnt/backups", false},
+		{"~/backup/", "/home/joe/backup/src", true},
+	}
+	for _, c := range cases {
+		if got := MatchPattern(c.pattern, c.p); got != c.exp {
+			t.Errorf("MatchPattern(%q, %q) = %t, expected %t", c.pattern, c.p, got, c.exp)
+		}
+	}
+}
+
+func TestRulesForPair(t *testing.T) {
+	t.Setenv("HOME", "/home/joe")
+	rules := Rules{
+		{Pattern: "~/src/*", Over: "~/backup/src/*", When: Condition{Identical: true}, Action: ActionKeep},
+		{Pattern: "/mnt/old/", Over: "~/", When: Condition{MinContent: 0.9}, Action: ActionTrash},
+		{Pattern: "*.part", Action: ActionTrash},
+	}
+	identical := Similarity{BytesSame: 100, PathSim: 1}
+	similar := Similarity{BytesSame: 95, BytesDiff: 5, PathSim: 0.8}
+	different := Similarity{BytesSame: 50, BytesDiff: 50, PathSim: 0.8}
+
+	cases := []struct {
+		p1, p2   string
+		sim      Similarity
+		expRule  int // index within rules, or -1 if none should match
+		expWhich int
+	}{
+		{"/home/joe/src/app", "/home/joe/backup/src/app", identical, 0, 1},
+		{"/home/joe/backup/src/app", "/home/joe/src/app", identical, 0, 2},
+		{"/home/joe/backup/src/app", "/home/joe/src/app", similar, -1, 0},
+		{"/home/joe/photos", "/mnt/old/photos", similar, 1, 2},
+		{"/home/joe/photos", "/mnt/old/photos", different, -1, 0},
+		{"/home/joe/a.part", "/home/joe/b.part", identical, -1, 0}, // rules for paths don't apply to pairs
+	}
+	for i, c := range cases {
+		r, which, ok := rules.ForPair(c.p1, c.p2, c.sim)
+		if c.expRule < 0 {
+			if ok {
+				t.Errorf("case %d: expected no match, got rule %s for path %d", i, r, which)
+			}
+			continue
+		}
+		if !ok || which != c.expWhich {
+			t.Errorf("case %d: expected rule %s for path %d, got %s for path %d (ok: %t)", i, rules[c.expRule], c.expWhich, r, which, ok)
+			continue
+		}
+		if diff := cmp.Diff(rules[c.expRule], r); diff != "" {
+			t.Errorf("case %d: ForPair() mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+
+	r, ok := rules.ForPath("/home/joe/Downloads/x.part")
+	if !ok || r.Pattern != "*.part" {
+		t.Errorf("ForPath() expected rule for *.part, got %s (ok: %t)", r, ok)
+	}
+	_, ok = rules.ForPath("/home/joe/src/app")
+	if ok {
+		t.Errorf("ForPath() expected rules for pairs not to match")
+	}
+}
+
+func TestRulesSaveLoad(t *testing.T) {
+	exp := Rules{
+		{Pattern: "~/src/*", Over: "~/backup/src/*", When: Condition{Identical: true}, Action: ActionKeep},
+		{Pattern: "*.part", Action: ActionTrash},
+	}
+	var buf bytes.Buffer
+	err := exp.Save(&buf)
+	if err != nil {
+		t.Fatalf("Save() unexpected error %v", err)
+	}
+	got, err := LoadRules(&buf)
+	if err != nil {
+		t.Fatalf("LoadRules() unexpected error %v", err)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("LoadRules() mismatch (-want +got):\n%s", diff)
+	}
+	if s := exp[0].String(); s != `keep "~/src/*" over "~/backup/src/*" when identical` {
+		t.Errorf("String() got %s", s)
+	}
+}
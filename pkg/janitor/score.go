@@ -0,0 +1,71 @@
+package janitor
+
+import "sort"
+
+// Weights determine how much each aspect of a PairSim counts towards its score, see Scores.
+// A negative weight favors the opposite, e.g. a negative Bytes weight favors pairs that share few bytes.
+type Weights struct {
+	Content float64 // weight of the content similarity, including near bytes (see Similarity.NearContentSimilarity)
+	Path    float64 // weight of the path similarity
+	Bytes   float64 // weight of the shared (and thus reclaimable) bytes, relative to the most of any of the pairs
+	Files   float64 // weight of the shared files, relative to the most of any of the pairs
+}
+
+// DefaultWeights favor pairs that are similar in content, with path similarity and reclaimable space as tie breakers
+var DefaultWeights = Weights{
+	Content: 1,
+	Path:    0.25,
+	Bytes:   0.25,
+}
+
+// Scores returns the score of each of the pairs: the weighted sum of its aspects, which are each between 0 and 1.
+// Because shared bytes and files are relative to the most of any of the pairs, scores can only be compared within the same set of pairs.
+func (w Weights) Scores(pairs []PairSim) []float64 {
+	var maxBytes int64
+	var maxFiles int
+	for _, p := range pairs {
+		if p.Sim.BytesSame > maxBytes {
+			maxBytes = p.Sim.BytesSame
+		}
+		if p.Sim.FilesSame > maxFiles {
+			maxFiles = p.Sim.FilesSame
+		}
+	}
+	scores := make([]float64, len(pairs))
+	for i, p := range pairs {
+		s := w.Path * p.Sim.PathSim
+		if p.Sim.BytesSame+p.Sim.BytesDiff > 0 {
+			s += w.Content * p.Sim.NearContentSimilarity()
+		}
+		if maxBytes > 0 {
+			s += w.Bytes * float64(p.Sim.BytesSame) / float64(maxBytes)
+		}
+		if maxFiles > 0 {
+			s += w.Files * float64(p.Sim.FilesSame) / float64(maxFiles)
+		}
+		scores[i] = s
+	}
+	return scores
+}
+
+// Rank returns the indices of the pairs, ordered by descending score. Pairs with equal scores keep their order.
+func (w Weights) Rank(pairs []PairSim) []int {
+	scores := w.Scores(pairs)
+	order := make([]int, len(pairs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	return order
+}
+
+// SortByScore sorts the pairs by descending score. Pairs with equal scores keep their order.
+func SortByScore(pairs []PairSim, w Weights) {
+	sorted := make([]PairSim, 0, len(pairs))
+	for _, i := range w.Rank(pairs) {
+		sorted = append(sorted, pairs[i])
+	}
+	copy(pairs, sorted)
+}
@@ -0,0 +1,72 @@
+package janitor
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWeightsRank(t *testing.T) {
+	pairs := []PairSim{
+		{Path1: "small-identical", Sim: Similarity{BytesSame: 10, FilesSame: 1, PathSim: 1}},
+		{Path1: "big-near-duplicate", Sim: Similarity{BytesSame: 900, BytesDiff: 100, FilesSame: 9, PathSim: 0.5}},
+		{Path1: "medium-identical", Sim: Similarity{BytesSame: 100, FilesSame: 20, PathSim: 0.8}},
+		{Path1: "little-in-common", Sim: Similarity{BytesSame: 1, BytesDiff: 99, FilesSame: 1, PathSim: 1}},
+	}
+	cases := []struct {
+		w      Weights
+		scores []float64
+		order  []int
+	}{
+		{
+			Weights{Content: 1},
+			[]float64{1, 0.9, 1, 0.01},
+			[]int{0, 2, 1, 3},
+		},
+		{
+			Weights{Content: 1, Path: 0.01},
+			[]float64{1.01, 0.905, 1.008, 0.02},
+			[]int{0, 2, 1, 3},
+		},
+		{
+			Weights{Bytes: 1},
+			[]float64{10.0 / 900, 1, 100.0 / 900, 1.0 / 900},
+			[]int{1, 2, 0, 3},
+		},
+		{
+			Weights{Bytes: -1},
+			[]float64{-10.0 / 900, -1, -100.0 / 900, -1.0 / 900},
+			[]int{3, 0, 2, 1},
+		},
+		{
+			Weights{Files: 1},
+			[]float64{0.05, 0.45, 1, 0.05},
+			[]int{2, 1, 0, 3},
+		},
+		{
+			// big near-duplicates go first when reclaimable space weighs as much as the content similarity
+			Weights{Content: 1, Bytes: 1},
+			[]float64{1 + 10.0/900, 1.9, 1 + 100.0/900, 0.01 + 1.0/900},
+			[]int{1, 2, 0, 3},
+		},
+	}
+	opt := cmp.Comparer(func(x, y float64) bool {
+		return math.Abs(x-y) < 0.0001
+	})
+	for _, c := range cases {
+		if diff := cmp.Diff(c.scores, c.w.Scores(pairs), opt); diff != "" {
+			t.Errorf("%+v: Scores() mismatch (-want +got):\n%s", c.w, diff)
+		}
+		if diff := cmp.Diff(c.order, c.w.Rank(pairs)); diff != "" {
+			t.Errorf("%+v: Rank() mismatch (-want +got):\n%s", c.w, diff)
+		}
+	}
+
+	sorted := append([]PairSim(nil), pairs...)
+	SortByScore(sorted, Weights{Bytes: 1})
+	exp := []PairSim{pairs[1], pairs[2], pairs[0], pairs[3]}
+	if diff := cmp.Diff(exp, sorted); diff != "" {
+		t.Errorf("SortByScore() mismatch (-want +got):\n%s", diff)
+	}
+}
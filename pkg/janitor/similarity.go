@@ -1,26 +1,28 @@
 package janitor
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"math"
 	"sort"
-
-	"github.com/adrg/strutil"
-	"github.com/adrg/strutil/metrics"
 )
 
 type Similarity struct {
-	BytesSame int64   // number of bytes corresponding to files that match
-	BytesDiff int64   // number of bytes corresponding to files that don't match
-	PathSim   float64 // (average of all path similarities for content with a hash match)
+	BytesSame       int64   // number of bytes corresponding to files that match
+	BytesDiff       int64   // number of bytes corresponding to files that don't match
+	FilesSame       int     // number of files that match
+	PathSim         float64 // (average of all path similarities for content with a hash match)
+	BytesNear       int64   // number of BytesDiff, that are in chunks shared by files that don't match (see ChunkedFingerPrinter)
+	BytesSimilar    int64   // number of BytesDiff, that are in images that look the same as one on the other side (see ImageFingerPrint)
+	FilesNormalized int     // number of FilesSame, that only match after normalization, i.e. of which there is no byte-level copy (see TextFingerPrint)
 }
 
 func (s Similarity) Identical() bool {
 
 	// this is... probably good enough?
-	return s.BytesDiff == 0 && s.PathSim >= 0.99
+	// files that only match after normalization are not byte-level copies, so they are not identical.
+	return s.BytesDiff == 0 && s.PathSim >= 0.99 && s.FilesNormalized == 0
 }
 
 func (s Similarity) ContentSimilarity() float64 {
@@ -28,7 +30,23 @@ func (s Similarity) ContentSimilarity() float64 {
 	return float64(s.BytesSame) / float64(s.BytesSame+s.BytesDiff)
 }
 
+// NearContentSimilarity is like ContentSimilarity, but also counts the bytes in chunks shared by files that don't match,
+// and in similar images. Like BytesDiff, these count both sides, so only half of them are taken into account, like BytesSame.
+// Without chunks or similar images, it is the same as ContentSimilarity.
+func (s Similarity) NearContentSimilarity() float64 {
+	near := s.BytesNear + s.BytesSimilar
+	same := float64(s.BytesSame) + float64(near)/2
+	return same / (same + float64(s.BytesDiff-near))
+}
+
 func (s Similarity) String() string {
+	if s.BytesSimilar > 0 {
+		return fmt.Sprintf("<Similarity bytes=%.2f near=%.2f images=%.2f path=%.2f>", s.ContentSimilarity(), s.NearContentSimilarity(),
+			float64(s.BytesSimilar)/float64(s.BytesSame*2+s.BytesDiff), s.PathSim)
+	}
+	if s.BytesNear > 0 {
+		return fmt.Sprintf("<Similarity bytes=%.2f near=%.2f path=%.2f>", s.ContentSimilarity(), s.NearContentSimilarity(), s.PathSim)
+	}
 	return fmt.Sprintf("<Similarity bytes=%.2f path=%.2f>", s.ContentSimilarity(), s.PathSim)
 }
 
@@ -72,75 +90,82 @@ func (s1 Similarity) Less(s2 Similarity) bool {
 	return s1.PathSim < s2.PathSim
 }
 
+// NewSimilarity compares the files of both iterators, comparing the paths of matching files with the HammingMetric
 func NewSimilarity(a, b Iterator) Similarity {
-	var sim Similarity
-	var pathsCompared int
-
-	a.Next()
-	b.Next()
-
-	for {
-		av, aok := a.Value()
-		bv, bok := b.Value()
-
-		if !aok && !bok {
-			break
-		}
-
-		if aok && !bok {
-			sim.BytesDiff += av.Size
-			a.Next()
-			continue
-		}
-
-		if !aok && bok {
-			sim.BytesDiff += bv.Size
-			b.Next()
-			continue
-		}
-
-		// aok && bok
+	return NewSimilarityMetric(a, b, HammingMetric)
+}
 
-		if bytes.Compare(av.Hash[:], bv.Hash[:]) < 0 {
-			sim.BytesDiff += av.Size
-			a.Next()
-			continue
-		}
+// NewSimilarityMetric is like NewSimilarity, but compares the paths of matching files with the given metric.
+// It summarizes the comparison of the files, as explained by CompareMetric.
+// Files are compared as multisets: all the files with the same hash on either side form a group, and as many of them as possible
+// are paired up with those of the other side, such that their path similarity is maximal (see matchGroups).
+// Copies that can't be paired up count as different bytes.
+// Images that look the same, as per DefaultImageDistance, count as similar bytes.
+func NewSimilarityMetric(a, b Iterator, metric PathMetric) Similarity {
+	return similarity(a, b, metric, DefaultImageDistance)
+}
 
-		if bytes.Compare(av.Hash[:], bv.Hash[:]) > 0 {
-			sim.BytesDiff += bv.Size
-			b.Next()
-			continue
-		}
+type PairSim struct {
+	Path1      string
+	Path2      string
+	Sim        Similarity
+	Incomplete bool // at least one of the DirPrints is incomplete, so the similarity may not be accurate
+	Partial    bool // at least one of the DirPrints is partial, so even if they look identical, the directories may differ
+}
 
-		// bytes.Compare(av.Hash[:], bv.Hash[:]) == 0
+// PairOpts are the options for comparing DirPrints. The zero value means the defaults.
+type PairOpts struct {
+	PathMetric PathMetric // how to compare the paths of matching files. nil means HammingMetric
+	Weights    *Weights   // if set, pairs are sorted by descending score, rather than the default order (see GetPairSimsContext)
+	Filter     Filter     // pairs that don't pass the filter are left out of the results
 
-		// we assume here that the files are the same size
-		// specifically, that sha256 hashes don't collide.
-		sim.BytesSame += av.Size
-		similarity := strutil.Similarity(av.Path, bv.Path, metrics.NewHamming())
-		//fmt.Printf("similarity between %q and %q is %.2f\n", av.Path, bv.Path, similarity)
-		sim.PathSim += similarity
-		a.Next()
-		b.Next()
+	// ImageDistance is the maximum Hamming distance between the ImageHashes of images that don't match, for them to count as similar.
+	// nil means DefaultImageDistance, a negative distance means images are never similar.
+	ImageDistance *int
+}
 
-		pathsCompared++
+func (o PairOpts) pathMetric() PathMetric {
+	if o.PathMetric == nil {
+		return HammingMetric
 	}
+	return o.PathMetric
+}
 
-	if pathsCompared > 0 {
-		sim.PathSim = sim.PathSim / float64(pathsCompared)
+func (o PairOpts) imageDistance() int {
+	if o.ImageDistance == nil {
+		return DefaultImageDistance
 	}
-	return sim
+	return *o.ImageDistance
 }
 
-type PairSim struct {
-	Path1 string
-	Path2 string
-	Sim   Similarity
+// Filter leaves out pairs that are not similar enough to be interesting, e.g. two unrelated projects that both have the same LICENSE file.
+// The zero value lets all pairs through.
+type Filter struct {
+	MinContent float64 `json:"min_content"` // minimum content similarity
+	MinBytes   int64   `json:"min_bytes"`   // minimum number of shared bytes
+	MinFiles   int     `json:"min_files"`   // minimum number of shared files
+	MinPath    float64 `json:"min_path"`    // minimum path similarity
+}
+
+// Match returns whether a pair with the given similarity passes the filter
+func (f Filter) Match(s Similarity) bool {
+	if s.BytesSame+s.BytesDiff > 0 && s.ContentSimilarity() < f.MinContent {
+		return false
+	}
+	return s.BytesSame >= f.MinBytes && s.FilesSame >= f.MinFiles && s.PathSim >= f.MinPath
 }
 
 // keys are paths within an implicit walkPath
 func GetPairSims(all map[string]DirPrint, log io.Writer) []PairSim {
+	pairSims, _ := GetPairSimsContext(context.Background(), all, PairOpts{}, log)
+	return pairSims
+}
+
+// GetPairSimsContext is like GetPairSims, but takes options, and checks for cancellation of ctx before every pair comparison.
+// Upon cancellation, it returns the context's error, along with the pairs compared so far.
+// Note that these partial results have not been able to benefit from eliding based on identical pairs that weren't found yet.
+func GetPairSimsContext(ctx context.Context, all map[string]DirPrint, opts PairOpts, log io.Writer) ([]PairSim, error) {
+	metric := opts.pathMetric()
 	type seenKey struct {
 		p1 string
 		p2 string
@@ -148,9 +173,13 @@ func GetPairSims(all map[string]DirPrint, log io.Writer) []PairSim {
 	seen := make(map[seenKey]PairSim)      // seen paths that aren't identical.
 	seenIdent := make(map[seenKey]PairSim) // seen paths that are identical.
 	var pairSims []PairSim
+	var err error
 
+	// every DirPrint is iterated many times, so sort them once, rather than every time
+	sorted := make(map[string]DirPrint, len(all))
 	keys := make([]string, 0, len(all))
-	for k := range all {
+	for k, dp := range all {
+		sorted[k] = dp.SortedByHash()
 		keys = append(keys, k)
 	}
 
@@ -158,11 +187,17 @@ func GetPairSims(all map[string]DirPrint, log io.Writer) []PairSim {
 	// will allow us to skip over testing children if parents are identical (see below).
 	sort.Strings(keys)
 
+Outer:
 	for _, k1 := range keys {
-		dp1 := all[k1]
+		dp1 := sorted[k1]
 	Loop2:
 		for _, k2 := range keys {
-			dp2 := all[k2]
+			dp2 := sorted[k2]
+
+			if err = ctx.Err(); err != nil {
+				fmt.Fprintln(log, "INF GetPairSims canceled:", err, "returning partial results")
+				break Outer
+			}
 
 			// don't compare to self
 			if k1 == k2 {
@@ -248,18 +283,22 @@ func GetPairSims(all map[string]DirPrint, log io.Writer) []PairSim {
 			it1 := dp1.Iterator()
 			it2 := dp2.Iterator()
 			p := PairSim{
-				Path1: sk.p1,
-				Path2: sk.p2,
-				Sim:   NewSimilarity(it1, it2),
+				Path1:      sk.p1,
+				Path2:      sk.p2,
+				Sim:        similarity(it1, it2, metric, opts.imageDistance()),
+				Incomplete: dp1.Incomplete || dp2.Incomplete,
+				Partial:    dp1.Partial || dp2.Partial,
 			}
-			if p.Sim.Identical() {
+			// incomplete and partial dirprints may look identical, but that's not a good enough reason to elide other pairs
+			if p.Sim.Identical() && !p.Incomplete && !p.Partial {
 				seenIdent[sk] = p
 			} else {
 				seen[sk] = p
 			}
 
-			// there is nothing interesting about pairs that have no files in common
-			if p.Sim.BytesSame == 0 {
+			// there is nothing interesting about pairs that have no files (or chunks of files) in common.
+			// note that pairs that don't pass the filter are still taken into account for eliding other pairs
+			if p.Sim.BytesSame == 0 && p.Sim.BytesNear == 0 && p.Sim.BytesSimilar == 0 || !opts.Filter.Match(p.Sim) {
 				continue
 			}
 
@@ -277,7 +316,7 @@ Loop1:
 			// PP
 			if BothChildren(p.Path1, p.Path2, ident.p1, ident.p2) {
 				// our paths (the parents) should not be identical (otherwise the children would not have been added above), and thus can be dropped
-				if p.Sim.Identical() {
+				if p.Sim.Identical() && !p.Incomplete && !p.Partial {
 					panic("this should never happen. post-process case PP found an identical pairsim of children and parents")
 				}
 				fmt.Fprintln(log, "POST-PROCESS DROP:", ident, "were identical. Skipping 2 parents       ", p.Path1, p.Path2)
@@ -298,6 +337,11 @@ Loop1:
 	}
 	pairSims = filteredPairSims
 
+	if opts.Weights != nil {
+		SortByScore(pairSims, *opts.Weights)
+		return pairSims, err
+	}
+
 	// sort pairSims by bytes Similarity, followed by absolute bytes_same and path similarity as fallback
 	sort.Slice(pairSims, func(i, j int) bool {
 		si := pairSims[i].Sim
@@ -314,6 +358,6 @@ Loop1:
 		}
 		return si.PathSim < sj.PathSim
 	})
-	return pairSims
+	return pairSims, err
 
 }
@@ -0,0 +1,149 @@
+package janitor
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Snapshot is a saved scan of a volume. It allows comparing against the volume's content when it is not available,
+// e.g. a cold storage drive that is usually unplugged.
+type Snapshot struct {
+	Label string    // human friendly name of the volume, e.g. "archive drive X"
+	Path  string    // absolute path that was scanned
+	Taken time.Time // when the scan was done
+	Root  DirPrint
+
+	Fingerprint string // name of the fingerprint that the hashes were made with (see FingerPrinters). Hashes of different fingerprints can't be compared
+}
+
+// snapshotVersion should be bumped upon any incompatible change to the Snapshot (or DirPrint, FilePrint) structure
+const snapshotVersion = 2
+
+type snapshotFile struct {
+	Version  int
+	Snapshot Snapshot
+}
+
+// Save writes the snapshot to w
+func (s Snapshot) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(snapshotFile{
+		Version:  snapshotVersion,
+		Snapshot: s,
+	})
+}
+
+// LoadSnapshot reads a snapshot previously written by Snapshot.Save
+func LoadSnapshot(r io.Reader) (Snapshot, error) {
+	var sf snapshotFile
+	err := gob.NewDecoder(r).Decode(&sf)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if sf.Version != snapshotVersion {
+		return Snapshot{}, fmt.Errorf("unsupported snapshot version %d (expected %d)", sf.Version, snapshotVersion)
+	}
+	return sf.Snapshot, nil
+}
+
+// OfflinePath returns the given path within the snapshot (e.g. a key of Dirs()), labeled such that it can't be
+// confused with a path on a live filesystem.
+func (s Snapshot) OfflinePath(p string) string {
+	return fmt.Sprintf("[offline: %s] %s", s.Label, filepath.Join(s.Path, p))
+}
+
+// Dirs returns all DirPrints in the snapshot, keyed by their path within the snapshot, just like when walking.
+func (s Snapshot) Dirs() map[string]DirPrint {
+	return Flatten(s.Root)
+}
+
+// Presence describes how much of the content of a (live) directory is also present on an offline volume.
+// Note that we only look at content. Where on the volume it resides does not matter, nor whether it is
+// spread over multiple directories.
+type Presence struct {
+	Path         string   // path of the live directory
+	Volume       string   // label of the offline volume
+	BytesPresent int64    // number of bytes corresponding to files with content present on the volume
+	BytesMissing int64    // number of bytes corresponding to files with content missing from the volume
+	Locations    []string // the offline directories holding the present content (labeled offline paths)
+}
+
+// Full returns whether all content is present on the volume
+func (p Presence) Full() bool {
+	return p.BytesMissing == 0
+}
+
+func (p Presence) String() string {
+	if p.Full() {
+		return fmt.Sprintf("%s is fully present on offline volume %q (in %d offline dir(s)), safe to delete", p.Path, p.Volume, len(p.Locations))
+	}
+	return fmt.Sprintf("%s is partially present on offline volume %q: %d bytes present, %d bytes missing", p.Path, p.Volume, p.BytesPresent, p.BytesMissing)
+}
+
+// GetPresence checks, for each of the live directories, whether its content is present on the offline volume.
+// Directories that have no content present are omitted, as are directories of which a parent is already fully present.
+// Fully present directories come first, otherwise results are ordered by path.
+// fingerprint is the name of the fingerprint of the live DirPrints, which must be the one of the snapshot: content with the same hash
+// as per another fingerprint is not necessarily the same, e.g. sha256-text hashes normalized text.
+func GetPresence(live map[string]DirPrint, snap Snapshot, fingerprint string, log io.Writer) ([]Presence, error) {
+	if fingerprint != snap.Fingerprint {
+		return nil, fmt.Errorf("snapshot %q was taken with the %s fingerprint, not %s", snap.Label, snap.Fingerprint, fingerprint)
+	}
+	idx := NewHashIndex(snap.Root)
+
+	keys := make([]string, 0, len(live))
+	for k := range live {
+		keys = append(keys, k)
+	}
+	// make sure parent directories come before children directories, so we can skip children of fully present parents
+	sort.Strings(keys)
+
+	var full []string
+	var out []Presence
+Loop:
+	for _, k := range keys {
+		for _, f := range full {
+			if Child(f, k) {
+				continue Loop
+			}
+		}
+		p := Presence{
+			Path:   k,
+			Volume: snap.Label,
+		}
+		locations := make(map[string]struct{})
+		it := live[k].Iterator()
+		for it.Next() {
+			v, _ := it.Value()
+			paths, ok := idx[v.Hash]
+			if !ok {
+				p.BytesMissing += v.Size
+				continue
+			}
+			p.BytesPresent += v.Size
+			for _, path := range paths {
+				locations[snap.OfflinePath(filepath.Dir(path))] = struct{}{}
+			}
+		}
+		if p.BytesPresent == 0 {
+			continue
+		}
+		for l := range locations {
+			p.Locations = append(p.Locations, l)
+		}
+		sort.Strings(p.Locations)
+		if p.Full() {
+			fmt.Fprintln(log, "INF GetPresence:", k, "is fully present on", snap.Label, "skipping its children")
+			full = append(full, k)
+		}
+		out = append(out, p)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Full() && !out[j].Full()
+	})
+	return out, nil
+}
@@ -0,0 +1,122 @@
+package janitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSnapshotSaveLoad(t *testing.T) {
+	exp := Snapshot{
+		Label: "archive drive X",
+		Path:  "/mnt/archive",
+		Taken: time.Date(2022, 8, 20, 12, 0, 0, 0, time.UTC),
+		Root:  DataMainPrint,
+
+		Fingerprint: "sha256",
+	}
+	var buf bytes.Buffer
+	err := exp.Save(&buf)
+	if err != nil {
+		t.Fatalf("Save() unexpected error %v", err)
+	}
+	got, err := LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("LoadSnapshot() unexpected error %v", err)
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("LoadSnapshot() mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(Flatten(DataMainPrint), got.Dirs()); diff != "" {
+		t.Errorf("Dirs() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestGetPresence(t *testing.T) {
+	snap := Snapshot{
+		Label: "X",
+		Path:  "/mnt/archive",
+		Root:  DataMain2Print,
+
+		Fingerprint: "sha256",
+	}
+
+	// "full" has all its content on the volume (though not in one directory), and thus its child is elided.
+	// "partial" only has some, "none" has no content on the volume at all.
+	sub := DirPrint{
+		Path:  "sub",
+		Files: []FilePrint{{Path: "3", Hash: h5, Size: 555}},
+	}
+	full := DirPrint{
+		Path: "full",
+		Files: []FilePrint{
+			{Path: "z", Hash: h1, Size: 100},
+			{Path: "2", Hash: h3, Size: 333},
+		},
+		Dirs: []DirPrint{sub},
+	}
+	partial := DirPrint{
+		Path: "partial",
+		Files: []FilePrint{
+			{Path: "a", Hash: h2, Size: 122},
+			{Path: "1", Hash: h6, Size: 444},
+		},
+	}
+	none := DirPrint{
+		Path:  "none",
+		Files: []FilePrint{{Path: "4", Hash: h7, Size: 7777}},
+	}
+	root := DirPrint{
+		Path: ".",
+		Dirs: []DirPrint{full, none, partial},
+	}
+
+	exp := []Presence{
+		{
+			Path:         "full",
+			Volume:       "X",
+			BytesPresent: 100 + 333 + 555,
+			Locations:    []string{"[offline: X] /mnt/archive", "[offline: X] /mnt/archive/b"},
+		},
+		{
+			Path:         ".",
+			Volume:       "X",
+			BytesPresent: 100 + 333 + 555 + 122,
+			BytesMissing: 444 + 7777,
+			Locations:    []string{"[offline: X] /mnt/archive", "[offline: X] /mnt/archive/b"},
+		},
+		{
+			Path:         "partial",
+			Volume:       "X",
+			BytesPresent: 122,
+			BytesMissing: 444,
+			Locations:    []string{"[offline: X] /mnt/archive"},
+		},
+	}
+
+	got, err := GetPresence(Flatten(root), snap, "sha256", ioutil.Discard)
+	if diff := cmp.Diff(exp, got); err != nil || diff != "" {
+		t.Errorf("GetPresence() mismatch (-want +got):\n%s\nerror %v", diff, err)
+	}
+
+	// all offline copies are listed
+	snap.Root = DirPrint{Path: ".", Dirs: []DirPrint{
+		{Path: "c", Files: []FilePrint{{Path: "z", Hash: h1, Size: 100}}},
+		{Path: "d", Files: []FilePrint{{Path: "z-copy", Hash: h1, Size: 100}}},
+	}}
+	got, err = GetPresence(map[string]DirPrint{"live": {Path: "live", Files: []FilePrint{{Path: "z", Hash: h1, Size: 100}}}}, snap, "sha256", ioutil.Discard)
+	if err != nil || len(got) != 1 {
+		t.Fatalf("GetPresence() = %+v, %v, want the live directory", got, err)
+	}
+	if diff := cmp.Diff([]string{"[offline: X] /mnt/archive/c", "[offline: X] /mnt/archive/d"}, got[0].Locations); diff != "" {
+		t.Errorf("GetPresence() locations mismatch (-want +got):\n%s", diff)
+	}
+
+	// the hashes of another fingerprint can't be compared. e.g. sha256-text hashes normalized text
+	if got, err := GetPresence(Flatten(root), snap, "sha256-text", ioutil.Discard); err == nil {
+		t.Errorf("GetPresence() with another fingerprint = %+v, want an error", got)
+	}
+}
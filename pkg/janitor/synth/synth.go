@@ -0,0 +1,147 @@
+// Package synth generates large, realistic in-memory directory trees, useful for benchmarks.
+// The trees are deterministic: the same options (including the seed) always generate the same tree.
+package synth
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"testing/fstest"
+
+	"github.com/Dieterbe/janitor/pkg/janitor/mkzip"
+)
+
+// Opts control the shape of a generated tree
+type Opts struct {
+	Seed    int64
+	Depth   int // levels of directories below the root
+	FanOut  int // number of subdirectories of each directory (above the deepest level)
+	Files   int // number of files in each directory
+	MinSize int // minimum size of a file, in bytes
+	MaxSize int // maximum size of a file, in bytes. File sizes are uniformly distributed between MinSize and MaxSize
+
+	DupRatio     float64 // fraction of the files that are copies of an earlier file
+	NearDupRatio float64 // fraction of the directories that are near-copies of an earlier directory (and its subdirectories): the same, but with a file changed, one removed and one added
+	ZipRatio     float64 // fraction of the directories (below the root) that are stored as a zip file instead
+}
+
+// DefaultOpts make a tree of about 85 directories and 700 files of up to 32 KiB (11 MiB in total), with some copies, near-copies and zip files
+var DefaultOpts = Opts{
+	Seed:         1,
+	Depth:        3,
+	FanOut:       4,
+	Files:        8,
+	MinSize:      1024,
+	MaxSize:      32 * 1024,
+	DupRatio:     0.2,
+	NearDupRatio: 0.1,
+	ZipRatio:     0.05,
+}
+
+// file is a generated file, with a path relative to the directory it was generated in
+type file struct {
+	path string
+	data []byte
+}
+
+// subtree is a generated directory, along with everything in it
+type subtree struct {
+	height int // number of levels of directories below it
+	files  []file
+}
+
+type generator struct {
+	opts     Opts
+	rng      *rand.Rand
+	files    [][]byte  // contents of all files so far, to copy from
+	subtrees []subtree // all directories so far, to copy from
+}
+
+// Generate generates a tree as per the options
+func Generate(opts Opts) fstest.MapFS {
+	g := generator{
+		opts: opts,
+		rng:  rand.New(rand.NewSource(opts.Seed)),
+	}
+	fsys := make(fstest.MapFS)
+	for _, f := range g.dir(0).files {
+		fsys[f.path] = &fstest.MapFile{Data: f.data}
+	}
+	return fsys
+}
+
+// dir generates a directory at the given depth
+func (g *generator) dir(depth int) subtree {
+	height := g.opts.Depth - depth
+	if st, ok := g.nearCopy(height); ok {
+		return st
+	}
+	st := subtree{height: height}
+	for i := 0; i < g.opts.Files; i++ {
+		st.files = append(st.files, file{path: fmt.Sprintf("file%03d.dat", i), data: g.content()})
+	}
+	if depth < g.opts.Depth {
+		for i := 0; i < g.opts.FanOut; i++ {
+			sub := g.dir(depth + 1)
+			name := fmt.Sprintf("dir%03d", i)
+			if g.rng.Float64() < g.opts.ZipRatio {
+				st.files = append(st.files, file{path: name + ".zip", data: zipped(sub.files)})
+				continue
+			}
+			for _, f := range sub.files {
+				st.files = append(st.files, file{path: path.Join(name, f.path), data: f.data})
+			}
+		}
+	}
+	g.subtrees = append(g.subtrees, st)
+	return st
+}
+
+// nearCopy returns a near-copy of an earlier directory that is no higher than height, if the dice say so
+func (g *generator) nearCopy(height int) (subtree, bool) {
+	if len(g.subtrees) == 0 || g.rng.Float64() >= g.opts.NearDupRatio {
+		return subtree{}, false
+	}
+	var candidates []subtree
+	for _, st := range g.subtrees {
+		if st.height <= height && len(st.files) > 1 {
+			candidates = append(candidates, st)
+		}
+	}
+	if len(candidates) == 0 {
+		return subtree{}, false
+	}
+	orig := candidates[g.rng.Intn(len(candidates))]
+	st := subtree{height: orig.height, files: append([]file(nil), orig.files...)}
+	changed := g.rng.Intn(len(st.files))
+	st.files[changed] = file{path: st.files[changed].path, data: g.content()}
+	removed := g.rng.Intn(len(st.files))
+	st.files = append(st.files[:removed], st.files[removed+1:]...)
+	st.files = append(st.files, file{path: fmt.Sprintf("added%03d.dat", len(g.subtrees)), data: g.content()})
+	g.subtrees = append(g.subtrees, st)
+	return st, true
+}
+
+// content returns the content of a new file: a copy of an earlier file, or random bytes
+func (g *generator) content() []byte {
+	if len(g.files) > 0 && g.rng.Float64() < g.opts.DupRatio {
+		return g.files[g.rng.Intn(len(g.files))]
+	}
+	size := g.opts.MinSize
+	if g.opts.MaxSize > g.opts.MinSize {
+		size += g.rng.Intn(g.opts.MaxSize - g.opts.MinSize + 1)
+	}
+	data := make([]byte, size)
+	g.rng.Read(data)
+	g.files = append(g.files, data)
+	return data
+}
+
+// zipped returns a zip file of the files. Being random, their content is stored rather than deflated.
+func zipped(files []file) []byte {
+	var entries []mkzip.Entry
+	for _, f := range files {
+		entries = append(entries, mkzip.Entry{Path: f.path, Body: string(f.data), Store: true})
+	}
+	return mkzip.Archive{Entries: entries}.MustBytes()
+}
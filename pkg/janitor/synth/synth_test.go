@@ -0,0 +1,123 @@
+package synth
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGenerateShape(t *testing.T) {
+	fsys := Generate(Opts{Depth: 2, FanOut: 2, Files: 1, MinSize: 10, MaxSize: 10})
+	var got []string
+	for p, f := range fsys {
+		got = append(got, p)
+		if len(f.Data) != 10 {
+			t.Errorf("%s: expected 10 bytes, got %d", p, len(f.Data))
+		}
+	}
+	sort.Strings(got)
+	exp := []string{
+		"dir000/dir000/file000.dat",
+		"dir000/dir001/file000.dat",
+		"dir000/file000.dat",
+		"dir001/dir000/file000.dat",
+		"dir001/dir001/file000.dat",
+		"dir001/file000.dat",
+		"file000.dat",
+	}
+	if diff := cmp.Diff(exp, got); diff != "" {
+		t.Errorf("Generate() mismatch (-want +got):\n%s", diff)
+	}
+	if err := fstest.TestFS(fsys, exp...); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	a, b := Generate(DefaultOpts), Generate(DefaultOpts)
+	if len(a) != len(b) {
+		t.Fatalf("expected the same number of files, got %d and %d", len(a), len(b))
+	}
+	for p, f := range a {
+		if g, ok := b[p]; !ok || !bytes.Equal(f.Data, g.Data) {
+			t.Errorf("%s differs between trees of the same seed", p)
+		}
+	}
+	opts := DefaultOpts
+	opts.Seed = 2
+	c := Generate(opts)
+	same := 0
+	for p, f := range a {
+		if g, ok := c[p]; ok && bytes.Equal(f.Data, g.Data) {
+			same++
+		}
+	}
+	if same == len(a) {
+		t.Errorf("expected trees of different seeds to differ")
+	}
+}
+
+func TestGenerateRatios(t *testing.T) {
+	// all files but the first are copies, all directories below the root are zip files
+	fsys := Generate(Opts{Depth: 2, FanOut: 2, Files: 2, MinSize: 10, MaxSize: 20, DupRatio: 1, ZipRatio: 1})
+	var zips, files []string
+	for p := range fsys {
+		if path.Ext(p) == ".zip" {
+			zips = append(zips, p)
+		} else {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(zips)
+	if diff := cmp.Diff([]string{"dir000.zip", "dir001.zip"}, zips); diff != "" || len(files) != 2 {
+		t.Fatalf("expected 2 zip files and 2 files, got %v and %v", zips, files)
+	}
+	data := fsys["dir000.zip"].Data
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nested int
+	hashes := make(map[[32]byte]bool)
+	err = fs.WalkDir(zr, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if path.Ext(p) == ".zip" {
+			nested++
+			return nil
+		}
+		b, err := fs.ReadFile(zr, p)
+		hashes[sha256.Sum256(b)] = true
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested != 2 || len(hashes) != 1 {
+		t.Errorf("expected 2 nested zip files and files with the same content, got %d zip files and %d different contents", nested, len(hashes))
+	}
+
+	// near-copies have a file changed, one removed and one added
+	fsys = Generate(Opts{Depth: 1, FanOut: 2, Files: 4, MinSize: 10, MaxSize: 20, NearDupRatio: 1})
+	var same, copied int
+	for p, f := range fsys {
+		if strings.HasPrefix(p, "dir001/") {
+			copied++
+			if orig, ok := fsys["dir000/"+strings.TrimPrefix(p, "dir001/")]; ok && bytes.Equal(orig.Data, f.Data) {
+				same++
+			}
+		}
+	}
+	if copied != 4 || same != 2 {
+		t.Errorf("expected a near-copy of 4 files of which 2 are the same, got %d files of which %d are the same", copied, same)
+	}
+}
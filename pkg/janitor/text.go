@@ -0,0 +1,207 @@
+package janitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"unicode/utf8"
+)
+
+// textSniffLen is how much of the content is looked at to decide whether a file is text
+const textSniffLen = 8 << 10
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// TextFingerPrint computes the sha256 based fingerprint for the given file content, like Sha256FingerPrint,
+// but for text files, it hashes the content after normalizing it, so that copies that differ only in these ways match:
+//   - a leading byte order mark is removed
+//   - CRLF (and lone CR) line endings become LF
+//   - trailing whitespace is removed from every line
+//   - the last line always ends with a LF
+//
+// Content is considered text if it is valid UTF-8 without NUL bytes. Content of which the start is not (see IsText) is hashed as is
+// right away. Content that only turns out not to be text later on (e.g. a binary format with a text header) is hashed as is as well.
+// If normalizing changed the content, RawHash is the hash of the original content. Size is always that of the original.
+func TextFingerPrint(base string, r io.Reader) (FilePrint, error) {
+	pr := FilePrint{Path: base}
+
+	br := bufio.NewReaderSize(r, textSniffLen)
+	start, err := br.Peek(textSniffLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return pr, err
+	}
+	raw := sha256.New()
+	if !IsText(start) {
+		pr.Size, err = io.Copy(raw, br)
+		if err != nil {
+			return pr, err
+		}
+		copy(pr.Hash[:], raw.Sum(nil))
+		return pr, nil
+	}
+
+	norm := sha256.New()
+	nw := &normalizer{w: norm}
+	var tc textChecker
+	pr.Size, err = io.Copy(io.MultiWriter(raw, nw, &tc), br)
+	if err != nil {
+		return pr, err
+	}
+	var rawHash [32]byte
+	copy(rawHash[:], raw.Sum(nil))
+	if !tc.text() {
+		pr.Hash = rawHash
+		return pr, nil
+	}
+	nw.close()
+	copy(pr.Hash[:], norm.Sum(nil))
+	if rawHash != pr.Hash {
+		pr.RawHash = &rawHash
+	}
+	return pr, nil
+}
+
+// IsText returns whether content that starts with b looks like text: valid UTF-8 without NUL bytes.
+// b may have been cut off in the middle of a multi-byte character.
+func IsText(b []byte) bool {
+	if bytes.IndexByte(b, 0) >= 0 {
+		return false
+	}
+	return utf8.Valid(b[:len(b)-partialRune(b)])
+}
+
+// partialRune returns the length of the incomplete multi-byte character that b ends with, if any
+func partialRune(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:]) {
+				return len(b) - i
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// textChecker checks whether all content written to it is text, like IsText does for the start of content
+type textChecker struct {
+	binary bool
+	tail   []byte // the incomplete multi-byte character that the last write ended with
+}
+
+func (tc *textChecker) Write(p []byte) (int, error) {
+	n := len(p)
+	if tc.binary {
+		return n, nil
+	}
+	if len(tc.tail) > 0 {
+		// complete the character that the last write ended with
+		more := utf8.UTFMax - len(tc.tail)
+		if more > len(p) {
+			more = len(p)
+		}
+		r := append(tc.tail, p[:more]...)
+		if !utf8.FullRune(r) {
+			tc.tail = r
+			return n, nil
+		}
+		c, size := utf8.DecodeRune(r)
+		if c == utf8.RuneError && size == 1 {
+			tc.binary = true
+			return n, nil
+		}
+		p = p[size-len(tc.tail):]
+		tc.tail = tc.tail[:0]
+	}
+	if !IsText(p) {
+		tc.binary = true
+		return n, nil
+	}
+	tc.tail = append(tc.tail, p[len(p)-partialRune(p):]...)
+	return n, nil
+}
+
+// text returns whether all content was text. content can't end with an incomplete character
+func (tc *textChecker) text() bool {
+	return !tc.binary && len(tc.tail) == 0
+}
+
+// normalizer writes the normalized form of the text written to it, see TextFingerPrint
+type normalizer struct {
+	w       io.Writer
+	started bool   // whether any content was written to us (past a BOM)
+	bom     int    // number of bytes of a leading BOM seen so far
+	cr      bool   // whether the last byte was a CR
+	pending []byte // trailing whitespace of the current line, written only if the line continues
+	wrote   bool   // whether any output was written
+	lastLF  bool   // whether the last output was a LF
+	out     []byte
+}
+
+func (n *normalizer) Write(p []byte) (int, error) {
+	n.out = n.out[:0]
+	for _, c := range p {
+		if !n.started {
+			if n.bom < len(utf8BOM) && c == utf8BOM[n.bom] {
+				n.bom++
+				if n.bom == len(utf8BOM) {
+					n.started = true
+				}
+				continue
+			}
+			// not a BOM after all
+			n.started = true
+			n.out = append(n.out, utf8BOM[:n.bom]...)
+		}
+		if n.cr {
+			// the line ended with a CR: whether it's a CRLF or a lone CR, it's a LF
+			n.cr = false
+			n.pending = n.pending[:0]
+			n.out = append(n.out, '\n')
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case ' ', '\t':
+			n.pending = append(n.pending, c)
+		case '\r':
+			n.cr = true
+		case '\n':
+			n.pending = n.pending[:0]
+			n.out = append(n.out, '\n')
+		default:
+			n.out = append(n.out, n.pending...)
+			n.pending = n.pending[:0]
+			n.out = append(n.out, c)
+		}
+	}
+	n.emit()
+	return len(p), nil
+}
+
+func (n *normalizer) emit() {
+	if len(n.out) == 0 {
+		return
+	}
+	n.w.Write(n.out)
+	n.wrote = true
+	n.lastLF = n.out[len(n.out)-1] == '\n'
+	n.out = n.out[:0]
+}
+
+// close ends the text: trailing whitespace is dropped, and the last line terminated
+func (n *normalizer) close() {
+	if !n.started && n.bom > 0 {
+		// the content was a partial BOM
+		n.out = append(n.out, utf8BOM[:n.bom]...)
+	}
+	if n.cr {
+		n.out = append(n.out, '\n')
+	}
+	n.emit()
+	if n.wrote && !n.lastLF {
+		n.w.Write([]byte{'\n'})
+	}
+}
@@ -0,0 +1,163 @@
+package janitor
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestTextFingerPrint(t *testing.T) {
+	normalized := "line 1\n\tline 2\n\nline 4\n"
+	variants := map[string]string{
+		"normalized":          normalized,
+		"crlf":                "line 1\r\n\tline 2\r\n\r\nline 4\r\n",
+		"cr":                  "line 1\r\tline 2\r\rline 4\r",
+		"bom":                 "\xef\xbb\xbfline 1\n\tline 2\n\nline 4\n",
+		"trailing whitespace": "line 1  \n\tline 2\t\n \nline 4 \t\n",
+		"no final newline":    "line 1\n\tline 2\n\nline 4",
+		"all of the above":    "\xef\xbb\xbfline 1 \r\n\tline 2\r\n\t\r\nline 4  ",
+	}
+	exp := sha256.Sum256([]byte(normalized))
+	for name, content := range variants {
+		for _, r := range []struct {
+			desc string
+			fpr  FingerPrinter
+		}{
+			{"", TextFingerPrint},
+			// the normalization must not depend on how the content is split up in writes
+			{" (a byte at a time)", func(base string, _ io.Reader) (FilePrint, error) {
+				return TextFingerPrint(base, &oneByteReader{[]byte(content)})
+			}},
+		} {
+			got, err := r.fpr(name, strings.NewReader(content))
+			if err != nil {
+				t.Fatalf("%s%s: unexpected error %v", name, r.desc, err)
+			}
+			if got.Hash != exp {
+				t.Errorf("%s%s: hash %x, want the hash of the normalized content %x", name, r.desc, got.Hash, exp)
+			}
+			if got.Size != int64(len(content)) {
+				t.Errorf("%s%s: size %d, want %d", name, r.desc, got.Size, len(content))
+			}
+			raw := sha256.Sum256([]byte(content))
+			if content == normalized && got.RawHash != nil {
+				t.Errorf("%s%s: RawHash is set, but the content did not change", name, r.desc)
+			}
+			if content != normalized && (got.RawHash == nil || *got.RawHash != raw) {
+				t.Errorf("%s%s: RawHash %v, want %x", name, r.desc, got.RawHash, raw)
+			}
+		}
+	}
+
+	// whitespace within lines, and a partial BOM, are content
+	for _, content := range []string{"line  1\n", "a\tb\n", "\xef\xbbx\n"} {
+		got, err := TextFingerPrint("x", strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != sha256.Sum256([]byte(content)) || got.RawHash != nil {
+			t.Errorf("%q should not change by normalization", content)
+		}
+	}
+
+	// binary content is hashed as is
+	binary := "\x00\x01 \r\n"
+	got, err := TextFingerPrint("bin", strings.NewReader(binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != sha256.Sum256([]byte(binary)) || got.RawHash != nil {
+		t.Errorf("binary content was normalized")
+	}
+}
+
+// TestTextFingerPrintBinaryTail tests that content that only turns out not to be text after its start is hashed as is
+func TestTextFingerPrintBinaryTail(t *testing.T) {
+	header := strings.Repeat("a text header\r\n", textSniffLen/10)
+	tails := []string{
+		"\x00\x01 \r\n",   // a NUL byte
+		"\xff\xfe \r\n",   // invalid UTF-8
+		"h\xc3 \r\n",      // a character that is cut off by a space
+		"line 1\r\nh\xc3", // a character that is cut off by the end
+	}
+	for _, tail := range tails {
+		content := header + tail
+		for _, r := range []io.Reader{strings.NewReader(content), &oneByteReader{[]byte(content)}} {
+			got, err := TextFingerPrint("x", r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Hash != sha256.Sum256([]byte(content)) || got.RawHash != nil {
+				t.Errorf("content with a text header and tail %q was normalized", tail)
+			}
+		}
+	}
+
+	// characters may be split up across writes
+	content := header + "héllo \xef\xbb\xbf\r\n"
+	got, err := TextFingerPrint("x", &oneByteReader{[]byte(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RawHash == nil {
+		t.Errorf("text with multi-byte characters was not normalized")
+	}
+}
+
+func TestIsText(t *testing.T) {
+	cases := []struct {
+		in  string
+		exp bool
+	}{
+		{"", true},
+		{"hello\n", true},
+		{"héllo", true},
+		{"h\xc3", true}, // cut off in the middle of a character
+		{"h\xc3x", false},
+		{"hello\x00", false},
+		{"\xff\xfeh\x00i\x00", false}, // UTF-16
+	}
+	for _, c := range cases {
+		if got := IsText([]byte(c.in)); got != c.exp {
+			t.Errorf("IsText(%q) = %t, want %t", c.in, got, c.exp)
+		}
+	}
+}
+
+func TestCompareNormalized(t *testing.T) {
+	crlf := func(path string) FilePrint {
+		fp, _ := TextFingerPrint(path, strings.NewReader("a\r\nb\r\n"))
+		return fp
+	}
+	lf := func(path string) FilePrint {
+		fp, _ := TextFingerPrint(path, strings.NewReader("a\nb\n"))
+		return fp
+	}
+	a := DirPrint{Path: "a", Files: []FilePrint{crlf("x.txt"), crlf("y.txt")}}
+	b := DirPrint{Path: "b", Files: []FilePrint{crlf("x.txt"), lf("y.txt")}}
+
+	c := Compare(a, b)
+	if len(c.Matched) != 2 {
+		t.Fatalf("expected both files to match, got %+v", c)
+	}
+	var normalized []string
+	for _, m := range c.Matched {
+		if m.Normalized() {
+			normalized = append(normalized, m.A.Path)
+		}
+	}
+	if len(normalized) != 1 || normalized[0] != "y.txt" {
+		t.Errorf("expected only y.txt to match after normalization, got %v", normalized)
+	}
+	sim := c.Similarity()
+	if sim.FilesSame != 2 || sim.FilesNormalized != 1 {
+		t.Errorf("Similarity() = %+v, want 2 files same, of which 1 normalized", sim)
+	}
+	if sim.Identical() {
+		t.Errorf("Similarity().Identical() = true, but there is no byte-level copy of y.txt")
+	}
+	if !Compare(a, a).Similarity().Identical() {
+		t.Errorf("a is not identical to itself")
+	}
+}